@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/backup"
+	"kypaqet-license-bot/internal/license"
+	"kypaqet-license-bot/internal/store"
+)
+
+// commands are one-shot subcommands run instead of the service, e.g.
+// "licensebot migrate --dry-run". They open the database directly, so with
+// bbolt the service must be stopped first (it allows a single writer);
+// SQLite databases can be read and written while the service runs.
+var commands = map[string]func(args []string) error{
+	"migrate": runMigrate,
+	"backup":  runBackup,
+	"restore": runRestore,
+	"export":  runExport,
+	"import":  runImport,
+	"convert": runConvert,
+}
+
+func driverFlag(fs *flag.FlagSet) *string {
+	return fs.String("db-driver", getenvDefault("DB_DRIVER", "bbolt"), "bbolt or sqlite (or env DB_DRIVER)")
+}
+
+// bboltOnly rejects commands that only make sense for bbolt files.
+func bboltOnly(cmd, driver, hint string) error {
+	if driver == "bbolt" {
+		return nil
+	}
+	return fmt.Errorf("%s works on bbolt databases only; %s", cmd, hint)
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	driver := driverFlag(fs)
+	dbPath := fs.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+	secretPath := fs.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Key hashing secret (or env KEY_SECRET_PATH)")
+	dryRun := fs.Bool("dry-run", false, "Show pending migrations without applying them")
+	_ = fs.Parse(args)
+	if err := bboltOnly("migrate", *driver, "sqlite databases are migrated when opened"); err != nil {
+		return err
+	}
+
+	secret, err := loadSecret(*secretPath)
+	if errors.Is(err, os.ErrNotExist) && !*dryRun {
+		// Raw keys hashed under a wrong secret are lost for good, so a new
+		// secret is only made for a database without any.
+		n, cerr := store.RawKeysBBolt(*dbPath)
+		if cerr != nil {
+			return cerr
+		}
+		if n == 0 {
+			secret, err = license.LoadOrCreateSecret(*secretPath)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	res, err := store.MigrateBBolt(*dbPath, store.Options{KeySecret: secret}, *dryRun)
+	if err != nil {
+		return err
+	}
+	if len(res.Applied) == 0 {
+		fmt.Printf("schema version %d, up to date\n", res.From)
+		return nil
+	}
+	verb := "applied"
+	if *dryRun {
+		verb = "would apply"
+	}
+	fmt.Printf("schema version %d -> %d, %s:\n", res.From, res.To, verb)
+	for _, name := range res.Applied {
+		fmt.Printf("  %s\n", name)
+	}
+	return nil
+}
+
+// runBackup snapshots the database. A running bbolt service holds the file
+// lock, so use its scheduled snapshots or the bot's backup button instead.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	driver := driverFlag(fs)
+	dbPath := fs.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+	out := fs.String("out", backup.FileName(time.Now()), "Output file")
+	secretPath := fs.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Key hashing secret, for sqlite (or env KEY_SECRET_PATH)")
+	_ = fs.Parse(args)
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	var n int64
+	switch {
+	case *driver == "bbolt":
+		n, err = store.BackupBBolt(*dbPath, f)
+	default:
+		n, err = backupStore(*driver, *dbPath, *secretPath, f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(*out)
+		return err
+	}
+	fmt.Printf("wrote %s (%d bytes)\n", *out, n)
+	return nil
+}
+
+// backupStore snapshots through the store, which SQLite can do next to a
+// running service.
+func backupStore(driver, dbPath, secretPath string, w io.Writer) (int64, error) {
+	st, err := openStore(driver, dbPath, secretPath)
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+	return st.Backup(w)
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	driver := driverFlag(fs)
+	dbPath := fs.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+	in := fs.String("in", "", "Snapshot file to restore")
+	_ = fs.Parse(args)
+	if err := bboltOnly("restore", *driver, "stop the service and copy the snapshot over "+*dbPath); err != nil {
+		return err
+	}
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	if err := store.RestoreBBolt(*dbPath, *in); err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from %s\n", *dbPath, *in)
+	return nil
+}
+
+// openStore opens an existing database for a one-shot command.
+func openStore(driver, dbPath, secretPath string) (store.Store, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	secret, err := loadSecret(secretPath)
+	if err != nil {
+		return nil, err
+	}
+	return openDB(driver, dbPath, store.Options{KeySecret: secret})
+}
+
+// loadSecret reads the secret an existing database was written with. It is
+// never created here: a new one would silently match none of the keys.
+func loadSecret(path string) ([]byte, error) {
+	secret, err := license.LoadSecret(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w; pass the service's secret with -key-secret or KEY_SECRET_PATH", err)
+	}
+	return secret, err
+}
+
+// formatFor picks the export format from a file name unless one was given.
+func formatFor(format, name string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return store.FormatCSV
+	}
+	return store.FormatJSONL
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	driver := driverFlag(fs)
+	dbPath := fs.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+	secretPath := fs.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Key hashing secret (or env KEY_SECRET_PATH)")
+	out := fs.String("out", "-", "Output file (- for stdout)")
+	format := fs.String("format", "", "jsonl or csv (default from -out extension, else jsonl)")
+	_ = fs.Parse(args)
+
+	st, err := openStore(*driver, *dbPath, *secretPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := st.Export(w, store.ExportOptions{Format: formatFor(*format, *out)})
+	if err != nil {
+		return err
+	}
+	if *out != "-" {
+		fmt.Printf("exported %d licenses to %s\n", n, *out)
+	}
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	driver := driverFlag(fs)
+	dbPath := fs.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+	secretPath := fs.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Key hashing secret (or env KEY_SECRET_PATH)")
+	in := fs.String("in", "", "File to import (- for stdin)")
+	format := fs.String("format", "", "jsonl or csv (default from -in extension, else jsonl)")
+	onConflict := fs.String("on-conflict", store.ConflictFail, "What to do with licenses that already exist: skip, overwrite or fail")
+	_ = fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+	r := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	st, err := openStore(*driver, *dbPath, *secretPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	res, err := st.As("cli").Import(r, store.ImportOptions{Format: formatFor(*format, *in), OnConflict: *onConflict})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created %d, overwritten %d, skipped %d\n", res.Created, res.Overwritten, res.Skipped)
+	return nil
+}
+
+// runConvert copies a bbolt database into a new SQLite file, after which the
+// service can run with DB_DRIVER=sqlite and DB_PATH pointing at it.
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := fs.String("from", getenvDefault("DB_PATH", "./data/licensebot.db"), "bbolt database to read (or env DB_PATH)")
+	to := fs.String("to", "", "SQLite database to create")
+	secretPath := fs.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Key hashing secret (or env KEY_SECRET_PATH)")
+	_ = fs.Parse(args)
+	if *to == "" {
+		return fmt.Errorf("-to is required")
+	}
+	if _, err := os.Stat(*from); err != nil {
+		return err
+	}
+	secret, err := loadSecret(*secretPath)
+	if err != nil {
+		return err
+	}
+	res, err := store.ConvertBBolt(*from, *to, store.Options{KeySecret: secret})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("converted %s -> %s: %d licenses, %d bindings, %d reaped, %d audit events, %d tokens, %d admins, %d customers, %d webhooks, %d deliveries\n",
+		*from, *to, res.Licenses, res.Bindings, res.Reaped, res.Audit, res.Tokens, res.Admins, res.Customers, res.Webhooks, res.Deliveries)
+	return nil
+}
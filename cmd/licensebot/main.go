@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,17 +12,56 @@ import (
 	"syscall"
 	"time"
 
+	"kypaqet-license-bot/internal/backup"
+	"kypaqet-license-bot/internal/events"
 	"kypaqet-license-bot/internal/httpapi"
+	"kypaqet-license-bot/internal/license"
+	"kypaqet-license-bot/internal/metrics"
 	"kypaqet-license-bot/internal/store"
 	"kypaqet-license-bot/internal/telegram"
+	"kypaqet-license-bot/internal/webhook"
 )
 
+// memoryDB as DB_PATH keeps the database in memory for throwaway runs.
+const memoryDB = ":memory:"
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	var (
 		botToken    = flag.String("bot-token", os.Getenv("BOT_TOKEN"), "Telegram bot token (or env BOT_TOKEN)")
 		adminChatID = flag.String("admin-chat-id", getenvDefault("ADMIN_CHAT_ID", "1879326595"), "Admin chat id (or env ADMIN_CHAT_ID)")
-		dbPath      = flag.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path (or env DB_PATH)")
+		dbDriver    = flag.String("db-driver", getenvDefault("DB_DRIVER", "bbolt"), "Storage backend: bbolt or sqlite (or env DB_DRIVER)")
+		dbPath      = flag.String("db", getenvDefault("DB_PATH", "./data/licensebot.db"), "DB path, "+memoryDB+" for a throwaway in-memory DB (or env DB_PATH)")
 		httpAddr    = flag.String("http", getenvDefault("HTTP_ADDR", ":8080"), "HTTP listen address (or env HTTP_ADDR)")
+		metricsAddr = flag.String("metrics-addr", os.Getenv("METRICS_ADDR"), "Serve /metrics on this address instead of the HTTP one (or env METRICS_ADDR)")
+		metricsTok  = flag.String("metrics-token", os.Getenv("METRICS_TOKEN"), "Bearer token required to read /metrics, empty = none (or env METRICS_TOKEN)")
+		idleDays    = flag.Int("idle-ttl-days", getenvInt("IDLE_TTL_DAYS", 0), "Release bindings idle for this many days, 0 = never (or env IDLE_TTL_DAYS)")
+		reapEvery   = flag.Duration("reap-interval", getenvDuration("REAP_INTERVAL", time.Hour), "How often to release idle bindings (or env REAP_INTERVAL)")
+		leaseTTL    = flag.Duration("lease-ttl", getenvDuration("LEASE_TTL", store.DefaultLeaseTTL), "Floating license lease lifetime without a heartbeat (or env LEASE_TTL)")
+		signingKey  = flag.String("signing-key", getenvDefault("SIGNING_KEY_PATH", "./data/signing.key"), "Ed25519 key for activation tokens, created if missing (or env SIGNING_KEY_PATH)")
+		tokenTTL    = flag.Duration("token-ttl", getenvDuration("TOKEN_TTL", 24*time.Hour), "Activation token lifetime (or env TOKEN_TTL)")
+		ipRate      = flag.Int("rate-ip", getenvInt("RATE_IP_PER_MIN", 30), "Client API requests per minute per IP, 0 = unlimited (or env RATE_IP_PER_MIN)")
+		ipBurst     = flag.Int("rate-ip-burst", getenvInt("RATE_IP_BURST", 10), "Burst per IP (or env RATE_IP_BURST)")
+		keyRate     = flag.Int("rate-key", getenvInt("RATE_KEY_PER_MIN", 10), "Client API requests per minute per license, 0 = unlimited (or env RATE_KEY_PER_MIN)")
+		keyBurst    = flag.Int("rate-key-burst", getenvInt("RATE_KEY_BURST", 5), "Burst per license (or env RATE_KEY_BURST)")
+		secretPath  = flag.String("key-secret", getenvDefault("KEY_SECRET_PATH", "./data/key.secret"), "Secret for hashing stored license keys, created if missing (or env KEY_SECRET_PATH)")
+		backupDir   = flag.String("backup-dir", os.Getenv("BACKUP_DIR"), "Directory for scheduled snapshots, empty = disabled (or env BACKUP_DIR)")
+		backupEvery = flag.Duration("backup-interval", getenvDuration("BACKUP_INTERVAL", 24*time.Hour), "Snapshot interval (or env BACKUP_INTERVAL)")
+		backupKeep  = flag.Int("backup-keep", getenvInt("BACKUP_KEEP", 7), "Snapshots to keep (or env BACKUP_KEEP)")
+		notifyEvery = flag.Duration("notify-window", getenvDuration("NOTIFY_WINDOW", time.Minute), "Collect activity notifications for this long before sending, 0 = off (or env NOTIFY_WINDOW)")
+		hookEvery   = flag.Duration("webhook-interval", getenvDuration("WEBHOOK_INTERVAL", 5*time.Second), "How often to deliver queued webhook events (or env WEBHOOK_INTERVAL)")
+		tgMode      = flag.String("telegram-mode", getenvDefault("TELEGRAM_MODE", "polling"), "How to receive bot updates: polling or webhook (or env TELEGRAM_MODE)")
+		tgURL       = flag.String("telegram-webhook-url", os.Getenv("TELEGRAM_WEBHOOK_URL"), "Public https base URL of this server for webhook mode (or env TELEGRAM_WEBHOOK_URL)")
+		tgSecret    = flag.String("telegram-webhook-secret", os.Getenv("TELEGRAM_WEBHOOK_SECRET"), "Secret token for webhook mode, shared by all replicas (or env TELEGRAM_WEBHOOK_SECRET)")
+		proxies     = flag.String("trusted-proxies", os.Getenv("TRUSTED_PROXIES"), "Comma separated IPs/CIDRs allowed to set X-Forwarded-For (or env TRUSTED_PROXIES)")
 	)
 	flag.Parse()
 
@@ -32,17 +72,78 @@ func main() {
 	if err != nil {
 		log.Fatalf("invalid admin chat id: %v", err)
 	}
+	switch *tgMode {
+	case "polling":
+	case "webhook":
+		if *tgURL == "" {
+			log.Fatal("TELEGRAM_WEBHOOK_URL is required in webhook mode")
+		}
+		if err := telegram.CheckWebhookSecret(*tgSecret); err != nil {
+			log.Fatalf("TELEGRAM_WEBHOOK_SECRET: %v", err)
+		}
+	default:
+		log.Fatalf("unknown telegram mode %q (polling or webhook)", *tgMode)
+	}
 
-	st, err := store.OpenBBolt(*dbPath)
+	secret, err := license.LoadOrCreateSecret(*secretPath)
 	if err != nil {
+		log.Fatalf("key secret: %v", err)
+	}
+
+	bus := events.NewBus()
+	opts := store.Options{
+		Events:         bus,
+		KeySecret:      secret,
+		DefaultIdleTTL: time.Duration(*idleDays) * 24 * time.Hour,
+		LeaseTTL:       *leaseTTL,
+		ObserveTx:      metrics.ObserveTx,
+	}
+	var st store.Store
+	if *dbPath == memoryDB {
+		log.Print("db: in memory, nothing is persisted")
+		st = store.NewMemory(opts)
+	} else if st, err = openDB(*dbDriver, *dbPath, opts); err != nil {
 		log.Fatalf("db open: %v", err)
 	}
 	defer st.Close()
+	metrics.Register(metrics.NewLicenseCollector(st))
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	api := httpapi.New(st)
+	priv, err := license.LoadOrCreateSigningKey(*signingKey)
+	if err != nil {
+		log.Fatalf("signing key: %v", err)
+	}
+
+	trusted, err := httpapi.ParseTrustedProxies(*proxies)
+	if err != nil {
+		log.Fatalf("trusted proxies: %v", err)
+	}
+
+	bot, err := telegram.NewBot(*botToken, adminID, st)
+	if err != nil {
+		log.Fatalf("telegram bot: %v", err)
+	}
+
+	apiOpts := httpapi.Options{
+		SigningKey:   priv,
+		TokenTTL:     *tokenTTL,
+		MetricsToken: *metricsTok,
+		NoMetrics:    *metricsAddr != "",
+		RateLimit: httpapi.RateLimit{
+			IPPerMinute:    *ipRate,
+			IPBurst:        *ipBurst,
+			KeyPerMinute:   *keyRate,
+			KeyBurst:       *keyBurst,
+			TrustedProxies: trusted,
+		},
+	}
+	if *tgMode == "webhook" {
+		apiOpts.Telegram = bot.WebhookHandler(*tgSecret)
+		apiOpts.TelegramPath = telegram.WebhookPath(*tgSecret)
+	}
+	api := httpapi.New(st, apiOpts)
 	httpServer := &http.Server{
 		Addr:              *httpAddr,
 		Handler:           api.Handler(),
@@ -55,13 +156,39 @@ func main() {
 			stop()
 		}
 	}()
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", httpapi.MetricsHandler(*metricsTok))
+		metricsServer = &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			log.Printf("metrics listening on %s", *metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("metrics server error: %v", err)
+				stop()
+			}
+		}()
+	}
 
-	bot, err := telegram.NewBot(*botToken, adminID, st)
-	if err != nil {
-		log.Fatalf("telegram bot: %v", err)
+	// Lapsed leases already count against nobody; reap them as often as they
+	// lapse so they do not pile up.
+	if *reapEvery > 0 && *leaseTTL > 0 && *leaseTTL < *reapEvery {
+		*reapEvery = *leaseTTL
+	}
+	go runReaper(ctx, st, *reapEvery)
+	log.Print(backup.Describe(*backupDir, *backupEvery, *backupKeep))
+	go backup.Run(ctx, st, *backupDir, *backupEvery, *backupKeep)
+	go webhook.Run(ctx, st, *hookEvery)
+
+	if *notifyEvery > 0 {
+		go bot.Notify(ctx, bus, *notifyEvery)
 	}
 	go func() {
-		if err := bot.Run(ctx); err != nil {
+		run := bot.Run
+		if *tgMode == "webhook" {
+			run = func(ctx context.Context) error { return bot.RunWebhook(ctx, *tgURL, *tgSecret) }
+		}
+		if err := run(ctx); err != nil {
 			log.Printf("bot error: %v", err)
 			stop()
 		}
@@ -71,6 +198,53 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	_ = httpServer.Shutdown(shutdownCtx)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}
+}
+
+// runReaper periodically releases idle bindings. Activate also reaps lazily,
+// so this only keeps counts in the bot fresh.
+func runReaper(ctx context.Context, st store.Store, every time.Duration) {
+	if every <= 0 {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := st.ReapStale()
+			if err != nil {
+				log.Printf("reaper: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("reaper: released %d idle bindings", n)
+			}
+		}
+	}
+}
+
+// openDB opens the database at path with the named storage backend.
+func openDB(driver, path string, opts store.Options) (store.Store, error) {
+	switch driver {
+	case "bbolt":
+		st, err := store.OpenBBolt(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	case "sqlite":
+		st, err := store.OpenSQLite(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+	return nil, fmt.Errorf("unknown db driver %q (bbolt or sqlite)", driver)
 }
 
 func getenvDefault(k, def string) string {
@@ -79,3 +253,23 @@ func getenvDefault(k, def string) string {
 	}
 	return def
 }
+
+func getenvInt(k string, def int) int {
+	if v := os.Getenv(k); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		log.Printf("ignoring invalid %s=%q", k, v)
+	}
+	return def
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	if v := os.Getenv(k); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("ignoring invalid %s=%q", k, v)
+	}
+	return def
+}
@@ -0,0 +1,117 @@
+// Package backup writes periodic database snapshots into a directory and
+// prunes old ones.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+)
+
+const (
+	filePrefix = "licensebot-"
+	fileSuffix = ".db"
+)
+
+// FileName is the snapshot name for t, sortable by time.
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format("20060102-150405") + fileSuffix
+}
+
+// Snapshot writes a backup of st into dir and returns its path.
+func Snapshot(st store.Store, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, FileName(time.Now()))
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := st.Backup(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// Prune keeps the newest keep snapshots in dir and deletes the rest.
+func Prune(dir string, keep int) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), fileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return 0, nil
+	}
+	sort.Strings(names)
+	removed := 0
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Run takes a snapshot every interval until ctx is done.
+func Run(ctx context.Context, st store.Store, dir string, every time.Duration, keep int) {
+	if dir == "" || every <= 0 {
+		return
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			path, err := Snapshot(st, dir)
+			if err != nil {
+				log.Printf("backup: %v", err)
+				continue
+			}
+			if n, err := Prune(dir, keep); err != nil {
+				log.Printf("backup: prune: %v", err)
+			} else if n > 0 {
+				log.Printf("backup: %s written, %d old snapshots removed", path, n)
+			}
+		}
+	}
+}
+
+// Describe is a one-line summary for logs and the bot.
+func Describe(dir string, every time.Duration, keep int) string {
+	if dir == "" || every <= 0 {
+		return "scheduled backups disabled"
+	}
+	return fmt.Sprintf("backups every %s into %s (keep %d)", every, dir, keep)
+}
@@ -0,0 +1,85 @@
+// Package events is an in-process pub/sub bus for license activity, so the
+// store can report what clients do without knowing who is listening.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	// Bound is a new server taking a seat.
+	Bound Type = "bound"
+	// LimitReached is an activation refused because every seat is taken.
+	LimitReached Type = "limit_reached"
+	// Disabled is an activation attempt with a disabled key.
+	Disabled Type = "disabled"
+	// NotFound is an activation attempt with an unknown key.
+	NotFound Type = "not_found"
+)
+
+// Types lists every event type in display order.
+var Types = []Type{Bound, LimitReached, Disabled, NotFound}
+
+type Event struct {
+	Type Type
+	At   time.Time
+	// LicenseID is empty for NotFound.
+	LicenseID   string
+	Fingerprint string
+	Note        string
+	ServerID    string
+	// Actor is who made the request, as in the audit log (e.g. "api:1.2.3.4").
+	Actor string
+	Used  int
+	Limit int
+}
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber
+// whose buffer is full misses events rather than slowing activations down.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[int]chan Event
+	next int
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]chan Event{}}
+}
+
+// Publish is a no-op on a nil bus.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events and a function that cancels the
+// subscription and closes the channel.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	id := b.next
+	b.next++
+	b.subs[id] = ch
+	b.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+)
+
+// Admin endpoints mirror the Telegram bot and call the same store methods.
+// Every request needs "Authorization: Bearer <token>" with a token created
+// from the bot.
+func (a *API) mountAdmin(mux *http.ServeMux) {
+	mux.Handle("GET /v1/admin/licenses", a.admin(a.handleAdminList))
+	mux.Handle("POST /v1/admin/licenses", a.admin(a.handleAdminCreate))
+	mux.Handle("GET /v1/admin/licenses/{key}", a.admin(a.handleAdminInfo))
+	mux.Handle("PUT /v1/admin/licenses/{key}/limit", a.admin(a.handleAdminSetLimit))
+	mux.Handle("PUT /v1/admin/licenses/{key}/mode", a.admin(a.handleAdminSetMode))
+	mux.Handle("POST /v1/admin/licenses/{key}/enable", a.admin(a.handleAdminEnable(true)))
+	mux.Handle("POST /v1/admin/licenses/{key}/disable", a.admin(a.handleAdminEnable(false)))
+	mux.Handle("POST /v1/admin/licenses/{key}/renew", a.admin(a.handleAdminRenew))
+	mux.Handle("DELETE /v1/admin/licenses/{key}/bindings", a.admin(a.handleAdminReset))
+	mux.Handle("DELETE /v1/admin/licenses/{key}/bindings/{server_id}", a.admin(a.handleAdminUnbind))
+}
+
+type adminHandler func(w http.ResponseWriter, r *http.Request, st store.Store)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// admin authenticates the bearer token and hands the handler a store view
+// attributed to that token in the audit log.
+func (a *API) admin(h adminHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.TrimSpace(token) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="licensebot"`)
+			writeJSON(w, http.StatusUnauthorized, apiError{"unauthorized"})
+			return
+		}
+		t, err := a.st.AuthAPIToken(token)
+		if err != nil {
+			if errors.Is(err, store.ErrUnauthorized) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="licensebot"`)
+				writeJSON(w, http.StatusUnauthorized, apiError{"unauthorized"})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, apiError{"server_error"})
+			return
+		}
+		h(w, r, a.st.As("token:"+t.Name))
+	})
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{"not_found"})
+	case errors.Is(err, store.ErrNotBound):
+		writeJSON(w, http.StatusNotFound, apiError{"not_bound"})
+	case errors.Is(err, store.ErrCustomerNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{"customer_not_found"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, apiError{"server_error"})
+	}
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// handleAdminList pages through licenses newest first, like the bot's list:
+// pass the returned "next" (or "prev") back as ?cursor=.
+func (a *API) handleAdminList(w http.ResponseWriter, r *http.Request, st store.Store) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	filter := store.LicenseFilter{
+		Status:     q.Get("status"),
+		Search:     q.Get("q"),
+		CustomerID: strings.ToLower(strings.TrimSpace(q.Get("customer_id"))),
+	}
+	page, err := st.QueryLicenses(filter, q.Get("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidQuery) {
+			writeJSON(w, http.StatusBadRequest, apiError{"invalid_request"})
+			return
+		}
+		writeStoreError(w, err)
+		return
+	}
+	if page.Items == nil {
+		page.Items = []store.LicenseInfo{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+type createReq struct {
+	Limit     int    `json:"limit"`
+	Note      string `json:"note"`
+	ValidDays int    `json:"valid_days"`
+	GraceDays int    `json:"grace_days"`
+	Customer  string `json:"customer_id"`
+}
+
+func (a *API) handleAdminCreate(w http.ResponseWriter, r *http.Request, st store.Store) {
+	var req createReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"bad_json"})
+		return
+	}
+	if req.Limit <= 0 || req.ValidDays < 0 || req.GraceDays < 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid_request"})
+		return
+	}
+	lic, err := st.CreateLicense(req.Limit, strings.TrimSpace(req.Note), store.CreateOptions{
+		ValidFor:   time.Duration(req.ValidDays) * 24 * time.Hour,
+		GraceDays:  req.GraceDays,
+		CustomerID: strings.ToLower(strings.TrimSpace(req.Customer)),
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, lic)
+}
+
+func (a *API) handleAdminInfo(w http.ResponseWriter, r *http.Request, st store.Store) {
+	info, err := st.GetInfo(r.PathValue("key"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *API) handleAdminSetLimit(w http.ResponseWriter, r *http.Request, st store.Store) {
+	var req struct {
+		Limit int `json:"limit"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"bad_json"})
+		return
+	}
+	if req.Limit <= 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid_request"})
+		return
+	}
+	lic, err := st.SetLimit(r.PathValue("key"), req.Limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lic)
+}
+
+func (a *API) handleAdminSetMode(w http.ResponseWriter, r *http.Request, st store.Store) {
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"bad_json"})
+		return
+	}
+	if req.Mode != store.ModeNodeLocked && req.Mode != store.ModeFloating {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid_request"})
+		return
+	}
+	lic, err := st.SetMode(r.PathValue("key"), req.Mode)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lic)
+}
+
+func (a *API) handleAdminEnable(enabled bool) adminHandler {
+	return func(w http.ResponseWriter, r *http.Request, st store.Store) {
+		lic, err := st.SetEnabled(r.PathValue("key"), enabled)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, lic)
+	}
+}
+
+func (a *API) handleAdminRenew(w http.ResponseWriter, r *http.Request, st store.Store) {
+	var req struct {
+		Days int `json:"days"`
+	}
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{"bad_json"})
+		return
+	}
+	if req.Days <= 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{"invalid_request"})
+		return
+	}
+	lic, err := st.Renew(r.PathValue("key"), time.Duration(req.Days)*24*time.Hour)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lic)
+}
+
+func (a *API) handleAdminReset(w http.ResponseWriter, r *http.Request, st store.Store) {
+	n, err := st.ResetBindings(r.PathValue("key"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"released": n})
+}
+
+func (a *API) handleAdminUnbind(w http.ResponseWriter, r *http.Request, st store.Store) {
+	if err := st.Unbind(r.PathValue("key"), r.PathValue("server_id")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kypaqet-license-bot/internal/store"
+)
+
+// newTestAPI serves a fresh in-memory store.
+func newTestAPI(t *testing.T, opts Options) (*API, store.Store) {
+	t.Helper()
+	st := store.NewMemory(store.Options{KeySecret: []byte("test-secret")})
+	return New(st, opts), st
+}
+
+// call sends body (JSON, or nothing if empty) with an optional bearer token.
+func call(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("content-type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func adminToken(t *testing.T, st store.Store) string {
+	t.Helper()
+	token, _, err := st.CreateAPIToken("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAdminAuth(t *testing.T) {
+	api, st := newTestAPI(t, Options{})
+	h := api.Handler()
+	token := adminToken(t, st)
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", "not-a-token", http.StatusUnauthorized},
+		{"valid", token, http.StatusOK},
+	} {
+		rec := call(h, http.MethodGet, "/v1/admin/licenses", tt.token, "")
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tt.name)
+		}
+	}
+
+	// The database snapshot holds secrets no token should be able to fetch.
+	if rec := call(h, http.MethodGet, "/v1/admin/backup", token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("backup: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminCreateListDisable(t *testing.T) {
+	api, st := newTestAPI(t, Options{})
+	h := api.Handler()
+	token := adminToken(t, st)
+
+	for _, body := range []string{`{"limit":0}`, `{"limit":1,"bogus":1}`, `{`} {
+		if rec := call(h, http.MethodPost, "/v1/admin/licenses", token, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+	var created []store.License
+	for _, note := range []string{"a", "b", "c"} {
+		rec := call(h, http.MethodPost, "/v1/admin/licenses", token, `{"limit":2,"note":"`+note+`"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create: status = %d, body %s", rec.Code, rec.Body)
+		}
+		created = append(created, decode[store.License](t, rec))
+	}
+	if created[0].Key == "" || created[0].Limit != 2 {
+		t.Fatalf("created = %+v", created[0])
+	}
+
+	// Two pages of two, newest first.
+	rec := call(h, http.MethodGet, "/v1/admin/licenses?limit=2", token, "")
+	first := decode[store.LicensePage](t, rec)
+	if len(first.Items) != 2 || first.Items[0].License.ID != created[2].ID || first.Next == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+	rec = call(h, http.MethodGet, "/v1/admin/licenses?limit=2&cursor="+first.Next, token, "")
+	second := decode[store.LicensePage](t, rec)
+	if len(second.Items) != 1 || second.Items[0].License.ID != created[0].ID || second.Next != "" {
+		t.Fatalf("second page = %+v", second)
+	}
+	for _, q := range []string{"?status=bogus", "?cursor=bogus"} {
+		if rec := call(h, http.MethodGet, "/v1/admin/licenses"+q, token, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("list %s: status = %d, want 400", q, rec.Code)
+		}
+	}
+
+	rec = call(h, http.MethodPost, "/v1/admin/licenses/"+created[1].Key+"/disable", token, "")
+	if lic := decode[store.License](t, rec); rec.Code != http.StatusOK || lic.Enabled {
+		t.Fatalf("disable: status = %d, license %+v", rec.Code, lic)
+	}
+	rec = call(h, http.MethodGet, "/v1/admin/licenses?status=disabled", token, "")
+	if page := decode[store.LicensePage](t, rec); len(page.Items) != 1 || page.Items[0].License.ID != created[1].ID {
+		t.Errorf("disabled = %+v", page)
+	}
+	rec = call(h, http.MethodPost, "/v1/admin/licenses/KYPAQET-0000-0000-0000-0000/disable", token, "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("disable unknown: status = %d, want 404", rec.Code)
+	}
+
+	// Changes are attributed to the token.
+	hist, err := st.ListAudit(store.AuditFilter{Key: created[1].Key, Action: store.AuditDisable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 1 || hist[0].Actor != "token:test" {
+		t.Errorf("audit = %+v", hist)
+	}
+}
@@ -1,18 +1,59 @@
 package httpapi
 
 import (
+	"crypto/ed25519"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"kypaqet-license-bot/internal/license"
+	"kypaqet-license-bot/internal/metrics"
 	"kypaqet-license-bot/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+type Options struct {
+	// SigningKey signs activation tokens; nil disables tokens.
+	SigningKey ed25519.PrivateKey
+	// TokenTTL is the maximum token lifetime (capped by license expiry).
+	TokenTTL time.Duration
+
+	RateLimit RateLimit
+
+	// MetricsToken, if set, must be sent as a bearer token to read
+	// /metrics, which otherwise shows license and seat counts to anyone.
+	MetricsToken string
+	// NoMetrics leaves /metrics out, e.g. when it has its own listener.
+	NoMetrics bool
+
+	// Telegram, if set, receives POSTs to TelegramPath (bot webhook mode).
+	Telegram     http.Handler
+	TelegramPath string
+}
+
 type API struct {
-	st store.Store
+	st   store.Store
+	opts Options
+
+	ipLimiter  *limiter
+	keyLimiter *limiter
 }
 
-func New(st store.Store) *API {
-	return &API{st: st}
+func New(st store.Store, opts Options) *API {
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = 24 * time.Hour
+	}
+	return &API{
+		st:         st,
+		opts:       opts,
+		ipLimiter:  newLimiter(opts.RateLimit.IPPerMinute, opts.RateLimit.IPBurst),
+		keyLimiter: newLimiter(opts.RateLimit.KeyPerMinute, opts.RateLimit.KeyBurst),
+	}
 }
 
 func (a *API) Handler() http.Handler {
@@ -23,7 +64,65 @@ func (a *API) Handler() http.Handler {
 		_, _ = w.Write([]byte("ok"))
 	})
 	mux.HandleFunc("/v1/activate", a.handleActivate)
-	return mux
+	mux.HandleFunc("/v1/validate", a.handleValidate)
+	mux.HandleFunc("/v1/deactivate", a.handleDeactivate)
+	mux.HandleFunc("/v1/pubkey", a.handlePubkey)
+	if !a.opts.NoMetrics {
+		mux.Handle("/metrics", MetricsHandler(a.opts.MetricsToken))
+	}
+	a.mountAdmin(mux)
+	h := instrument(mux)
+	if a.opts.Telegram == nil {
+		return h
+	}
+	// Kept outside instrument so the secret path never becomes a metrics
+	// label; the bot counts its own updates.
+	outer := http.NewServeMux()
+	outer.Handle(a.opts.TelegramPath, a.opts.Telegram)
+	outer.Handle("/", h)
+	return outer
+}
+
+// MetricsHandler serves the Prometheus metrics, behind token if it is set.
+func MetricsHandler(token string) http.Handler {
+	h := metrics.Handler()
+	if token == "" {
+		return h
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// instrument records request latency labelled by the matched route pattern
+// (not the raw path, which would contain license keys).
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "other"
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(sw, r)
+		metrics.HTTPDuration.WithLabelValues(route, strconv.Itoa(sw.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
 }
 
 type activateReq struct {
@@ -32,29 +131,164 @@ type activateReq struct {
 }
 
 func (a *API) handleActivate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	req, res, ok := a.clientCall(w, r, store.Store.Activate, metrics.Activations)
+	if !ok {
+		return
+	}
+	if res.OK {
+		kind := "seen"
+		if res.NewlyBound {
+			kind = "new"
+		}
+		metrics.Bindings.WithLabelValues(kind).Inc()
+	}
+	a.writeClientResult(w, req, res)
+}
+
+// handleValidate is the client heartbeat: like activate, but it never binds
+// a new seat, so server ID drift cannot use up the limit.
+func (a *API) handleValidate(w http.ResponseWriter, r *http.Request) {
+	req, res, ok := a.clientCall(w, r, store.Store.Validate, metrics.Validations)
+	if !ok {
 		return
 	}
+	a.writeClientResult(w, req, res)
+}
+
+// clientCall decodes and rate limits a client request, runs call and counts
+// the result reason in reasons. When ok is false the response has already
+// been written.
+func (a *API) clientCall(w http.ResponseWriter, r *http.Request, call func(store.Store, string, string) (store.ActivateResult, error), reasons *prometheus.CounterVec) (activateReq, store.ActivateResult, bool) {
 	var req activateReq
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return req, store.ActivateResult{}, false
+	}
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 	if err := dec.Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, store.ActivateResult{OK: false, Reason: "bad_json"})
-		return
+		return req, store.ActivateResult{}, false
+	}
+	if a.rateLimited(w, r, req.License, reasons) {
+		return req, store.ActivateResult{}, false
 	}
-	res, err := a.st.Activate(req.License, req.ServerID)
+	res, err := call(a.as(r), req.License, req.ServerID)
 	if err != nil {
+		reasons.WithLabelValues("server_error").Inc()
 		writeJSON(w, http.StatusInternalServerError, store.ActivateResult{OK: false, Reason: "server_error"})
-		return
+		return req, store.ActivateResult{}, false
 	}
+	reasons.WithLabelValues(res.Reason).Inc()
+	return req, res, true
+}
+
+// writeClientResult answers 403 for failures and attaches a fresh token to
+// successful results.
+func (a *API) writeClientResult(w http.ResponseWriter, req activateReq, res store.ActivateResult) {
 	status := http.StatusOK
 	if !res.OK {
 		status = http.StatusForbidden
+	} else if a.opts.SigningKey != nil {
+		tok, err := a.signActivation(req.License, req.ServerID, res)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, store.ActivateResult{OK: false, Reason: "server_error"})
+			return
+		}
+		res.Token = tok
 	}
 	writeJSON(w, status, res)
 }
 
+// signActivation issues a token valid for TokenTTL, but never past the end
+// of the license's grace window or of a floating lease.
+func (a *API) signActivation(key, serverID string, res store.ActivateResult) (string, error) {
+	now := time.Now().UTC()
+	exp := now.Add(a.opts.TokenTTL)
+	if res.ExpiresAt != nil {
+		info, err := a.st.GetInfo(strings.TrimSpace(key))
+		if err != nil {
+			return "", err
+		}
+		if end := info.License.ExpiresAt.AddDate(0, 0, info.License.GraceDays); end.Before(exp) {
+			exp = end
+		}
+	}
+	if res.LeaseExpiresAt != nil && res.LeaseExpiresAt.Before(exp) {
+		exp = *res.LeaseExpiresAt
+	}
+	return license.SignToken(a.opts.SigningKey, license.Claims{
+		License:   strings.TrimSpace(key),
+		ServerID:  strings.TrimSpace(serverID),
+		Limit:     res.Limit,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+	})
+}
+
+func (a *API) handlePubkey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if a.opts.SigningKey == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	pub := a.opts.SigningKey.Public().(ed25519.PublicKey)
+	writeJSON(w, http.StatusOK, map[string]string{"alg": "Ed25519", "public_key": license.EncodePublicKey(pub)})
+}
+
+// handleDeactivate lets a client release its own seat (e.g. on uninstall).
+func (a *API) handleDeactivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req activateReq
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, store.ActivateResult{OK: false, Reason: "bad_json"})
+		return
+	}
+	if a.rateLimited(w, r, req.License, nil) {
+		return
+	}
+	if req.License == "" || req.ServerID == "" {
+		writeJSON(w, http.StatusBadRequest, store.ActivateResult{OK: false, Reason: "invalid_request"})
+		return
+	}
+	// The store also accepts license IDs for admin use; clients must
+	// prove they hold the key.
+	if !license.IsKey(req.License) {
+		writeJSON(w, http.StatusForbidden, store.ActivateResult{OK: false, Reason: "not_found"})
+		return
+	}
+	if err := a.as(r).Unbind(req.License, req.ServerID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSON(w, http.StatusForbidden, store.ActivateResult{OK: false, Reason: "not_found"})
+		case errors.Is(err, store.ErrNotBound):
+			writeJSON(w, http.StatusForbidden, store.ActivateResult{OK: false, Reason: "not_bound"})
+		default:
+			writeJSON(w, http.StatusInternalServerError, store.ActivateResult{OK: false, Reason: "server_error"})
+		}
+		return
+	}
+	res := store.ActivateResult{OK: true, Reason: "ok"}
+	if info, err := a.st.GetInfo(req.License); err == nil {
+		res.Used = info.Used
+		res.Limit = info.License.Limit
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// as attributes store changes made by a client request in the audit log.
+func (a *API) as(r *http.Request) store.Store {
+	return a.st.As("api:" + a.clientIP(r))
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("content-type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
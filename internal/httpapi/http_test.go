@@ -0,0 +1,217 @@
+package httpapi
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"testing"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+	"kypaqet-license-bot/internal/store"
+)
+
+func clientBody(key, serverID string) string {
+	return `{"license":"` + key + `","server_id":"` + serverID + `"}`
+}
+
+func TestValidate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, st := newTestAPI(t, Options{SigningKey: priv})
+	h := api.Handler()
+	create := func(opts store.CreateOptions) store.License {
+		t.Helper()
+		lic, err := st.CreateLicense(2, "", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lic
+	}
+
+	bound := create(store.CreateOptions{})
+	if rec := call(h, http.MethodPost, "/v1/activate", "", clientBody(bound.Key, "srv-1")); rec.Code != http.StatusOK {
+		t.Fatalf("activate: status = %d, body %s", rec.Code, rec.Body)
+	}
+	disabled := create(store.CreateOptions{})
+	if _, err := st.Activate(disabled.Key, "srv-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.SetEnabled(disabled.Key, false); err != nil {
+		t.Fatal(err)
+	}
+	expired := create(store.CreateOptions{ValidFor: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		reason string
+	}{
+		{"ok", http.MethodPost, clientBody(bound.Key, "srv-1"), http.StatusOK, "ok"},
+		{"not bound", http.MethodPost, clientBody(bound.Key, "srv-2"), http.StatusForbidden, "not_bound"},
+		{"disabled", http.MethodPost, clientBody(disabled.Key, "srv-1"), http.StatusForbidden, "disabled"},
+		{"expired", http.MethodPost, clientBody(expired.Key, "srv-1"), http.StatusForbidden, "expired"},
+		{"unknown key", http.MethodPost, clientBody("KYPAQET-0000-0000-0000-0000", "srv-1"), http.StatusForbidden, "not_found"},
+		{"license ID", http.MethodPost, clientBody(bound.ID, "srv-1"), http.StatusForbidden, "not_found"},
+		{"no server", http.MethodPost, clientBody(bound.Key, ""), http.StatusForbidden, "invalid_request"},
+		{"bad json", http.MethodPost, `{"license":1}`, http.StatusBadRequest, "bad_json"},
+		{"GET", http.MethodGet, "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := call(h, tt.method, "/v1/validate", "", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.reason == "" {
+				return
+			}
+			res := decode[store.ActivateResult](t, rec)
+			if res.Reason != tt.reason || res.OK != (tt.status == http.StatusOK) {
+				t.Fatalf("result = %+v, want reason %q", res, tt.reason)
+			}
+			if !res.OK {
+				if res.Token != "" {
+					t.Error("token issued for a refused validation")
+				}
+				return
+			}
+			claims, err := license.VerifyToken(pub, res.Token, time.Now())
+			if err != nil || claims.License != bound.Key || claims.ServerID != "srv-1" {
+				t.Errorf("token claims = %+v, %v", claims, err)
+			}
+		})
+	}
+
+	// Validate never binds a seat.
+	if info, err := st.GetInfo(bound.Key); err != nil || info.Used != 1 {
+		t.Errorf("used = %d, %v; want 1", info.Used, err)
+	}
+}
+
+func TestActivate(t *testing.T) {
+	api, st := newTestAPI(t, Options{})
+	h := api.Handler()
+	lic, err := st.CreateLicense(1, "", store.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		reason string
+		newly  bool
+	}{
+		{"first server", clientBody(lic.Key, "srv-1"), http.StatusOK, "ok", true},
+		{"same server", clientBody(" "+lic.Key+" ", "srv-1"), http.StatusOK, "ok", false},
+		{"over limit", clientBody(lic.Key, "srv-2"), http.StatusForbidden, "limit_reached", false},
+		{"unknown key", clientBody("KYPAQET-0000-0000-0000-0000", "srv-1"), http.StatusForbidden, "not_found", false},
+		{"unknown field", `{"license":"` + lic.Key + `","server_id":"srv-1","x":1}`, http.StatusBadRequest, "bad_json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := call(h, http.MethodPost, "/v1/activate", "", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+			res := decode[store.ActivateResult](t, rec)
+			if res.Reason != tt.reason || res.NewlyBound != tt.newly {
+				t.Fatalf("result = %+v, want reason %q newly bound %v", res, tt.reason, tt.newly)
+			}
+			if res.OK && res.Token != "" {
+				t.Error("token issued without a signing key")
+			}
+		})
+	}
+
+	info, err := st.GetInfo(lic.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Used != 1 || info.Bindings[0].ServerID != "srv-1" {
+		t.Errorf("bindings = %+v", info.Bindings)
+	}
+}
+
+func TestDeactivate(t *testing.T) {
+	api, st := newTestAPI(t, Options{})
+	h := api.Handler()
+	lic, err := st.CreateLicense(2, "", store.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"srv-1", "srv-2"} {
+		if _, err := st.Activate(lic.Key, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		reason string
+	}{
+		{"license ID", clientBody(lic.ID, "srv-1"), http.StatusForbidden, "not_found"},
+		{"unknown key", clientBody("KYPAQET-0000-0000-0000-0000", "srv-1"), http.StatusForbidden, "not_found"},
+		{"no server", clientBody(lic.Key, ""), http.StatusBadRequest, "invalid_request"},
+		{"bound", clientBody(lic.Key, "srv-1"), http.StatusOK, "ok"},
+		{"already released", clientBody(lic.Key, "srv-1"), http.StatusForbidden, "not_bound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := call(h, http.MethodPost, "/v1/deactivate", "", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+			res := decode[store.ActivateResult](t, rec)
+			if res.Reason != tt.reason {
+				t.Fatalf("result = %+v, want reason %q", res, tt.reason)
+			}
+			if res.OK && (res.Used != 1 || res.Limit != 2) {
+				t.Errorf("used %d of %d, want 1 of 2", res.Used, res.Limit)
+			}
+		})
+	}
+
+	info, err := st.GetInfo(lic.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Used != 1 || info.Bindings[0].ServerID != "srv-2" {
+		t.Errorf("bindings = %+v", info.Bindings)
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		token string
+		want  int
+	}{
+		{"open", Options{}, "", http.StatusOK},
+		{"no token", Options{MetricsToken: "m-secret"}, "", http.StatusUnauthorized},
+		{"wrong token", Options{MetricsToken: "m-secret"}, "m-secre", http.StatusUnauthorized},
+		{"token", Options{MetricsToken: "m-secret"}, "m-secret", http.StatusOK},
+		{"separate listener", Options{NoMetrics: true}, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, _ := newTestAPI(t, tt.opts)
+			rec := call(api.Handler(), http.MethodGet, "/metrics", tt.token, "")
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Body.Len() != 0 {
+				t.Errorf("metrics leaked: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+	"kypaqet-license-bot/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type RateLimit struct {
+	// Requests per minute and burst per client IP; zero disables.
+	IPPerMinute int
+	IPBurst     int
+	// Requests per minute and burst per license key; zero disables.
+	KeyPerMinute int
+	KeyBurst     int
+	// TrustedProxies may set X-Forwarded-For.
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies accepts a comma separated list of IPs and CIDRs.
+func ParseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", part)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			part = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// limiter is a set of token buckets keyed by an arbitrary string. It keeps
+// at most size buckets and drops the least recently used one to make room;
+// a dropped bucket comes back full.
+type limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+	size  int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List // of *tokenBucket, most recently used first
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// limiterSize caps the buckets each limiter keeps.
+const limiterSize = 10000
+
+func newLimiter(perMinute, burst int) *limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &limiter{rate: float64(perMinute) / 60, burst: float64(burst), size: limiterSize,
+		buckets: map[string]*list.Element{}, lru: list.New()}
+}
+
+// allow takes a token for key, or reports how long until one is available.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var b *tokenBucket
+	if el, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(el)
+		b = el.Value.(*tokenBucket)
+	} else {
+		if l.lru.Len() >= l.size {
+			oldest := l.lru.Back()
+			delete(l.buckets, l.lru.Remove(oldest).(*tokenBucket).key)
+		}
+		b = &tokenBucket{key: key, tokens: l.burst, last: now}
+		l.buckets[key] = l.lru.PushFront(b)
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+func (a *API) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !a.trusted(host) {
+		return host
+	}
+	// Walk X-Forwarded-For from the right, skipping our own proxies.
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !a.trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (a *API) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range a.opts.RateLimit.TrustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimited writes a 429 and returns true if the client IP or the license
+// key is over its limit, counting it in reasons if set. Keys share a bucket
+// however they are typed, as long as the store would accept them as one;
+// anything that is not shaped like a key is refused by the store anyway and
+// only counts against the IP.
+func (a *API) rateLimited(w http.ResponseWriter, r *http.Request, key string, reasons *prometheus.CounterVec) bool {
+	now := time.Now()
+	ok, wait := a.ipLimiter.allow(a.clientIP(r), now)
+	if ok && license.IsKey(key) {
+		// Hashed so a bucket costs the same however long the key sent.
+		sum := sha256.Sum256([]byte(license.NormalizeKey(key)))
+		ok, wait = a.keyLimiter.allow(string(sum[:]), now)
+	}
+	if ok {
+		return false
+	}
+	if reasons != nil {
+		reasons.WithLabelValues("rate_limited").Inc()
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeJSON(w, http.StatusTooManyRequests, store.ActivateResult{OK: false, Reason: "rate_limited"})
+	return true
+}
@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kypaqet-license-bot/internal/metrics"
+	"kypaqet-license-bot/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLimiter(t *testing.T) {
+	t0 := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		// at are request offsets from t0; want is whether each is allowed.
+		at   []time.Duration
+		want []bool
+	}{
+		{"disabled", 0, 0, []time.Duration{0, 0, 0}, []bool{true, true, true}},
+		{"burst", 60, 2, []time.Duration{0, 0, 0}, []bool{true, true, false}},
+		{"refill", 60, 1, []time.Duration{0, 500 * time.Millisecond, time.Second}, []bool{true, false, true}},
+		{"burst is capped", 60, 2, []time.Duration{0, time.Hour, time.Hour, time.Hour}, []bool{true, true, true, false}},
+		{"zero burst means one", 60, 0, []time.Duration{0, 0}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(tt.perMinute, tt.burst)
+			for i, d := range tt.at {
+				ok, wait := l.allow("k", t0.Add(d))
+				if ok != tt.want[i] {
+					t.Fatalf("request %d: allowed = %v, want %v", i, ok, tt.want[i])
+				}
+				if !ok && (wait <= 0 || wait > time.Second) {
+					t.Errorf("request %d: wait = %v", i, wait)
+				}
+			}
+		})
+	}
+
+	// Buckets are independent.
+	l := newLimiter(60, 1)
+	if ok, _ := l.allow("a", t0); !ok {
+		t.Fatal("a refused")
+	}
+	if ok, _ := l.allow("b", t0); !ok {
+		t.Fatal("b refused after a")
+	}
+
+	// At capacity the least recently used bucket makes room, full again.
+	l = newLimiter(60, 1)
+	l.size = 2
+	l.allow("a", t0)
+	l.allow("b", t0)
+	l.allow("a", t0)
+	l.allow("c", t0)
+	if len(l.buckets) != 2 || l.lru.Len() != 2 {
+		t.Fatalf("%d buckets kept, want 2", len(l.buckets))
+	}
+	if ok, _ := l.allow("b", t0); !ok {
+		t.Error("evicted bucket still empty")
+	}
+	if ok, _ := l.allow("c", t0); ok {
+		t.Error("recent bucket evicted")
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies(" 10.0.0.1, 192.168.0.0/16,,::1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range nets {
+		got = append(got, n.String())
+	}
+	if want := "10.0.0.1/32 192.168.0.0/16 ::1/128"; strings.Join(got, " ") != want {
+		t.Errorf("nets = %v, want %s", got, want)
+	}
+	for _, bad := range []string{"10.0.0", "10.0.0.0/33", "proxy"} {
+		if _, err := ParseTrustedProxies(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, _ := newTestAPI(t, Options{RateLimit: RateLimit{TrustedProxies: trusted}})
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted peer can't spoof", "203.0.113.5:1234", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"rightmost untrusted hop", "10.0.0.2:1234", []string{"1.1.1.1, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"multiple headers", "10.0.0.2:1234", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"only proxies", "10.0.0.2:1234", []string{"10.0.0.9, 10.0.0.3"}, "10.0.0.9"},
+		{"no header", "10.0.0.2:1234", nil, "10.0.0.2"},
+		{"no port", "203.0.113.5", nil, "203.0.113.5"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/activate", nil)
+		r.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := api.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	api, st := newTestAPI(t, Options{RateLimit: RateLimit{KeyPerMinute: 1, KeyBurst: 1}})
+	h := api.Handler()
+	lic, err := st.CreateLicense(5, "", store.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := func(key string) string { return `{"license":"` + key + `","server_id":"srv-1"}` }
+
+	before := testutil.ToFloat64(metrics.Validations.WithLabelValues("rate_limited"))
+	if rec := call(h, http.MethodPost, "/v1/activate", "", body(lic.Key)); rec.Code != http.StatusOK {
+		t.Fatalf("first activate: status = %d, body %s", rec.Code, rec.Body)
+	}
+	// The same key typed differently shares the bucket.
+	rec := call(h, http.MethodPost, "/v1/validate", "", body(" "+strings.ToLower(lic.Key)+" "))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second call: status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if res := decode[store.ActivateResult](t, rec); res.OK || res.Reason != "rate_limited" {
+		t.Errorf("result = %+v", res)
+	}
+	if got := testutil.ToFloat64(metrics.Validations.WithLabelValues("rate_limited")) - before; got != 1 {
+		t.Errorf("validate rate_limited counted %v times, want 1", got)
+	}
+
+	// Strings that are not keys never get a bucket of their own.
+	for _, junk := range []string{"junk", lic.ID, "junk"} {
+		if rec := call(h, http.MethodPost, "/v1/validate", "", body(junk)); rec.Code != http.StatusForbidden {
+			t.Errorf("validate %q: status = %d, want 403", junk, rec.Code)
+		}
+	}
+	if n := api.keyLimiter.lru.Len(); n != 1 {
+		t.Errorf("%d key buckets, want 1", n)
+	}
+}
@@ -1,8 +1,15 @@
 package license
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -24,5 +31,72 @@ func NewKey() (string, error) {
 		}
 		parts = append(parts, s[i:end])
 	}
-	return "KYPAQET-" + strings.Join(parts, "-"), nil
+	return keyPrefix + strings.Join(parts, "-"), nil
+}
+
+const keyPrefix = "KYPAQET-"
+
+// NormalizeKey trims and upper-cases a key as typed by a user.
+func NormalizeKey(k string) string {
+	return strings.ToUpper(strings.TrimSpace(k))
+}
+
+// IsKey reports whether s looks like a license key (as opposed to its ID).
+func IsKey(s string) bool {
+	return strings.HasPrefix(NormalizeKey(s), keyPrefix)
+}
+
+// KeyID is the lookup ID stored instead of the key: a truncated
+// HMAC-SHA256 of the normalized key under the server secret. It is short
+// enough to fit in Telegram callback data.
+func KeyID(secret []byte, key string) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(NormalizeKey(key)))
+	return hex.EncodeToString(m.Sum(nil)[:16])
+}
+
+// Fingerprint is a short display form of a key, e.g. "KYPAQET-ABCD…WXYZ",
+// enough for an admin to recognise a key without storing it.
+func Fingerprint(key string) string {
+	key = NormalizeKey(key)
+	parts := strings.Split(strings.TrimPrefix(key, keyPrefix), "-")
+	if len(parts) < 2 {
+		return key
+	}
+	return keyPrefix + parts[0] + "…" + parts[len(parts)-1]
+}
+
+// LoadOrCreateSecret reads the key-hashing secret from path, generating a
+// random one if the file does not exist. Losing it makes every stored key
+// unusable, so it should be backed up separately from the database.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	secret, err := LoadSecret(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return secret, err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(b)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadSecret reads an existing key-hashing secret. Tools working on an
+// existing database use it: a fresh secret would not match any stored key.
+func LoadSecret(path string) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(secret) < 16 {
+		return nil, fmt.Errorf("%s: expected at least 16 hex-encoded bytes", path)
+	}
+	return secret, nil
 }
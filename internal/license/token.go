@@ -0,0 +1,129 @@
+package license
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid activation token")
+	ErrTokenExpired = errors.New("activation token expired")
+)
+
+// Claims is the payload of an activation token. Times are unix seconds to
+// keep the token compact.
+type Claims struct {
+	License   string `json:"lic"`
+	ServerID  string `json:"sid"`
+	Limit     int    `json:"lim"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var tokenEnc = base64.RawURLEncoding
+
+// SignToken returns "<payload>.<signature>", both base64url without padding.
+func SignToken(priv ed25519.PrivateKey, c Claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	p := tokenEnc.EncodeToString(payload)
+	sig := ed25519.Sign(priv, []byte(p))
+	return p + "." + tokenEnc.EncodeToString(sig), nil
+}
+
+// VerifyToken checks the signature and expiry of a token produced by
+// SignToken. Clients use it to keep working offline until the token expires.
+func VerifyToken(pub ed25519.PublicKey, token string, now time.Time) (Claims, error) {
+	p, s, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || len(pub) != ed25519.PublicKeySize {
+		return Claims{}, ErrTokenInvalid
+	}
+	sig, err := tokenEnc.DecodeString(s)
+	if err != nil || !ed25519.Verify(pub, []byte(p), sig) {
+		return Claims{}, ErrTokenInvalid
+	}
+	payload, err := tokenEnc.DecodeString(p)
+	if err != nil {
+		return Claims{}, ErrTokenInvalid
+	}
+	var c Claims
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Claims{}, ErrTokenInvalid
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return c, ErrTokenExpired
+	}
+	return c, nil
+}
+
+// EncodePublicKey / ParsePublicKey use standard base64 of the raw key, the
+// format served at /v1/pubkey.
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// LoadOrCreateSigningKey reads a PKCS#8 PEM Ed25519 key from path, generating
+// and saving a new one if the file does not exist.
+func LoadOrCreateSigningKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		buf := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, buf, 0o600); err != nil {
+			return nil, err
+		}
+		return priv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return priv, nil
+}
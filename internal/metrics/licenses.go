@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"kypaqet-license-bot/internal/store"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	licensesDesc = prometheus.NewDesc(namespace+"_licenses", "Licenses by state.", []string{"state"}, nil)
+	seatsDesc    = prometheus.NewDesc(namespace+"_seats_used", "Bound servers across all licenses.", nil, nil)
+	limitDesc    = prometheus.NewDesc(namespace+"_seats_limit", "Sum of limits across enabled licenses.", nil, nil)
+)
+
+// licenseCollector reads license totals from the store at scrape time.
+type licenseCollector struct {
+	st store.Store
+}
+
+func NewLicenseCollector(st store.Store) prometheus.Collector {
+	return &licenseCollector{st: st}
+}
+
+func (c *licenseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- licensesDesc
+	ch <- seatsDesc
+	ch <- limitDesc
+}
+
+func (c *licenseCollector) Collect(ch chan<- prometheus.Metric) {
+	list, err := c.st.ListLicenses()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(licensesDesc, err)
+		return
+	}
+	enabled, used, limit := 0, 0, 0
+	for _, it := range list {
+		used += it.Used
+		if it.License.Enabled {
+			enabled++
+			limit += it.License.Limit
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(licensesDesc, prometheus.GaugeValue, float64(len(list)), "total")
+	ch <- prometheus.MustNewConstMetric(licensesDesc, prometheus.GaugeValue, float64(enabled), "enabled")
+	ch <- prometheus.MustNewConstMetric(seatsDesc, prometheus.GaugeValue, float64(used))
+	ch <- prometheus.MustNewConstMetric(limitDesc, prometheus.GaugeValue, float64(limit))
+}
@@ -0,0 +1,78 @@
+// Package metrics holds the Prometheus collectors exposed at /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "licensebot"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	Activations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "activations_total",
+		Help:      "Activation requests by result reason.",
+	}, []string{"reason"})
+
+	Validations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validations_total",
+		Help:      "Heartbeat (validate) requests by result reason.",
+	}, []string{"reason"})
+
+	Bindings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "activation_bindings_total",
+		Help:      "Successful activations split into newly bound and already bound servers.",
+	}, []string{"kind"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "code"})
+
+	TxDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_tx_duration_seconds",
+		Help:      "bbolt transaction duration by store operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"op"})
+
+	TelegramUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_updates_total",
+		Help:      "Telegram updates handled by kind.",
+	}, []string{"kind"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Activations, Validations, Bindings, HTTPDuration, TxDuration, TelegramUpdates,
+	)
+}
+
+// Register adds extra collectors (e.g. the license gauges) to the registry.
+func Register(cs ...prometheus.Collector) {
+	registry.MustRegister(cs...)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveTx records the duration of a store transaction; it matches
+// store.Options.ObserveTx.
+func ObserveTx(op string, d time.Duration) {
+	TxDuration.WithLabelValues(op).Observe(d.Seconds())
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func adminKey(chatID int64) []byte {
+	return []byte(strconv.FormatInt(chatID, 10))
+}
+
+func (s *BBoltStore) GetAdmin(chatID int64) (Admin, error) {
+	var a Admin
+	if err := s.view("GetAdmin", func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(bucketAdmins)).Get(adminKey(chatID))
+		if v == nil {
+			return ErrAdminNotFound
+		}
+		return json.Unmarshal(v, &a)
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
+
+func (s *BBoltStore) ListAdmins() ([]Admin, error) {
+	var out []Admin
+	if err := s.view("ListAdmins", func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketAdmins)).ForEach(func(_, v []byte) error {
+			var a Admin
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			out = append(out, a)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if RoleLevel(out[i].Role) != RoleLevel(out[j].Role) {
+			return RoleLevel(out[i].Role) > RoleLevel(out[j].Role)
+		}
+		return out[i].AddedAt.Before(out[j].AddedAt)
+	})
+	return out, nil
+}
+
+func (s *BBoltStore) PutAdmin(a Admin) (Admin, error) {
+	if RoleLevel(a.Role) == 0 {
+		return Admin{}, fmt.Errorf("unknown role %q", a.Role)
+	}
+	if a.ChatID == 0 {
+		return Admin{}, fmt.Errorf("chat id is required")
+	}
+	a.Name = strings.TrimSpace(a.Name)
+	if err := s.update("PutAdmin", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketAdmins))
+		if v := b.Get(adminKey(a.ChatID)); v != nil {
+			var old Admin
+			if err := json.Unmarshal(v, &old); err != nil {
+				return err
+			}
+			if old.Role == a.Role && (a.Name == "" || old.Name == a.Name) {
+				a = old
+				return nil
+			}
+			a.AddedAt = old.AddedAt
+			a.Muted = old.Muted
+			if a.Name == "" {
+				a.Name = old.Name
+			}
+		}
+		if a.AddedAt.IsZero() {
+			a.AddedAt = time.Now().UTC()
+		}
+		buf, _ := json.Marshal(a)
+		if err := b.Put(adminKey(a.ChatID), buf); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("set %d role=%s", a.ChatID, a.Role)})
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
+
+func (s *BBoltStore) RemoveAdmin(chatID int64) error {
+	return s.update("RemoveAdmin", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketAdmins))
+		if b.Get(adminKey(chatID)) == nil {
+			return ErrAdminNotFound
+		}
+		if err := b.Delete(adminKey(chatID)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("removed %d", chatID)})
+	})
+}
+
+func (s *BBoltStore) SetAdminMuted(chatID int64, muted []string) (Admin, error) {
+	var a Admin
+	if err := s.update("SetAdminMuted", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketAdmins))
+		v := b.Get(adminKey(chatID))
+		if v == nil {
+			return ErrAdminNotFound
+		}
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+		a.Muted = muted
+		buf, _ := json.Marshal(a)
+		return b.Put(adminKey(chatID), buf)
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
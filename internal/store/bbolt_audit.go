@@ -0,0 +1,65 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// audit appends ev to the audit bucket inside the caller's transaction so the
+// record commits (or rolls back) together with the change it describes.
+// Keys are the event time in nanoseconds followed by a sequence number, which
+// keeps the bucket in chronological order.
+func (s *BBoltStore) audit(tx *bbolt.Tx, ev AuditEvent) error {
+	b := tx.Bucket([]byte(bucketAudit))
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	if ev.Actor == "" {
+		ev.Actor = s.actor
+	}
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k[:8], uint64(ev.At.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	buf, _ := json.Marshal(ev)
+	return b.Put(k, buf)
+}
+
+func (s *BBoltStore) ListAudit(filter AuditFilter) ([]AuditEvent, error) {
+	if filter.Key != "" {
+		filter.Key = s.opts.ref(filter.Key)
+	}
+	var out []AuditEvent
+	if err := s.view("ListAudit", func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucketAudit)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if !filter.Since.IsZero() && len(k) >= 8 && int64(binary.BigEndian.Uint64(k[:8])) < filter.Since.UnixNano() {
+				break
+			}
+			var ev AuditEvent
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return err
+			}
+			if filter.Key != "" && ev.Key != filter.Key {
+				continue
+			}
+			if filter.Action != "" && ev.Action != filter.Action {
+				continue
+			}
+			out = append(out, ev)
+			if filter.Limit > 0 && len(out) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
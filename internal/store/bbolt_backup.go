@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func (s *BBoltStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.view("Backup", func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// BackupBBolt snapshots a database file that is not open by the service.
+func BackupBBolt(path string, w io.Writer) (int64, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var n int64
+	err = db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// RestoreBBolt replaces the database at path with the snapshot at src. The
+// snapshot is checked first and the current file is kept next to it with a
+// ".before-restore" suffix. It fails if the database is in use.
+func RestoreBBolt(path, src string) error {
+	snap, err := bbolt.Open(src, 0o600, &bbolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	var version int
+	err = snap.View(func(tx *bbolt.Tx) error {
+		version = schemaVersion(tx)
+		if tx.Bucket([]byte(bucketLicenses)) == nil {
+			return fmt.Errorf("snapshot has no %s bucket", bucketLicenses)
+		}
+		return nil
+	})
+	_ = snap.Close()
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w (snapshot %d, binary %d)", ErrSchemaTooNew, version, SchemaVersion)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		// Taking the lock proves the service is not running.
+		cur, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+		if err != nil {
+			return fmt.Errorf("database in use, stop the service first: %w", err)
+		}
+		_ = cur.Close()
+		if err := os.Rename(path, path+".before-restore"); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return copyFile(src, path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
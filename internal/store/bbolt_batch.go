@@ -0,0 +1,129 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func (s *BBoltStore) CreateLicenses(n, limit int, note string, opts CreateOptions) ([]License, error) {
+	if n <= 0 || n > MaxBatchSize {
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxBatchSize)
+	}
+	batchID, err := newBatchID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	lics := make([]License, n)
+	for i := range lics {
+		lic, err := s.opts.newLicense(limit, note, opts, now)
+		if err != nil {
+			return nil, err
+		}
+		lic.BatchID = batchID
+		lics[i] = lic
+	}
+	if err := s.update("CreateLicenses", func(tx *bbolt.Tx) error {
+		for _, lic := range lics {
+			if err := s.insertLicense(tx, lic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return lics, nil
+}
+
+func (s *BBoltStore) ListBatches() ([]Batch, error) {
+	byID := map[string]*Batch{}
+	if err := s.view("ListBatches", func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			if lic.BatchID == "" {
+				return nil
+			}
+			b := byID[lic.BatchID]
+			if b == nil {
+				b = &Batch{ID: lic.BatchID, Note: lic.Note, Limit: lic.Limit, CreatedAt: lic.CreatedAt}
+				byID[lic.BatchID] = b
+			}
+			b.Size++
+			if lic.Enabled {
+				b.Enabled++
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	out := make([]Batch, 0, len(byID))
+	for _, b := range byID {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *BBoltStore) SetBatchEnabled(batchID string, enabled bool) (int, error) {
+	batchID = strings.ToLower(strings.TrimSpace(batchID))
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	changed := 0
+	if err := s.update("SetBatchEnabled", func(tx *bbolt.Tx) error {
+		var members []License
+		if err := tx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			if lic.BatchID == batchID {
+				members = append(members, lic)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			return ErrBatchNotFound
+		}
+		for _, lic := range members {
+			if lic.Enabled == enabled {
+				continue
+			}
+			lic.Enabled = enabled
+			if err := putLicense(tx, lic); err != nil {
+				return err
+			}
+			if err := s.audit(tx, AuditEvent{Action: action, Key: lic.ID, Detail: "batch " + batchID}); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+func newBatchID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
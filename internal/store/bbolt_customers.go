@@ -0,0 +1,151 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func (s *BBoltStore) CreateCustomer(c Customer) (Customer, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Username = strings.TrimPrefix(strings.TrimSpace(c.Username), "@")
+	c.Contact = strings.TrimSpace(c.Contact)
+	c.Notes = strings.TrimSpace(c.Notes)
+	if c.Name == "" {
+		return Customer{}, fmt.Errorf("name is required")
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Customer{}, err
+	}
+	c.ID = hex.EncodeToString(id)
+	c.CreatedAt = time.Now().UTC()
+	buf, _ := json.Marshal(c)
+	if err := s.update("CreateCustomer", func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(bucketCustomers)).Put([]byte(c.ID), buf); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditCustomer, Detail: fmt.Sprintf("created %s %q", c.ID, c.Name)})
+	}); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *BBoltStore) GetCustomer(id string) (Customer, error) {
+	var c Customer
+	if err := s.view("GetCustomer", func(tx *bbolt.Tx) error {
+		var err error
+		c, err = getCustomer(tx, id)
+		return err
+	}); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func getCustomer(tx *bbolt.Tx, id string) (Customer, error) {
+	v := tx.Bucket([]byte(bucketCustomers)).Get([]byte(strings.ToLower(strings.TrimSpace(id))))
+	if v == nil {
+		return Customer{}, ErrCustomerNotFound
+	}
+	var c Customer
+	if err := json.Unmarshal(v, &c); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *BBoltStore) ListCustomers() ([]Customer, error) {
+	var out []Customer
+	if err := s.view("ListCustomers", func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketCustomers)).ForEach(func(_, v []byte) error {
+			var c Customer
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			out = append(out, c)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+	return out, nil
+}
+
+func (s *BBoltStore) SetLicenseCustomer(key string, customerID string) (License, error) {
+	id := s.opts.ref(key)
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	var updated License
+	if err := s.update("SetLicenseCustomer", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		detail := "unlinked"
+		if customerID != "" {
+			c, err := getCustomer(tx, customerID)
+			if err != nil {
+				return err
+			}
+			detail = fmt.Sprintf("linked to %s %q", c.ID, c.Name)
+		}
+		lic.CustomerID = customerID
+		updated = lic
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditCustomer, Key: id, Detail: detail})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *BBoltStore) SetCustomerEnabled(customerID string, enabled bool) (int, error) {
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	changed := 0
+	if err := s.update("SetCustomerEnabled", func(tx *bbolt.Tx) error {
+		if _, err := getCustomer(tx, customerID); err != nil {
+			return err
+		}
+		var members []License
+		if err := tx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			if lic.CustomerID == customerID && lic.Enabled != enabled {
+				members = append(members, lic)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, lic := range members {
+			lic.Enabled = enabled
+			if err := putLicense(tx, lic); err != nil {
+				return err
+			}
+			if err := s.audit(tx, AuditEvent{Action: action, Key: lic.ID, Detail: "customer " + customerID}); err != nil {
+				return err
+			}
+		}
+		changed = len(members)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.etcd.io/bbolt"
+)
+
+func (s *BBoltStore) Export(w io.Writer, opts ExportOptions) (int, error) {
+	rw, err := newRecordWriter(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	if err := s.view("Export", func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketLicenses)).ForEach(func(k, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			if opts.BatchID != "" && lic.BatchID != opts.BatchID {
+				return nil
+			}
+			bindings, err := getBindings(tx, string(k))
+			if err != nil {
+				return err
+			}
+			n++
+			return rw.Write(LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings})
+		})
+	}); err != nil {
+		return 0, err
+	}
+	if n == 0 && opts.BatchID != "" {
+		return 0, ErrBatchNotFound
+	}
+	return n, rw.Flush()
+}
+
+func (s *BBoltStore) Import(r io.Reader, opts ImportOptions) (ImportResult, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictFail
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return ImportResult{}, fmt.Errorf("unknown conflict policy %q", opts.OnConflict)
+	}
+	next, err := newRecordReader(r, opts.Format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var res ImportResult
+	err = s.update("Import", func(tx *bbolt.Tx) error {
+		usageRoot := tx.Bucket([]byte(bucketUsage))
+		for {
+			info, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			lic, bindings, err := importRecord(s.opts.KeySecret, info)
+			if err != nil {
+				return err
+			}
+			action := "created"
+			if old, err := getLicense(tx, lic.ID); err == nil {
+				switch opts.OnConflict {
+				case ConflictSkip:
+					res.Skipped++
+					continue
+				case ConflictFail:
+					return fmt.Errorf("%s: %w", lic.ID, ErrConflict)
+				}
+				action = "overwritten"
+				if err := tx.Bucket([]byte(bucketCreated)).Delete(createdKey(old)); err != nil {
+					return err
+				}
+			}
+			if lic.CustomerID != "" {
+				if _, err := getCustomer(tx, lic.CustomerID); err != nil {
+					return fmt.Errorf("%s: %w", lic.ID, err)
+				}
+			}
+			if usageRoot.Bucket([]byte(lic.ID)) != nil {
+				if err := usageRoot.DeleteBucket([]byte(lic.ID)); err != nil {
+					return err
+				}
+			}
+			usage, err := usageRoot.CreateBucket([]byte(lic.ID))
+			if err != nil {
+				return err
+			}
+			for _, b := range bindings {
+				buf, _ := json.Marshal(b)
+				if err := usage.Put([]byte(b.ServerID), buf); err != nil {
+					return err
+				}
+			}
+			if err := putLicense(tx, lic); err != nil {
+				return err
+			}
+			if err := indexLicense(tx, lic); err != nil {
+				return err
+			}
+			if action == "created" {
+				res.Created++
+			} else {
+				res.Overwritten++
+			}
+			if err := s.audit(tx, AuditEvent{Action: AuditImport, Key: lic.ID, Detail: fmt.Sprintf("%s, %d bindings", action, len(bindings))}); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+
+	"go.etcd.io/bbolt"
+)
+
+const (
+	bucketMeta        = "meta"
+	metaSchemaVersion = "schema_version"
+)
+
+var (
+	// ErrSchemaTooNew means the database was written by a newer binary.
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+	errDryRun = errors.New("dry run")
+)
+
+// migration upgrades the database by one schema version. Migrations run in
+// order inside a single transaction at open, so a failure leaves the file
+// untouched. Only ever append to this list.
+type migration struct {
+	name string
+	up   func(tx *bbolt.Tx, opts Options) error
+}
+
+var migrations = []migration{
+	{"create core buckets", func(tx *bbolt.Tx, _ Options) error {
+		return createBuckets(tx, bucketLicenses, bucketUsage, bucketReaped, bucketAudit, bucketTokens, bucketAdmins)
+	}},
+	{"hash stored license keys", func(tx *bbolt.Tx, opts Options) error {
+		return hashStoredKeys(tx, opts.KeySecret)
+	}},
+	{"create webhook buckets", func(tx *bbolt.Tx, _ Options) error {
+		return createBuckets(tx, bucketWebhooks, bucketOutbox)
+	}},
+	{"index licenses by creation time", func(tx *bbolt.Tx, _ Options) error {
+		if err := createBuckets(tx, bucketCreated); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			return indexLicense(tx, lic)
+		})
+	}},
+	{"create customers bucket", func(tx *bbolt.Tx, _ Options) error {
+		return createBuckets(tx, bucketCustomers)
+	}},
+}
+
+// SchemaVersion is the schema this binary writes.
+var SchemaVersion = len(migrations)
+
+// keysHashedVersion is the first schema without raw license keys.
+const keysHashedVersion = 2
+
+// needsCompact reports whether a migration run from version from hashed the
+// stored keys. bbolt reuses freed pages without zeroing them, so the raw
+// keys stay in the file until it is rewritten.
+func needsCompact(from int, applied []string) bool {
+	return len(applied) > 0 && from < keysHashedVersion
+}
+
+// compactBBolt rewrites the closed database at path into a fresh file with
+// only live data and replaces path with it.
+func compactBBolt(path string) error {
+	src, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".compact"
+	_ = os.Remove(tmp)
+	dst, err := bbolt.Open(tmp, 0o600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, src, 64<<20); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("compact: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func createBuckets(tx *bbolt.Tx, names ...string) error {
+	for _, name := range names {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaVersion(tx *bbolt.Tx) int {
+	meta := tx.Bucket([]byte(bucketMeta))
+	if meta == nil {
+		return 0
+	}
+	v := meta.Get([]byte(metaSchemaVersion))
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+// migrate brings tx up to SchemaVersion and returns the starting version and
+// the names of the migrations applied.
+func migrate(tx *bbolt.Tx, opts Options) (int, []string, error) {
+	from := schemaVersion(tx)
+	if from > SchemaVersion {
+		return from, nil, fmt.Errorf("%w (db %d, binary %d)", ErrSchemaTooNew, from, SchemaVersion)
+	}
+	meta, err := tx.CreateBucketIfNotExists([]byte(bucketMeta))
+	if err != nil {
+		return from, nil, err
+	}
+	var applied []string
+	for v := from; v < SchemaVersion; v++ {
+		m := migrations[v]
+		if err := m.up(tx, opts); err != nil {
+			return from, applied, fmt.Errorf("migration %d (%s): %w", v+1, m.name, err)
+		}
+		applied = append(applied, fmt.Sprintf("%d: %s", v+1, m.name))
+	}
+	if len(applied) > 0 {
+		if err := meta.Put([]byte(metaSchemaVersion), seqKey(uint64(SchemaVersion))); err != nil {
+			return from, applied, err
+		}
+	}
+	return from, applied, nil
+}
+
+type MigrateResult struct {
+	From    int
+	To      int
+	Applied []string
+}
+
+// MigrateBBolt runs pending migrations on the database at path. With dryRun
+// the transaction is rolled back, reporting what would have been applied.
+func MigrateBBolt(path string, opts Options, dryRun bool) (MigrateResult, error) {
+	if len(opts.KeySecret) == 0 {
+		return MigrateResult{}, fmt.Errorf("key secret is required")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return MigrateResult{}, err
+	}
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	defer db.Close()
+	res := MigrateResult{To: SchemaVersion}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		from, applied, err := migrate(tx, opts)
+		res.From, res.Applied = from, applied
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+	if err := db.Close(); err != nil {
+		return res, err
+	}
+	if needsCompact(res.From, res.Applied) {
+		return res, compactBBolt(path)
+	}
+	return res, nil
+}
+
+// RawKeysBBolt counts the licenses in the database at path that are still
+// stored under their raw key, i.e. that a migration would hash.
+func RawKeysBBolt(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	n := 0
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			if license.IsKey(string(k)) {
+				n++
+			}
+			return nil
+		})
+	})
+	return n, err
+}
+
+// hashStoredKeys converts databases that still index licenses by the raw key:
+// each license, its usage and reaped buckets and its audit events are moved
+// to the key's ID and the key itself is dropped.
+func hashStoredKeys(tx *bbolt.Tx, secret []byte) error {
+	licenses := tx.Bucket([]byte(bucketLicenses))
+	var raw []string
+	if err := licenses.ForEach(func(k, _ []byte) error {
+		if license.IsKey(string(k)) {
+			raw = append(raw, string(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	ids := make(map[string]string, len(raw))
+	for _, key := range raw {
+		var lic License
+		if err := json.Unmarshal(licenses.Get([]byte(key)), &lic); err != nil {
+			return err
+		}
+		id := license.KeyID(secret, key)
+		ids[key] = id
+		lic.ID = id
+		lic.Fingerprint = license.Fingerprint(key)
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		if err := licenses.Delete([]byte(key)); err != nil {
+			return err
+		}
+		for _, name := range []string{bucketUsage, bucketReaped} {
+			if err := renameNested(tx.Bucket([]byte(name)), key, id); err != nil {
+				return err
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	// Collect first: bbolt cursors are not stable across writes.
+	audit := tx.Bucket([]byte(bucketAudit))
+	rewrites := map[string][]byte{}
+	if err := audit.ForEach(func(k, v []byte) error {
+		var ev AuditEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return err
+		}
+		if id, ok := ids[ev.Key]; ok {
+			ev.Key = id
+			rewrites[string(k)], _ = json.Marshal(ev)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for k, v := range rewrites {
+		if err := audit.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameNested moves the nested bucket from to to within parent.
+func renameNested(parent *bbolt.Bucket, from, to string) error {
+	src := parent.Bucket([]byte(from))
+	if src == nil {
+		return nil
+	}
+	dst, err := parent.CreateBucketIfNotExists([]byte(to))
+	if err != nil {
+		return err
+	}
+	if err := src.ForEach(func(k, v []byte) error {
+		return dst.Put(k, v)
+	}); err != nil {
+		return err
+	}
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return parent.DeleteBucket([]byte(from))
+}
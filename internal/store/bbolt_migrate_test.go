@@ -0,0 +1,123 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// writeLegacy creates a schema 0 database that stores licenses, usage and
+// audit events under the raw key.
+func writeLegacy(t *testing.T, path, key string) {
+	t.Helper()
+	db, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if err := createBuckets(tx, bucketLicenses, bucketUsage, bucketReaped, bucketAudit); err != nil {
+			return err
+		}
+		lic, _ := json.Marshal(map[string]any{"key": key, "limit": 2, "enabled": true, "created_at": time.Now().UTC()})
+		if err := tx.Bucket([]byte(bucketLicenses)).Put([]byte(key), lic); err != nil {
+			return err
+		}
+		usage, err := tx.Bucket([]byte(bucketUsage)).CreateBucket([]byte(key))
+		if err != nil {
+			return err
+		}
+		sb, _ := json.Marshal(ServerBinding{ServerID: "srv-1", FirstSeen: time.Now().UTC(), LastSeen: time.Now().UTC(), SeenCount: 1})
+		if err := usage.Put([]byte("srv-1"), sb); err != nil {
+			return err
+		}
+		ev, _ := json.Marshal(AuditEvent{At: time.Now().UTC(), Actor: "system", Action: AuditCreate, Key: key})
+		return tx.Bucket([]byte(bucketAudit)).Put(seqKey(1), ev)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDropsRawKeys(t *testing.T) {
+	const key = "KYPAQET-ABCD-EFGH-JKLM-NPQR"
+	opts := Options{KeySecret: []byte("0123456789abcdef")}
+	for name, migrate := range map[string]func(path string) error{
+		"open": func(path string) error {
+			st, err := OpenBBolt(path, opts)
+			if err != nil {
+				return err
+			}
+			return st.Close()
+		},
+		"migrate": func(path string) error {
+			_, err := MigrateBBolt(path, opts, false)
+			return err
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "legacy.db")
+			writeLegacy(t, path, key)
+			if err := migrate(path); err != nil {
+				t.Fatal(err)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(raw, []byte(key)) {
+				t.Error("raw key still in the database file")
+			}
+			if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+
+			st, err := OpenBBolt(path, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.Close()
+			info, err := st.GetInfo(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Used != 1 || info.License.Limit != 2 {
+				t.Errorf("info = %+v", info)
+			}
+			hist, err := st.ListAudit(AuditFilter{Key: key})
+			if err != nil || len(hist) != 1 {
+				t.Errorf("audit = %+v, %v", hist, err)
+			}
+		})
+	}
+}
+
+func TestRawKeysBBolt(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "legacy.db")
+	writeLegacy(t, legacy, "KYPAQET-ABCD-EFGH-JKLM-NPQR")
+	if n, err := RawKeysBBolt(legacy); err != nil || n != 1 {
+		t.Errorf("legacy: %d, %v; want 1", n, err)
+	}
+
+	current := filepath.Join(dir, "current.db")
+	st, err := OpenBBolt(current, Options{KeySecret: []byte("0123456789abcdef")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.CreateLicense(1, "", CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	if n, err := RawKeysBBolt(current); err != nil || n != 0 {
+		t.Errorf("current: %d, %v; want 0", n, err)
+	}
+	if _, err := RawKeysBBolt(filepath.Join(dir, "missing.db")); !os.IsNotExist(err) {
+		t.Errorf("missing: err = %v", err)
+	}
+}
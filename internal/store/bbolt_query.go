@@ -0,0 +1,210 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+
+	"go.etcd.io/bbolt"
+)
+
+// Cursor prefixes: pages older ("a", after in list order) or newer ("b",
+// before) than the license ID that follows.
+const (
+	cursorAfter  = "a:"
+	cursorBefore = "b:"
+)
+
+// createdKey is the index key of lic: creation time (so newest sorts last)
+// followed by the ID.
+func createdKey(lic License) []byte {
+	k := make([]byte, 8, 8+len(lic.ID))
+	binary.BigEndian.PutUint64(k, uint64(lic.CreatedAt.UnixNano()))
+	return append(k, lic.ID...)
+}
+
+func indexLicense(tx *bbolt.Tx, lic License) error {
+	return tx.Bucket([]byte(bucketCreated)).Put(createdKey(lic), []byte{})
+}
+
+func (s *BBoltStore) QueryLicenses(filter LicenseFilter, cursor string, limit int) (LicensePage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	now := time.Now().UTC()
+	match, err := newMatcher(filter, s.opts.ref)
+	if err != nil {
+		return LicensePage{}, err
+	}
+	from, backward, err := parseCursor(cursor)
+	if err != nil {
+		return LicensePage{}, err
+	}
+	var page LicensePage
+	err = s.view("QueryLicenses", func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucketCreated)).Cursor()
+		step := c.Prev
+		if backward {
+			step = c.Next
+		}
+		var k []byte
+		if from == "" {
+			k, _ = c.Last()
+		} else {
+			lic, err := getLicense(tx, from)
+			if err != nil {
+				return err
+			}
+			ck := createdKey(lic)
+			if k, _ = c.Seek(ck); k != nil && string(k) == string(ck) {
+				k, _ = step()
+			} else if !backward {
+				// Seek lands on the next newer key; step back past it.
+				if k == nil {
+					k, _ = c.Last()
+				} else {
+					k, _ = c.Prev()
+				}
+			}
+		}
+
+		var items []LicenseInfo
+		for ; k != nil && len(items) <= limit; k, _ = step() {
+			id := string(k[8:])
+			lic, err := getLicense(tx, id)
+			if err != nil {
+				return err
+			}
+			bindings, err := getBindings(tx, id)
+			if err != nil {
+				return err
+			}
+			bindings = s.opts.live(lic, bindings, now)
+			info := LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings}
+			if match(info) {
+				info.Bindings = nil
+				items = append(items, info)
+			}
+		}
+		page = newPage(items, limit, cursor, backward)
+		return nil
+	})
+	if err != nil {
+		return LicensePage{}, err
+	}
+	return page, nil
+}
+
+// parseCursor splits a QueryLicenses cursor into the license ID it starts
+// after and the direction; "" starts at the newest license.
+func parseCursor(cursor string) (id string, backward bool, err error) {
+	switch {
+	case cursor == "":
+		return "", false, nil
+	case strings.HasPrefix(cursor, cursorAfter):
+		return cursor[len(cursorAfter):], false, nil
+	case strings.HasPrefix(cursor, cursorBefore):
+		return cursor[len(cursorBefore):], true, nil
+	}
+	return "", false, fmt.Errorf("%w: cursor %q", ErrInvalidQuery, cursor)
+}
+
+// newPage builds a page from up to limit+1 matches in scan order; an extra
+// match means there is more in that direction.
+func newPage(items []LicenseInfo, limit int, cursor string, backward bool) LicensePage {
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	page := LicensePage{Items: items}
+	if len(items) == 0 {
+		return page
+	}
+	first, last := items[0].License.ID, items[len(items)-1].License.ID
+	// The direction we came from always has more; the other one only
+	// if the scan found an extra match.
+	if backward {
+		page.Next = cursorAfter + last
+		if more {
+			page.Prev = cursorBefore + first
+		}
+	} else {
+		if more {
+			page.Next = cursorAfter + last
+		}
+		if cursor != "" {
+			page.Prev = cursorBefore + first
+		}
+	}
+	return page
+}
+
+// newMatcher compiles f; ref resolves a full license key in the search to
+// its ID.
+func newMatcher(f LicenseFilter, ref func(string) string) (func(LicenseInfo) bool, error) {
+	switch f.Status {
+	case "", FilterEnabled, FilterDisabled, FilterFull, FilterUnused:
+	default:
+		return nil, fmt.Errorf("%w: unknown filter %q", ErrInvalidQuery, f.Status)
+	}
+	search := strings.ToLower(strings.TrimSpace(f.Search))
+	var keyID string
+	if license.IsKey(search) {
+		keyID = ref(search)
+	}
+	return func(info LicenseInfo) bool {
+		lic := info.License
+		switch f.Status {
+		case FilterEnabled:
+			if !lic.Enabled {
+				return false
+			}
+		case FilterDisabled:
+			if lic.Enabled {
+				return false
+			}
+		case FilterFull:
+			if info.Used < lic.Limit {
+				return false
+			}
+		case FilterUnused:
+			if info.Used > 0 {
+				return false
+			}
+		}
+		if f.CustomerID != "" && lic.CustomerID != f.CustomerID {
+			return false
+		}
+		if !f.IdleSince.IsZero() && !lastSeen(info.Bindings).Before(f.IdleSince) {
+			return false
+		}
+		switch {
+		case keyID != "":
+			return lic.ID == keyID
+		case search != "":
+			return strings.Contains(strings.ToLower(lic.Note), search) ||
+				strings.Contains(strings.ToLower(lic.Fingerprint), search) ||
+				strings.Contains(lic.ID, search) ||
+				strings.Contains(lic.BatchID, search)
+		}
+		return true
+	}, nil
+}
+
+func lastSeen(bindings []ServerBinding) time.Time {
+	var t time.Time
+	for _, b := range bindings {
+		if b.LastSeen.After(t) {
+			t = b.LastSeen
+		}
+	}
+	return t
+}
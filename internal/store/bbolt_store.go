@@ -1,6 +1,7 @@
 package store
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,25 +11,52 @@ import (
 	"strings"
 	"time"
 
+	"kypaqet-license-bot/internal/events"
 	"kypaqet-license-bot/internal/license"
 
 	"go.etcd.io/bbolt"
 )
 
 var (
-	errNotFound = errors.New("license not found")
+	ErrNotFound = errors.New("license not found")
+	ErrNotBound = errors.New("server not bound to license")
+
+	ErrUnauthorized  = errors.New("invalid api token")
+	ErrAdminNotFound = errors.New("admin not found")
+
+	ErrConflict      = errors.New("license already exists")
+	ErrBatchNotFound = errors.New("batch not found")
+	// ErrInvalidQuery wraps unknown QueryLicenses filters and bad cursors.
+	ErrInvalidQuery = errors.New("invalid query")
+
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrCustomerNotFound = errors.New("customer not found")
 )
 
 const (
 	bucketLicenses = "licenses"
 	bucketUsage    = "usage"
+	bucketReaped   = "reaped"
+	bucketAudit    = "audit"
+	bucketTokens   = "api_tokens"
+	bucketAdmins   = "admins"
+	bucketWebhooks = "webhooks"
+	bucketOutbox   = "outbox"
+	// bucketCreated indexes license IDs by creation time for paging.
+	bucketCreated   = "licenses_by_created"
+	bucketCustomers = "customers"
 )
 
 type BBoltStore struct {
-	db *bbolt.DB
+	db    *bbolt.DB
+	opts  Options
+	actor string
 }
 
-func OpenBBolt(path string) (*BBoltStore, error) {
+func OpenBBolt(path string, opts Options) (*BBoltStore, error) {
+	if len(opts.KeySecret) == 0 {
+		return nil, fmt.Errorf("key secret is required")
+	}
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, err
 	}
@@ -36,65 +64,110 @@ func OpenBBolt(path string) (*BBoltStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	st := &BBoltStore{db: db}
-	if err := st.db.Update(func(tx *bbolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists([]byte(bucketLicenses)); err != nil {
-			return err
-		}
-		if _, err := tx.CreateBucketIfNotExists([]byte(bucketUsage)); err != nil {
-			return err
-		}
-		return nil
+	var compact bool
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		from, applied, err := migrate(tx, opts)
+		compact = needsCompact(from, applied)
+		return err
 	}); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
-	return st, nil
+	if compact {
+		if err := db.Close(); err != nil {
+			return nil, err
+		}
+		if err := compactBBolt(path); err != nil {
+			return nil, err
+		}
+		if db, err = bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 2 * time.Second}); err != nil {
+			return nil, err
+		}
+	}
+	return &BBoltStore{db: db, opts: opts, actor: "system"}, nil
 }
 
 func (s *BBoltStore) Close() error { return s.db.Close() }
 
-func (s *BBoltStore) CreateLicense(limit int, note string) (License, error) {
-	if limit <= 0 {
-		return License{}, fmt.Errorf("limit must be > 0")
+func (s *BBoltStore) update(op string, fn func(tx *bbolt.Tx) error) error {
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx(op, time.Since(start)) }(time.Now())
+	}
+	return s.db.Update(fn)
+}
+
+func (s *BBoltStore) view(op string, fn func(tx *bbolt.Tx) error) error {
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx(op, time.Since(start)) }(time.Now())
 	}
-	key, err := license.NewKey()
+	return s.db.View(fn)
+}
+
+// As returns a view of the store that records actor in the audit log.
+func (s *BBoltStore) As(actor string) Store {
+	cp := *s
+	cp.actor = actor
+	return &cp
+}
+
+func (s *BBoltStore) CreateLicense(limit int, note string, opts CreateOptions) (License, error) {
+	lic, err := s.opts.newLicense(limit, note, opts, time.Now().UTC())
 	if err != nil {
 		return License{}, err
 	}
-	lic := License{Key: key, Limit: limit, Note: note, Enabled: true, CreatedAt: time.Now().UTC()}
-	buf, _ := json.Marshal(lic)
+	if err := s.update("CreateLicense", func(tx *bbolt.Tx) error {
+		return s.insertLicense(tx, lic)
+	}); err != nil {
+		return License{}, err
+	}
+	return lic, nil
+}
 
-	if err := s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucketLicenses))
-		if b.Get([]byte(key)) != nil {
-			return fmt.Errorf("key collision, try again")
-		}
-		if err := b.Put([]byte(key), buf); err != nil {
+func (s *BBoltStore) insertLicense(tx *bbolt.Tx, lic License) error {
+	b := tx.Bucket([]byte(bucketLicenses))
+	if b.Get([]byte(lic.ID)) != nil {
+		return fmt.Errorf("key collision, try again")
+	}
+	if lic.CustomerID != "" {
+		if _, err := getCustomer(tx, lic.CustomerID); err != nil {
 			return err
 		}
-		usage := tx.Bucket([]byte(bucketUsage))
-		_, err := usage.CreateBucketIfNotExists([]byte(key))
+	}
+	if err := putLicense(tx, lic); err != nil {
 		return err
-	}); err != nil {
-		return License{}, err
 	}
-	return lic, nil
+	if err := indexLicense(tx, lic); err != nil {
+		return err
+	}
+	usage := tx.Bucket([]byte(bucketUsage))
+	if _, err := usage.CreateBucketIfNotExists([]byte(lic.ID)); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("limit=%d note=%q", lic.Limit, lic.Note)
+	if lic.BatchID != "" {
+		detail += " batch=" + lic.BatchID
+	}
+	return s.audit(tx, AuditEvent{Action: AuditCreate, Key: lic.ID, Detail: detail})
 }
 
 func (s *BBoltStore) SetLimit(key string, limit int) (License, error) {
+	id := s.opts.ref(key)
 	if limit <= 0 {
 		return License{}, fmt.Errorf("limit must be > 0")
 	}
 	var updated License
-	if err := s.db.Update(func(tx *bbolt.Tx) error {
-		lic, err := getLicense(tx, key)
+	if err := s.update("SetLimit", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
 		if err != nil {
 			return err
 		}
+		old := lic.Limit
 		lic.Limit = limit
 		updated = lic
-		return putLicense(tx, lic)
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditSetLimit, Key: id, Detail: fmt.Sprintf("%d -> %d", old, limit)})
 	}); err != nil {
 		return License{}, err
 	}
@@ -102,32 +175,278 @@ func (s *BBoltStore) SetLimit(key string, limit int) (License, error) {
 }
 
 func (s *BBoltStore) SetEnabled(key string, enabled bool) (License, error) {
+	id := s.opts.ref(key)
 	var updated License
-	if err := s.db.Update(func(tx *bbolt.Tx) error {
-		lic, err := getLicense(tx, key)
+	if err := s.update("SetEnabled", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
 		if err != nil {
 			return err
 		}
 		lic.Enabled = enabled
 		updated = lic
-		return putLicense(tx, lic)
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		action := AuditDisable
+		if enabled {
+			action = AuditEnable
+		}
+		return s.audit(tx, AuditEvent{Action: action, Key: id})
 	}); err != nil {
 		return License{}, err
 	}
 	return updated, nil
 }
 
+func (s *BBoltStore) Renew(key string, d time.Duration) (License, error) {
+	id := s.opts.ref(key)
+	if d <= 0 {
+		return License{}, fmt.Errorf("duration must be > 0")
+	}
+	now := time.Now().UTC()
+	var updated License
+	if err := s.update("Renew", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		from := lic.ExpiresAt
+		if from.Before(now) {
+			from = now
+		}
+		lic.ExpiresAt = from.Add(d)
+		updated = lic
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditRenew, Key: id, Detail: "expires " + lic.ExpiresAt.Format(time.RFC3339)})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *BBoltStore) Unbind(key string, serverID string) error {
+	id := s.opts.ref(key)
+	serverID = strings.TrimSpace(serverID)
+	return s.update("Unbind", func(tx *bbolt.Tx) error {
+		if _, err := getLicense(tx, id); err != nil {
+			return err
+		}
+		usage := tx.Bucket([]byte(bucketUsage)).Bucket([]byte(id))
+		if usage == nil || usage.Get([]byte(serverID)) == nil {
+			return ErrNotBound
+		}
+		if err := usage.Delete([]byte(serverID)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditUnbind, Key: id, ServerID: serverID})
+	})
+}
+
+func (s *BBoltStore) ResetBindings(key string) (int, error) {
+	id := s.opts.ref(key)
+	n := 0
+	if err := s.update("ResetBindings", func(tx *bbolt.Tx) error {
+		if _, err := getLicense(tx, id); err != nil {
+			return err
+		}
+		usageRoot := tx.Bucket([]byte(bucketUsage))
+		if usage := usageRoot.Bucket([]byte(id)); usage != nil {
+			n = countKeys(usage)
+			if err := usageRoot.DeleteBucket([]byte(id)); err != nil {
+				return err
+			}
+		}
+		if _, err := usageRoot.CreateBucket([]byte(id)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditReset, Key: id, Detail: fmt.Sprintf("released %d", n)})
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *BBoltStore) SetIdleDays(key string, days int) (License, error) {
+	id := s.opts.ref(key)
+	if days < 0 {
+		return License{}, fmt.Errorf("days must be >= 0")
+	}
+	var updated License
+	if err := s.update("SetIdleDays", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		lic.IdleDays = days
+		updated = lic
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditSetIdle, Key: id, Detail: fmt.Sprintf("%d days", days)})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *BBoltStore) SetMode(key string, mode string) (License, error) {
+	id := s.opts.ref(key)
+	if err := checkMode(mode); err != nil {
+		return License{}, err
+	}
+	var updated License
+	if err := s.update("SetMode", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		old := lic.Mode
+		lic.Mode = mode
+		updated = lic
+		if err := putLicense(tx, lic); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditSetMode, Key: id, Detail: fmt.Sprintf("%s -> %s", modeName(old), modeName(mode))})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *BBoltStore) ReapStale() (int, error) {
+	now := time.Now().UTC()
+	total := 0
+	if err := s.update("ReapStale", func(tx *bbolt.Tx) error {
+		var lics []License
+		if err := tx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return err
+			}
+			lics = append(lics, lic)
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, lic := range lics {
+			n, err := s.reapLicense(tx, lic, now, "")
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (s *BBoltStore) ListReaped(key string) ([]ReapedBinding, error) {
+	id := s.opts.ref(key)
+	var out []ReapedBinding
+	if err := s.view("ListReaped", func(tx *bbolt.Tx) error {
+		if _, err := getLicense(tx, id); err != nil {
+			return err
+		}
+		b := tx.Bucket([]byte(bucketReaped)).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var rb ReapedBinding
+			if err := json.Unmarshal(v, &rb); err != nil {
+				return err
+			}
+			out = append(out, rb)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// reapLicense moves bindings idle past the license TTL into the reaped
+// bucket and returns how many it moved; lapsed leases are just deleted.
+// keep is never reaped (the server currently activating).
+func (s *BBoltStore) reapLicense(tx *bbolt.Tx, lic License, now time.Time, keep string) (int, error) {
+	ttl := s.opts.idleTTL(lic)
+	if ttl <= 0 {
+		return 0, nil
+	}
+	usage := tx.Bucket([]byte(bucketUsage)).Bucket([]byte(lic.ID))
+	if usage == nil {
+		return 0, nil
+	}
+	var stale []ServerBinding
+	if err := usage.ForEach(func(k, v []byte) error {
+		if string(k) == keep {
+			return nil
+		}
+		var sb ServerBinding
+		if err := json.Unmarshal(v, &sb); err != nil {
+			return err
+		}
+		sb.ServerID = string(k)
+		if now.Sub(sb.LastSeen) > ttl {
+			stale = append(stale, sb)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+	if lic.Floating() {
+		for _, sb := range stale {
+			if err := usage.Delete([]byte(sb.ServerID)); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+	reaped, err := tx.Bucket([]byte(bucketReaped)).CreateBucketIfNotExists([]byte(lic.ID))
+	if err != nil {
+		return 0, err
+	}
+	for _, sb := range stale {
+		if err := usage.Delete([]byte(sb.ServerID)); err != nil {
+			return 0, err
+		}
+		seq, err := reaped.NextSequence()
+		if err != nil {
+			return 0, err
+		}
+		buf, _ := json.Marshal(ReapedBinding{ServerBinding: sb, ReapedAt: now})
+		if err := reaped.Put(seqKey(seq), buf); err != nil {
+			return 0, err
+		}
+		if err := s.audit(tx, AuditEvent{Action: AuditReap, Key: lic.ID, ServerID: sb.ServerID, Detail: "last seen " + sb.LastSeen.Format(time.RFC3339)}); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
 func (s *BBoltStore) GetInfo(key string) (LicenseInfo, error) {
+	id := s.opts.ref(key)
 	var info LicenseInfo
-	if err := s.db.View(func(tx *bbolt.Tx) error {
-		lic, err := getLicense(tx, key)
+	now := time.Now().UTC()
+	if err := s.view("GetInfo", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
 		if err != nil {
 			return err
 		}
-		bindings, err := getBindings(tx, key)
+		bindings, err := getBindings(tx, id)
 		if err != nil {
 			return err
 		}
+		bindings = s.opts.live(lic, bindings, now)
 		info = LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings}
 		return nil
 	}); err != nil {
@@ -138,7 +457,8 @@ func (s *BBoltStore) GetInfo(key string) (LicenseInfo, error) {
 
 func (s *BBoltStore) ListLicenses() ([]LicenseInfo, error) {
 	var out []LicenseInfo
-	if err := s.db.View(func(tx *bbolt.Tx) error {
+	now := time.Now().UTC()
+	if err := s.view("ListLicenses", func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(bucketLicenses))
 		return b.ForEach(func(k, v []byte) error {
 			var lic License
@@ -149,7 +469,7 @@ func (s *BBoltStore) ListLicenses() ([]LicenseInfo, error) {
 			if err != nil {
 				return err
 			}
-			out = append(out, LicenseInfo{License: lic, Used: len(bindings), Bindings: nil})
+			out = append(out, LicenseInfo{License: lic, Used: len(s.opts.live(lic, bindings, now)), Bindings: nil})
 			return nil
 		})
 	}); err != nil {
@@ -162,37 +482,53 @@ func (s *BBoltStore) ListLicenses() ([]LicenseInfo, error) {
 }
 
 func (s *BBoltStore) Activate(key string, serverID string) (ActivateResult, error) {
-	key = strings.TrimSpace(key)
 	serverID = strings.TrimSpace(serverID)
-	if key == "" || serverID == "" {
-		return ActivateResult{OK: false, Reason: "invalid_request"}, nil
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason == "not_found" {
+		// Not even key-shaped; don't echo it back.
+		s.emit(events.Event{Type: events.NotFound, ServerID: serverID})
 	}
-	if len(serverID) > 128 {
-		return ActivateResult{OK: false, Reason: "server_id_too_long"}, nil
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
 	}
 
 	var res ActivateResult
+	var ev *events.Event
 	now := time.Now().UTC()
-	if err := s.db.Update(func(tx *bbolt.Tx) error {
-		lic, err := getLicense(tx, key)
+	activate := func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
 		if err != nil {
 			res = ActivateResult{OK: false, Reason: "not_found"}
+			ev = &events.Event{Type: events.NotFound, Fingerprint: license.Fingerprint(key), ServerID: serverID}
 			return nil
 		}
+		newEvent := func(t events.Type, used int) *events.Event {
+			return &events.Event{Type: t, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: lic.Note, ServerID: serverID, Used: used, Limit: lic.Limit}
+		}
 		if !lic.Enabled {
 			res = ActivateResult{OK: false, Reason: "disabled", Limit: lic.Limit}
+			ev = newEvent(events.Disabled, 0)
+			return nil
+		}
+		status := lic.Status(now)
+		if status == StatusExpired {
+			res = ActivateResult{OK: false, Reason: "expired", Enabled: true, Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
 			return nil
 		}
 		usageRoot := tx.Bucket([]byte(bucketUsage))
-		usage := usageRoot.Bucket([]byte(key))
+		usage := usageRoot.Bucket([]byte(id))
 		if usage == nil {
 			var err error
-			usage, err = usageRoot.CreateBucketIfNotExists([]byte(key))
+			usage, err = usageRoot.CreateBucketIfNotExists([]byte(id))
 			if err != nil {
 				return err
 			}
 		}
 
+		if _, err := s.reapLicense(tx, lic, now, serverID); err != nil {
+			return err
+		}
+
 		existing := usage.Get([]byte(serverID))
 		newBinding := false
 		var sb ServerBinding
@@ -203,7 +539,8 @@ func (s *BBoltStore) Activate(key string, serverID string) (ActivateResult, erro
 		} else {
 			used := countKeys(usage)
 			if used >= lic.Limit {
-				res = ActivateResult{OK: false, Reason: "limit_reached", Used: used, Limit: lic.Limit}
+				res = ActivateResult{OK: false, Reason: "limit_reached", Enabled: true, Used: used, Limit: lic.Limit}
+				ev = newEvent(events.LimitReached, used)
 				return nil
 			}
 			newBinding = true
@@ -213,20 +550,125 @@ func (s *BBoltStore) Activate(key string, serverID string) (ActivateResult, erro
 		if err := usage.Put([]byte(serverID), buf); err != nil {
 			return err
 		}
+		announce := newBinding && !lic.Floating()
+		if announce {
+			if err := s.audit(tx, AuditEvent{Action: AuditBind, Key: id, ServerID: serverID}); err != nil {
+				return err
+			}
+		}
 		used := countKeys(usage)
-		res = ActivateResult{OK: true, Reason: "ok", Used: used, Limit: lic.Limit, NewlyBound: newBinding}
+		if announce {
+			ev = newEvent(events.Bound, used)
+		}
+		reason := "ok"
+		if status == StatusInGrace {
+			reason = "in_grace"
+		}
+		res = ActivateResult{OK: true, Reason: reason, Enabled: true, Used: used, Limit: lic.Limit, NewlyBound: newBinding,
+			ExpiresAt: expiresAt(lic), LeaseExpiresAt: s.opts.leaseExpiry(lic, now)}
 		return nil
+	}
+	if err := s.update("Activate", func(tx *bbolt.Tx) error {
+		ev = nil
+		if err := activate(tx); err != nil || ev == nil {
+			return err
+		}
+		s.stamp(ev)
+		return s.enqueueWebhooks(tx, *ev)
 	}); err != nil {
 		return ActivateResult{}, err
 	}
+	if ev != nil {
+		s.opts.Events.Publish(*ev)
+	}
 	return res, nil
 }
 
-func getLicense(tx *bbolt.Tx, key string) (License, error) {
+func (s *BBoltStore) stamp(ev *events.Event) {
+	ev.At = time.Now().UTC()
+	ev.Actor = s.actor
+}
+
+func (s *BBoltStore) emit(ev events.Event) {
+	s.stamp(&ev)
+	s.opts.Events.Publish(ev)
+}
+
+func (s *BBoltStore) Validate(key string, serverID string) (ActivateResult, error) {
+	serverID = strings.TrimSpace(serverID)
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
+	}
+
+	var res ActivateResult
+	now := time.Now().UTC()
+	if err := s.update("Validate", func(tx *bbolt.Tx) error {
+		lic, err := getLicense(tx, id)
+		if err != nil {
+			res = ActivateResult{OK: false, Reason: "not_found"}
+			return nil
+		}
+		if lic.Floating() {
+			// A lapsed lease, this server's included, is gone.
+			if _, err := s.reapLicense(tx, lic, now, ""); err != nil {
+				return err
+			}
+		}
+		usage := tx.Bucket([]byte(bucketUsage)).Bucket([]byte(id))
+		used := 0
+		var existing []byte
+		if usage != nil {
+			used = countKeys(usage)
+			existing = usage.Get([]byte(serverID))
+		}
+		res = ActivateResult{Enabled: lic.Enabled, Used: used, Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
+		status := lic.Status(now)
+		switch {
+		case !lic.Enabled:
+			res.Reason = "disabled"
+			return nil
+		case status == StatusExpired:
+			res.Reason = "expired"
+			return nil
+		case existing == nil:
+			res.Reason = "not_bound"
+			return nil
+		}
+		var sb ServerBinding
+		_ = json.Unmarshal(existing, &sb)
+		sb.LastSeen = now
+		sb.SeenCount++
+		buf, _ := json.Marshal(sb)
+		if err := usage.Put([]byte(serverID), buf); err != nil {
+			return err
+		}
+		res.OK = true
+		res.Reason = "ok"
+		res.LeaseExpiresAt = s.opts.leaseExpiry(lic, now)
+		if status == StatusInGrace {
+			res.Reason = "in_grace"
+		}
+		return nil
+	}); err != nil {
+		return ActivateResult{}, err
+	}
+	return res, nil
+}
+
+func expiresAt(lic License) *time.Time {
+	if lic.ExpiresAt.IsZero() {
+		return nil
+	}
+	t := lic.ExpiresAt
+	return &t
+}
+
+func getLicense(tx *bbolt.Tx, id string) (License, error) {
 	b := tx.Bucket([]byte(bucketLicenses))
-	v := b.Get([]byte(key))
+	v := b.Get([]byte(id))
 	if v == nil {
-		return License{}, errNotFound
+		return License{}, ErrNotFound
 	}
 	var lic License
 	if err := json.Unmarshal(v, &lic); err != nil {
@@ -237,13 +679,14 @@ func getLicense(tx *bbolt.Tx, key string) (License, error) {
 
 func putLicense(tx *bbolt.Tx, lic License) error {
 	b := tx.Bucket([]byte(bucketLicenses))
+	lic.Key = ""
 	buf, _ := json.Marshal(lic)
-	return b.Put([]byte(lic.Key), buf)
+	return b.Put([]byte(lic.ID), buf)
 }
 
-func getBindings(tx *bbolt.Tx, key string) ([]ServerBinding, error) {
+func getBindings(tx *bbolt.Tx, id string) ([]ServerBinding, error) {
 	usageRoot := tx.Bucket([]byte(bucketUsage))
-	usage := usageRoot.Bucket([]byte(key))
+	usage := usageRoot.Bucket([]byte(id))
 	if usage == nil {
 		return nil, nil
 	}
@@ -266,6 +709,12 @@ func getBindings(tx *bbolt.Tx, key string) ([]ServerBinding, error) {
 	return bindings, nil
 }
 
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
 func countKeys(b *bbolt.Bucket) int {
 	// Stats can be stale; iterate for correctness.
 	n := 0
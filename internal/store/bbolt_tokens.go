@@ -0,0 +1,114 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// tokenTouchEvery limits how often LastUsed is rewritten.
+const tokenTouchEvery = time.Minute
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *BBoltStore) CreateAPIToken(name string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, fmt.Errorf("name is required")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, err
+	}
+	token := "kpt_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	h := hashToken(token)
+	t := APIToken{ID: h[:12], Name: name, CreatedAt: time.Now().UTC()}
+	buf, _ := json.Marshal(t)
+	if err := s.update("CreateAPIToken", func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(bucketTokens)).Put([]byte(h), buf); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("created %s (%s)", t.ID, name)})
+	}); err != nil {
+		return "", APIToken{}, err
+	}
+	return token, t, nil
+}
+
+func (s *BBoltStore) ListAPITokens() ([]APIToken, error) {
+	var out []APIToken
+	if err := s.view("ListAPITokens", func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketTokens)).ForEach(func(_, v []byte) error {
+			var t APIToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			out = append(out, t)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *BBoltStore) RevokeAPIToken(id string) error {
+	return s.update("RevokeAPIToken", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketTokens))
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var t APIToken
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if t.ID != id {
+				continue
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			return s.audit(tx, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("revoked %s (%s)", t.ID, t.Name)})
+		}
+		return ErrUnauthorized
+	})
+}
+
+func (s *BBoltStore) AuthAPIToken(token string) (APIToken, error) {
+	h := []byte(hashToken(strings.TrimSpace(token)))
+	var t APIToken
+	if err := s.view("AuthAPIToken", func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(bucketTokens)).Get(h)
+		if v == nil {
+			return ErrUnauthorized
+		}
+		return json.Unmarshal(v, &t)
+	}); err != nil {
+		return APIToken{}, err
+	}
+	now := time.Now().UTC()
+	if now.Sub(t.LastUsed) < tokenTouchEvery {
+		return t, nil
+	}
+	t.LastUsed = now
+	buf, _ := json.Marshal(t)
+	err := s.update("AuthAPIToken", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketTokens))
+		if b.Get(h) == nil {
+			return ErrUnauthorized
+		}
+		return b.Put(h, buf)
+	})
+	return t, err
+}
@@ -0,0 +1,250 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+
+	"go.etcd.io/bbolt"
+)
+
+// webhookPayload is the JSON body POSTed for an event.
+type webhookPayload struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	At          time.Time `json:"at"`
+	LicenseID   string    `json:"license_id,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	ServerID    string    `json:"server_id,omitempty"`
+	Used        int       `json:"used"`
+	Limit       int       `json:"limit"`
+}
+
+func (s *BBoltStore) CreateWebhook(rawURL string, eventTypes []string) (Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid url %q", rawURL)
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(events.Types, events.Type(t)) {
+			return Webhook{}, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return Webhook{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	w := Webhook{ID: hex.EncodeToString(id), URL: u.String(), Secret: "whsec_" + hex.EncodeToString(secret), Events: eventTypes, CreatedAt: time.Now().UTC()}
+	buf, _ := json.Marshal(w)
+	if err := s.update("CreateWebhook", func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(bucketWebhooks)).Put([]byte(w.ID), buf); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditWebhook, Detail: fmt.Sprintf("created %s %s", w.ID, w.URL)})
+	}); err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s *BBoltStore) ListWebhooks() ([]Webhook, error) {
+	var out []Webhook
+	if err := s.view("ListWebhooks", func(tx *bbolt.Tx) error {
+		var err error
+		out, err = listWebhooks(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func listWebhooks(tx *bbolt.Tx) ([]Webhook, error) {
+	var out []Webhook
+	err := tx.Bucket([]byte(bucketWebhooks)).ForEach(func(_, v []byte) error {
+		var w Webhook
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		out = append(out, w)
+		return nil
+	})
+	return out, err
+}
+
+func (s *BBoltStore) DeleteWebhook(id string) error {
+	return s.update("DeleteWebhook", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketWebhooks))
+		if b.Get([]byte(id)) == nil {
+			return ErrWebhookNotFound
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+		outbox := tx.Bucket([]byte(bucketOutbox))
+		var drop [][]byte
+		if err := outbox.ForEach(func(k, v []byte) error {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.WebhookID == id {
+				drop = append(drop, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range drop {
+			if err := outbox.Delete(k); err != nil {
+				return err
+			}
+		}
+		return s.audit(tx, AuditEvent{Action: AuditWebhook, Detail: "deleted " + id})
+	})
+}
+
+// enqueueWebhooks queues ev for every subscribed webhook in the same
+// transaction that produced it, so no event is lost on a crash.
+func (s *BBoltStore) enqueueWebhooks(tx *bbolt.Tx, ev events.Event) error {
+	hooks, err := listWebhooks(tx)
+	if err != nil {
+		return err
+	}
+	outbox := tx.Bucket([]byte(bucketOutbox))
+	for _, w := range hooks {
+		if !w.Wants(string(ev.Type)) {
+			continue
+		}
+		seq, err := outbox.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := seqKey(seq)
+		d := WebhookDelivery{ID: hex.EncodeToString(k), WebhookID: w.ID, Event: string(ev.Type), State: DeliveryPending, NextAttempt: ev.At, CreatedAt: ev.At, UpdatedAt: ev.At}
+		d.Payload, _ = json.Marshal(webhookPayload{
+			ID: d.ID, Type: d.Event, At: ev.At, LicenseID: ev.LicenseID, Fingerprint: ev.Fingerprint,
+			Note: ev.Note, ServerID: ev.ServerID, Used: ev.Used, Limit: ev.Limit,
+		})
+		buf, _ := json.Marshal(d)
+		if err := outbox.Put(k, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BBoltStore) DueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	if err := s.view("DueDeliveries", func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucketOutbox)).Cursor()
+		for k, v := c.First(); k != nil && (limit <= 0 || len(out) < limit); k, v = c.Next() {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.State == DeliveryPending && !d.NextAttempt.After(now) {
+				out = append(out, d)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *BBoltStore) RecordDelivery(id string, attempt DeliveryAttempt) error {
+	k, err := hex.DecodeString(id)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+	return s.update("RecordDelivery", func(tx *bbolt.Tx) error {
+		outbox := tx.Bucket([]byte(bucketOutbox))
+		v := outbox.Get(k)
+		if v == nil {
+			// The webhook was deleted while the delivery was in flight.
+			return nil
+		}
+		var d WebhookDelivery
+		if err := json.Unmarshal(v, &d); err != nil {
+			return err
+		}
+		d.Attempts++
+		d.LastStatus = attempt.Status
+		d.LastError = attempt.Error
+		d.UpdatedAt = time.Now().UTC()
+		switch {
+		case attempt.OK:
+			d.State = DeliveryDelivered
+		case attempt.Retry.IsZero():
+			d.State = DeliveryFailed
+		default:
+			d.NextAttempt = attempt.Retry
+		}
+		buf, _ := json.Marshal(d)
+		return outbox.Put(k, buf)
+	})
+}
+
+func (s *BBoltStore) ListDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	if err := s.view("ListDeliveries", func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucketOutbox)).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(out) < limit); k, v = c.Prev() {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.WebhookID == webhookID {
+				out = append(out, d)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *BBoltStore) PruneDeliveries(before time.Time) (int, error) {
+	n := 0
+	err := s.update("PruneDeliveries", func(tx *bbolt.Tx) error {
+		outbox := tx.Bucket([]byte(bucketOutbox))
+		var drop [][]byte
+		if err := outbox.ForEach(func(k, v []byte) error {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.State != DeliveryPending && d.UpdatedAt.Before(before) {
+				drop = append(drop, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range drop {
+			if err := outbox.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(drop)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,1091 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+	"kypaqet-license-bot/internal/license"
+)
+
+var testSecret = []byte("conformance-secret")
+
+// opener creates an empty store for one test.
+type opener func(t *testing.T, opts Options) Store
+
+// backends lists every Store implementation; each must pass every
+// conformance case.
+var backends = map[string]opener{
+	"bbolt": func(t *testing.T, opts Options) Store {
+		st, err := OpenBBolt(filepath.Join(t.TempDir(), "test.db"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		return st
+	},
+	"memory": func(t *testing.T, opts Options) Store {
+		return NewMemory(opts)
+	},
+	"sqlite": func(t *testing.T, opts Options) Store {
+		st, err := OpenSQLite(filepath.Join(t.TempDir(), "test.sqlite"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		return st
+	},
+}
+
+var conformance = []struct {
+	name string
+	run  func(t *testing.T, open opener)
+}{
+	{"Licenses", testLicenses},
+	{"Activate", testActivate},
+	{"Expiry", testExpiry},
+	{"Validate", testValidate},
+	{"Bindings", testBindings},
+	{"Reaping", testReaping},
+	{"Floating", testFloating},
+	{"Query", testQuery},
+	{"Batches", testBatches},
+	{"Customers", testCustomers},
+	{"Admins", testAdmins},
+	{"Tokens", testTokens},
+	{"Audit", testAudit},
+	{"Webhooks", testWebhooks},
+	{"Events", testEvents},
+	{"ExportImport", testExportImport},
+	{"Concurrency", testConcurrency},
+}
+
+func TestConformance(t *testing.T) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			for _, c := range conformance {
+				t.Run(c.name, func(t *testing.T) { c.run(t, open) })
+			}
+		})
+	}
+}
+
+func openDefault(t *testing.T, open opener) Store {
+	return open(t, Options{KeySecret: testSecret})
+}
+
+func mustCreate(t *testing.T, st Store, limit int, note string, opts CreateOptions) License {
+	t.Helper()
+	lic, err := st.CreateLicense(limit, note, opts)
+	if err != nil {
+		t.Fatalf("CreateLicense: %v", err)
+	}
+	return lic
+}
+
+func mustActivate(t *testing.T, st Store, key, server string) ActivateResult {
+	t.Helper()
+	res, err := st.Activate(key, server)
+	if err != nil {
+		t.Fatalf("Activate(%s): %v", server, err)
+	}
+	return res
+}
+
+// importJSONL loads one JSON Lines record per line.
+func importJSONL(t *testing.T, st Store, lines ...string) {
+	t.Helper()
+	r := strings.NewReader(strings.Join(lines, "\n"))
+	if _, err := st.Import(r, ImportOptions{Format: FormatJSONL}); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+}
+
+func testLicenses(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, err := st.CreateLicense(0, "", CreateOptions{}); err == nil {
+		t.Error("CreateLicense(0) succeeded")
+	}
+	if _, err := st.CreateLicense(1, "", CreateOptions{GraceDays: -1}); err == nil {
+		t.Error("negative grace accepted")
+	}
+	if _, err := st.CreateLicense(1, "", CreateOptions{CustomerID: "nope"}); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("unknown customer: err = %v", err)
+	}
+	lic := mustCreate(t, st, 2, "note", CreateOptions{ValidFor: 48 * time.Hour, GraceDays: 3})
+	if !license.IsKey(lic.Key) || lic.ID != license.KeyID(testSecret, lic.Key) || lic.Fingerprint != license.Fingerprint(lic.Key) {
+		t.Fatalf("created license = %+v", lic)
+	}
+	if !lic.Enabled || lic.Limit != 2 || lic.GraceDays != 3 || lic.ExpiresAt.Sub(lic.CreatedAt) != 48*time.Hour {
+		t.Errorf("created license = %+v", lic)
+	}
+	for _, ref := range []string{lic.Key, lic.ID, strings.ToUpper(lic.ID), " " + lic.ID + " "} {
+		info, err := st.GetInfo(ref)
+		if err != nil {
+			t.Fatalf("GetInfo(%q): %v", ref, err)
+		}
+		if info.License.Key != "" || info.License.ID != lic.ID || info.Used != 0 || len(info.Bindings) != 0 {
+			t.Errorf("GetInfo(%q) = %+v", ref, info)
+		}
+	}
+
+	if l, err := st.SetLimit(lic.Key, 5); err != nil || l.Limit != 5 || l.Key != "" {
+		t.Errorf("SetLimit = %+v, %v", l, err)
+	}
+	if _, err := st.SetLimit(lic.ID, 0); err == nil {
+		t.Error("SetLimit(0) succeeded")
+	}
+	if l, err := st.SetEnabled(lic.ID, false); err != nil || l.Enabled {
+		t.Errorf("SetEnabled = %+v, %v", l, err)
+	}
+	if l, err := st.SetIdleDays(lic.ID, 4); err != nil || l.IdleDays != 4 {
+		t.Errorf("SetIdleDays = %+v, %v", l, err)
+	}
+	if _, err := st.SetIdleDays(lic.ID, -1); err == nil {
+		t.Error("SetIdleDays(-1) succeeded")
+	}
+	renewed, err := st.Renew(lic.ID, 24*time.Hour)
+	if err != nil || renewed.ExpiresAt.Sub(lic.ExpiresAt) != 24*time.Hour {
+		t.Errorf("Renew = %+v, %v", renewed, err)
+	}
+	if _, err := st.Renew(lic.ID, 0); err == nil {
+		t.Error("Renew(0) succeeded")
+	}
+	info, _ := st.GetInfo(lic.ID)
+	if want := (License{ID: lic.ID, Fingerprint: lic.Fingerprint, Limit: 5, Note: "note", CreatedAt: lic.CreatedAt,
+		ExpiresAt: renewed.ExpiresAt, GraceDays: 3, IdleDays: 4}); !sameLicense(info.License, want) {
+		t.Errorf("stored = %+v, want %+v", info.License, want)
+	}
+
+	missing := "KYPAQET-AAAA-BBBB-CCCC-DDDD"
+	if _, err := st.GetInfo(missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetInfo(missing) err = %v", err)
+	}
+	for name, err := range map[string]error{
+		"SetLimit":   second(st.SetLimit(missing, 1)),
+		"SetEnabled": second(st.SetEnabled(missing, true)),
+		"Renew":      second(st.Renew(missing, time.Hour)),
+		"SetIdle":    second(st.SetIdleDays(missing, 1)),
+		"Reset":      second(st.ResetBindings(missing)),
+		"ListReaped": second(st.ListReaped(missing)),
+		"Unbind":     st.Unbind(missing, "srv"),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s(missing) err = %v", name, err)
+		}
+	}
+
+	other := mustCreate(t, st, 1, "", CreateOptions{})
+	list, err := st.ListLicenses()
+	if err != nil || len(list) != 2 || list[0].License.ID != other.ID || list[1].License.ID != lic.ID {
+		t.Errorf("ListLicenses = %+v, %v", list, err)
+	}
+}
+
+func second[T any](_ T, err error) error { return err }
+
+func sameLicense(a, b License) bool {
+	return a.ID == b.ID && a.Fingerprint == b.Fingerprint && a.Limit == b.Limit && a.Note == b.Note &&
+		a.Enabled == b.Enabled && a.CreatedAt.Equal(b.CreatedAt) && a.ExpiresAt.Equal(b.ExpiresAt) &&
+		a.GraceDays == b.GraceDays && a.IdleDays == b.IdleDays && a.BatchID == b.BatchID && a.CustomerID == b.CustomerID &&
+		a.Mode == b.Mode
+}
+
+func testActivate(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	lic := mustCreate(t, st, 2, "", CreateOptions{})
+
+	for _, tc := range []struct {
+		key, server, reason string
+	}{
+		{"", "srv", "invalid_request"},
+		{lic.Key, "", "invalid_request"},
+		{lic.Key, "   ", "invalid_request"},
+		{lic.Key, strings.Repeat("x", 129), "server_id_too_long"},
+		{lic.ID, "srv", "not_found"},
+		{"KYPAQET-AAAA-BBBB-CCCC-DDDD", "srv", "not_found"},
+	} {
+		res := mustActivate(t, st, tc.key, tc.server)
+		if res.OK || res.Reason != tc.reason {
+			t.Errorf("Activate(%q, %q) = %+v, want %s", tc.key, tc.server, res, tc.reason)
+		}
+	}
+
+	res := mustActivate(t, st, lic.Key, "a")
+	if want := (ActivateResult{OK: true, Reason: "ok", Enabled: true, Used: 1, Limit: 2, NewlyBound: true}); res != want {
+		t.Errorf("first activation = %+v, want %+v", res, want)
+	}
+	res = mustActivate(t, st, " "+lic.Key+" ", " a ")
+	if want := (ActivateResult{OK: true, Reason: "ok", Enabled: true, Used: 1, Limit: 2}); res != want {
+		t.Errorf("repeat activation = %+v, want %+v", res, want)
+	}
+	mustActivate(t, st, lic.Key, "b")
+	res = mustActivate(t, st, lic.Key, "c")
+	if want := (ActivateResult{Reason: "limit_reached", Enabled: true, Used: 2, Limit: 2}); res != want {
+		t.Errorf("over limit = %+v, want %+v", res, want)
+	}
+	if res := mustActivate(t, st, lic.Key, "a"); !res.OK {
+		t.Errorf("bound server rejected at limit: %+v", res)
+	}
+
+	info, _ := st.GetInfo(lic.ID)
+	if info.Used != 2 || len(info.Bindings) != 2 || info.Bindings[0].ServerID != "a" || info.Bindings[0].SeenCount != 3 {
+		t.Errorf("bindings = %+v", info.Bindings)
+	}
+
+	st.SetEnabled(lic.ID, false)
+	res = mustActivate(t, st, lic.Key, "a")
+	if want := (ActivateResult{Reason: "disabled", Limit: 2}); res != want {
+		t.Errorf("disabled = %+v, want %+v", res, want)
+	}
+}
+
+func testExpiry(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	expired := mustCreate(t, st, 1, "", CreateOptions{ValidFor: time.Nanosecond})
+	grace := mustCreate(t, st, 1, "", CreateOptions{ValidFor: time.Nanosecond, GraceDays: 1})
+	time.Sleep(time.Millisecond)
+
+	res := mustActivate(t, st, expired.Key, "a")
+	if res.OK || res.Reason != "expired" || !res.Enabled || res.ExpiresAt == nil || !res.ExpiresAt.Equal(expired.ExpiresAt) {
+		t.Errorf("expired = %+v", res)
+	}
+	res = mustActivate(t, st, grace.Key, "a")
+	if !res.OK || res.Reason != "in_grace" || !res.NewlyBound {
+		t.Errorf("in grace = %+v", res)
+	}
+
+	renewed, err := st.Renew(expired.ID, time.Hour)
+	if err != nil || renewed.ExpiresAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Renew of expired = %+v, %v", renewed, err)
+	}
+	if res := mustActivate(t, st, expired.Key, "a"); !res.OK || res.Reason != "ok" {
+		t.Errorf("after renew = %+v", res)
+	}
+}
+
+func testValidate(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	lic := mustCreate(t, st, 2, "", CreateOptions{})
+	check := func(server, reason string, ok bool) ActivateResult {
+		t.Helper()
+		res, err := st.Validate(lic.Key, server)
+		if err != nil || res.OK != ok || res.Reason != reason {
+			t.Errorf("Validate(%q) = %+v, %v; want %s", server, res, err, reason)
+		}
+		return res
+	}
+	check("a", "not_bound", false)
+	if info, _ := st.GetInfo(lic.ID); info.Used != 0 {
+		t.Fatal("Validate bound a seat")
+	}
+	mustActivate(t, st, lic.Key, "a")
+	res := check("a", "ok", true)
+	if res.NewlyBound || res.Used != 1 || res.Limit != 2 || !res.Enabled {
+		t.Errorf("Validate = %+v", res)
+	}
+	if info, _ := st.GetInfo(lic.ID); info.Bindings[0].SeenCount != 2 {
+		t.Errorf("SeenCount = %d, want 2", info.Bindings[0].SeenCount)
+	}
+	st.SetEnabled(lic.ID, false)
+	if res := check("a", "disabled", false); res.Enabled || res.Used != 1 {
+		t.Errorf("disabled = %+v", res)
+	}
+	if res, _ := st.Validate(lic.ID, "a"); res.Reason != "not_found" {
+		t.Errorf("Validate by ID = %+v", res)
+	}
+	if res, _ := st.Validate(lic.Key, ""); res.Reason != "invalid_request" {
+		t.Errorf("Validate without server = %+v", res)
+	}
+}
+
+func testBindings(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	lic := mustCreate(t, st, 2, "", CreateOptions{})
+	mustActivate(t, st, lic.Key, "a")
+	mustActivate(t, st, lic.Key, "b")
+
+	if err := st.Unbind(lic.ID, "zzz"); !errors.Is(err, ErrNotBound) {
+		t.Errorf("Unbind(unknown) err = %v", err)
+	}
+	if err := st.Unbind(lic.Key, " a "); err != nil {
+		t.Fatalf("Unbind: %v", err)
+	}
+	if res := mustActivate(t, st, lic.Key, "c"); !res.OK || !res.NewlyBound || res.Used != 2 {
+		t.Errorf("after unbind = %+v", res)
+	}
+	n, err := st.ResetBindings(lic.ID)
+	if err != nil || n != 2 {
+		t.Errorf("ResetBindings = %d, %v", n, err)
+	}
+	if n, _ := st.ResetBindings(lic.ID); n != 0 {
+		t.Errorf("second ResetBindings = %d", n)
+	}
+	if info, _ := st.GetInfo(lic.ID); info.Used != 0 || len(info.Bindings) != 0 {
+		t.Errorf("after reset = %+v", info)
+	}
+}
+
+func testReaping(t *testing.T, open opener) {
+	st := open(t, Options{KeySecret: testSecret, DefaultIdleTTL: 24 * time.Hour})
+	old := time.Now().UTC().Add(-72 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	idA := strings.Repeat("a", 32)
+	idB := strings.Repeat("b", 32)
+	importJSONL(t, st,
+		fmt.Sprintf(`{"license":{"id":%q,"limit":2,"enabled":true},"bindings":[{"server_id":"stale","last_seen":%q},{"server_id":"fresh","last_seen":%q}]}`, idA, old, recent),
+		fmt.Sprintf(`{"license":{"id":%q,"limit":1,"enabled":true,"idle_days":7},"bindings":[{"server_id":"kept","last_seen":%q}]}`, idB, old),
+	)
+	n, err := st.ReapStale()
+	if err != nil || n != 1 {
+		t.Fatalf("ReapStale = %d, %v; want 1", n, err)
+	}
+	reaped, err := st.ListReaped(idA)
+	if err != nil || len(reaped) != 1 || reaped[0].ServerID != "stale" || reaped[0].ReapedAt.IsZero() {
+		t.Errorf("ListReaped = %+v, %v", reaped, err)
+	}
+	if info, _ := st.GetInfo(idA); info.Used != 1 || info.Bindings[0].ServerID != "fresh" {
+		t.Errorf("after reap = %+v", info)
+	}
+	if info, _ := st.GetInfo(idB); info.Used != 1 {
+		t.Errorf("license with its own TTL was reaped: %+v", info)
+	}
+	if n, _ := st.ReapStale(); n != 0 {
+		t.Errorf("second ReapStale = %d", n)
+	}
+	if evs, _ := st.ListAudit(AuditFilter{Action: AuditReap}); len(evs) != 1 || evs[0].ServerID != "stale" {
+		t.Errorf("reap audit = %+v", evs)
+	}
+
+	// Activation reaps lazily so a stale seat frees room immediately.
+	key, err := license.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	importJSONL(t, st, fmt.Sprintf(`{"license":{"key":%q,"limit":1,"enabled":true},"bindings":[{"server_id":"gone","last_seen":%q}]}`, key, old))
+	if res := mustActivate(t, st, key, "new"); !res.OK || res.Used != 1 {
+		t.Errorf("activation with stale seat = %+v", res)
+	}
+	if reaped, _ := st.ListReaped(key); len(reaped) != 1 || reaped[0].ServerID != "gone" {
+		t.Errorf("lazy reap = %+v", reaped)
+	}
+}
+
+func testFloating(t *testing.T, open opener) {
+	bus := events.NewBus()
+	ch, cancel := bus.Subscribe(16)
+	defer cancel()
+	st := open(t, Options{KeySecret: testSecret, LeaseTTL: time.Hour, Events: bus})
+	lapsed := time.Now().UTC().Add(-2 * time.Hour).Format(time.RFC3339)
+	key, err := license.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	importJSONL(t, st, fmt.Sprintf(`{"license":{"key":%q,"limit":1,"enabled":true,"mode":"floating"},"bindings":[{"server_id":"old","last_seen":%q}]}`, key, lapsed))
+
+	// A lapsed lease holds no seat even before anything reaps it.
+	if info, err := st.GetInfo(key); err != nil || info.Used != 0 || len(info.Bindings) != 0 {
+		t.Errorf("info with a lapsed lease = %+v, %v", info, err)
+	}
+	if page, err := st.QueryLicenses(LicenseFilter{Status: FilterUnused}, "", 10); err != nil || len(page.Items) != 1 {
+		t.Errorf("unused licenses = %+v, %v", page, err)
+	}
+	if all, err := st.ListLicenses(); err != nil || len(all) != 1 || all[0].Used != 0 {
+		t.Errorf("ListLicenses = %+v, %v", all, err)
+	}
+
+	// Only unexpired leases count: the lapsed one makes room.
+	res := mustActivate(t, st, key, "a")
+	if !res.OK || res.Used != 1 || res.LeaseExpiresAt == nil || time.Until(*res.LeaseExpiresAt) <= 59*time.Minute {
+		t.Fatalf("activate = %+v", res)
+	}
+	if res := mustActivate(t, st, key, "b"); res.OK || res.Reason != "limit_reached" {
+		t.Errorf("second lease = %+v", res)
+	}
+	if res, _ := st.Validate(key, "a"); !res.OK || res.LeaseExpiresAt == nil {
+		t.Errorf("heartbeat = %+v", res)
+	}
+	if res, _ := st.Validate(key, "old"); res.OK || res.Reason != "not_bound" {
+		t.Errorf("heartbeat on lapsed lease = %+v", res)
+	}
+	if st.Unbind(key, "a") != nil {
+		t.Error("releasing a lease failed")
+	}
+	if res := mustActivate(t, st, key, "b"); !res.OK {
+		t.Errorf("lease after release = %+v", res)
+	}
+
+	// A lease that lapses while the client still heartbeats is not renewed.
+	id := license.KeyID(testSecret, key)
+	overwrite := func(line string) {
+		t.Helper()
+		if _, err := st.Import(strings.NewReader(line), ImportOptions{OnConflict: ConflictOverwrite}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	overwrite(fmt.Sprintf(`{"license":{"id":%q,"limit":1,"enabled":true,"mode":"floating"},"bindings":[{"server_id":"b","last_seen":%q}]}`, id, lapsed))
+	if res, _ := st.Validate(key, "b"); res.OK || res.Reason != "not_bound" || res.Used != 0 {
+		t.Errorf("heartbeat after lapse = %+v", res)
+	}
+	overwrite(fmt.Sprintf(`{"license":{"id":%q,"limit":1,"enabled":true,"mode":"floating"},"bindings":[{"server_id":"b","last_seen":%q}]}`, id, lapsed))
+	if n, err := st.ReapStale(); err != nil || n != 0 {
+		t.Errorf("ReapStale = %d, %v; lapsed leases are not counted", n, err)
+	}
+
+	// Leases come and go silently: only the refused lease was announced.
+	if reaped, _ := st.ListReaped(key); len(reaped) != 0 {
+		t.Errorf("reaped = %+v", reaped)
+	}
+	for _, action := range []string{AuditBind, AuditReap} {
+		if evs, _ := st.ListAudit(AuditFilter{Key: id, Action: action}); len(evs) != 0 {
+			t.Errorf("%s audit = %+v", action, evs)
+		}
+	}
+	for len(ch) > 0 {
+		if ev := <-ch; ev.Type != events.LimitReached || ev.ServerID != "b" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+
+	// Switching to node-locked keeps the seat however long it is idle.
+	overwrite(fmt.Sprintf(`{"license":{"id":%q,"limit":1,"enabled":true,"mode":"floating"},"bindings":[{"server_id":"b","last_seen":%q}]}`, id, lapsed))
+	lic, err := st.SetMode(id, ModeNodeLocked)
+	if err != nil || lic.Floating() || lic.Mode != ModeNodeLocked {
+		t.Fatalf("SetMode = %+v, %v", lic, err)
+	}
+	if res, _ := st.Validate(key, "b"); !res.OK || res.LeaseExpiresAt != nil {
+		t.Errorf("node-locked heartbeat = %+v", res)
+	}
+	if res := mustActivate(t, st, key, "c"); res.OK {
+		t.Errorf("node-locked activation over limit = %+v", res)
+	}
+	if lic, err := st.SetMode(key, ModeFloating); err != nil || !lic.Floating() {
+		t.Errorf("SetMode(floating) = %+v, %v", lic, err)
+	}
+	if _, err := st.SetMode(id, "metered"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	if _, err := st.SetMode("KYPAQET-AAAA-BBBB-CCCC-DDDD", ModeFloating); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetMode(missing) err = %v", err)
+	}
+	if evs, _ := st.ListAudit(AuditFilter{Action: AuditSetMode}); len(evs) != 2 || evs[1].Detail != "floating -> node_locked" {
+		t.Errorf("set_mode audit = %+v", evs)
+	}
+}
+
+func testQuery(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	var lics []License
+	for i := 0; i < 7; i++ {
+		lics = append(lics, mustCreate(t, st, 1, fmt.Sprintf("note-%d", i), CreateOptions{}))
+	}
+	mustActivate(t, st, lics[1].Key, "srv")
+	st.SetEnabled(lics[2].ID, false)
+
+	all, err := st.QueryLicenses(LicenseFilter{}, "", 100)
+	if err != nil || len(all.Items) != 7 || all.Next != "" || all.Prev != "" {
+		t.Fatalf("full page = %+v, %v", all, err)
+	}
+	for i := 1; i < len(all.Items); i++ {
+		if all.Items[i].License.CreatedAt.After(all.Items[i-1].License.CreatedAt) {
+			t.Fatal("not newest first")
+		}
+	}
+	ids := func(items []LicenseInfo) []string {
+		var out []string
+		for _, it := range items {
+			out = append(out, it.License.ID)
+		}
+		return out
+	}
+	want := ids(all.Items)
+
+	// Walk forward in pages of 3, then back again.
+	var got []string
+	var pages []LicensePage
+	cursor := ""
+	for {
+		page, err := st.QueryLicenses(LicenseFilter{}, cursor, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+		got = append(got, ids(page.Items)...)
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) || len(pages) != 3 || pages[0].Prev != "" {
+		t.Fatalf("forward walk = %v (%d pages), want %v", got, len(pages), want)
+	}
+	back, err := st.QueryLicenses(LicenseFilter{}, pages[2].Prev, 3)
+	if err != nil || fmt.Sprint(ids(back.Items)) != fmt.Sprint(want[3:6]) || back.Prev == "" || back.Next == "" {
+		t.Errorf("back to page 2 = %+v, %v", back, err)
+	}
+	first, err := st.QueryLicenses(LicenseFilter{}, back.Prev, 3)
+	if err != nil || fmt.Sprint(ids(first.Items)) != fmt.Sprint(want[:3]) || first.Prev != "" {
+		t.Errorf("back to page 1 = %+v, %v", first, err)
+	}
+
+	count := func(f LicenseFilter) int {
+		t.Helper()
+		page, err := st.QueryLicenses(f, "", 100)
+		if err != nil {
+			t.Fatalf("QueryLicenses(%+v): %v", f, err)
+		}
+		return len(page.Items)
+	}
+	for f, n := range map[*LicenseFilter]int{
+		{Status: FilterEnabled}:                    6,
+		{Status: FilterDisabled}:                   1,
+		{Status: FilterFull}:                       1,
+		{Status: FilterUnused}:                     6,
+		{Search: "NOTE-3"}:                         1,
+		{Search: "note"}:                           7,
+		{Search: lics[4].Key}:                      1,
+		{Search: lics[4].Fingerprint[8:]}:          1,
+		{IdleSince: time.Now().Add(time.Hour)}:     7,
+		{IdleSince: time.Now().Add(-time.Hour)}:    6,
+		{Status: FilterEnabled, Search: "note-2"}:  0,
+		{CustomerID: "nobody"}:                     0,
+		{Status: FilterUnused, Search: "note-1"}:   0,
+		{Status: FilterDisabled, Search: "note-2"}: 1,
+	} {
+		if got := count(*f); got != n {
+			t.Errorf("QueryLicenses(%+v) = %d items, want %d", *f, got, n)
+		}
+	}
+	if _, err := st.QueryLicenses(LicenseFilter{Status: "bogus"}, "", 10); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("unknown status accepted")
+	}
+	if _, err := st.QueryLicenses(LicenseFilter{}, "x:y", 10); !errors.Is(err, ErrInvalidQuery) {
+		t.Error("invalid cursor accepted")
+	}
+}
+
+func testBatches(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, err := st.CreateLicenses(0, 1, "", CreateOptions{}); err == nil {
+		t.Error("empty batch accepted")
+	}
+	if _, err := st.CreateLicenses(MaxBatchSize+1, 1, "", CreateOptions{}); err == nil {
+		t.Error("oversized batch accepted")
+	}
+	lics, err := st.CreateLicenses(3, 2, "reseller", CreateOptions{})
+	if err != nil || len(lics) != 3 {
+		t.Fatalf("CreateLicenses = %d, %v", len(lics), err)
+	}
+	batchID := lics[0].BatchID
+	for _, lic := range lics {
+		if lic.BatchID != batchID || !license.IsKey(lic.Key) || lic.Limit != 2 {
+			t.Errorf("batch license = %+v", lic)
+		}
+	}
+	mustCreate(t, st, 1, "single", CreateOptions{})
+	batches, err := st.ListBatches()
+	if err != nil || len(batches) != 1 {
+		t.Fatalf("ListBatches = %+v, %v", batches, err)
+	}
+	if b := batches[0]; b.ID != batchID || b.Size != 3 || b.Enabled != 3 || b.Note != "reseller" || b.Limit != 2 {
+		t.Errorf("batch = %+v", b)
+	}
+	st.SetEnabled(lics[0].ID, false)
+	if n, err := st.SetBatchEnabled(batchID, false); err != nil || n != 2 {
+		t.Errorf("SetBatchEnabled = %d, %v; want 2", n, err)
+	}
+	if batches, _ := st.ListBatches(); batches[0].Enabled != 0 {
+		t.Errorf("enabled after disable = %d", batches[0].Enabled)
+	}
+	if _, err := st.SetBatchEnabled("0000000000000000", true); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("unknown batch err = %v", err)
+	}
+	var buf bytes.Buffer
+	if n, err := st.Export(&buf, ExportOptions{Format: FormatCSV, BatchID: batchID}); err != nil || n != 3 {
+		t.Errorf("Export batch = %d, %v", n, err)
+	}
+	if _, err := st.Export(&buf, ExportOptions{BatchID: "0000000000000000"}); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("Export unknown batch err = %v", err)
+	}
+}
+
+func testCustomers(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, err := st.CreateCustomer(Customer{Name: "  "}); err == nil {
+		t.Error("nameless customer accepted")
+	}
+	zed, _ := st.CreateCustomer(Customer{Name: "Zed"})
+	c, err := st.CreateCustomer(Customer{Name: " alpha ", Username: "@alpha", Contact: " mail ", Notes: "n"})
+	if err != nil || c.Name != "alpha" || c.Username != "alpha" || c.Contact != "mail" || c.ID == "" {
+		t.Fatalf("CreateCustomer = %+v, %v", c, err)
+	}
+	if got, err := st.GetCustomer(strings.ToUpper(c.ID)); err != nil || got.Name != "alpha" {
+		t.Errorf("GetCustomer = %+v, %v", got, err)
+	}
+	if _, err := st.GetCustomer("nope"); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("GetCustomer(unknown) err = %v", err)
+	}
+	if list, _ := st.ListCustomers(); len(list) != 2 || list[0].ID != c.ID || list[1].ID != zed.ID {
+		t.Errorf("ListCustomers = %+v", list)
+	}
+
+	a := mustCreate(t, st, 1, "", CreateOptions{CustomerID: c.ID})
+	b := mustCreate(t, st, 1, "", CreateOptions{})
+	if lic, err := st.SetLicenseCustomer(b.Key, c.ID); err != nil || lic.CustomerID != c.ID {
+		t.Errorf("SetLicenseCustomer = %+v, %v", lic, err)
+	}
+	if _, err := st.SetLicenseCustomer(b.ID, "nope"); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("link to unknown customer err = %v", err)
+	}
+	if n, err := st.SetCustomerEnabled(c.ID, false); err != nil || n != 2 {
+		t.Errorf("SetCustomerEnabled = %d, %v", n, err)
+	}
+	if n, _ := st.SetCustomerEnabled(c.ID, false); n != 0 {
+		t.Errorf("second SetCustomerEnabled = %d", n)
+	}
+	if _, err := st.SetCustomerEnabled("nope", true); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("SetCustomerEnabled(unknown) err = %v", err)
+	}
+	if lic, _ := st.SetLicenseCustomer(a.ID, ""); lic.CustomerID != "" {
+		t.Errorf("unlink = %+v", lic)
+	}
+	page, _ := st.QueryLicenses(LicenseFilter{CustomerID: c.ID}, "", 10)
+	if len(page.Items) != 1 || page.Items[0].License.ID != b.ID || page.Items[0].License.Enabled {
+		t.Errorf("customer licenses = %+v", page.Items)
+	}
+
+	// Imports link to existing customers only, and leave nothing behind
+	// when one is unknown.
+	k1, _ := license.NewKey()
+	k2, _ := license.NewKey()
+	_, err = st.Import(strings.NewReader(fmt.Sprintf(`{"license":{"key":%q,"limit":1,"enabled":true,"customer_id":%q}}
+{"license":{"key":%q,"limit":1,"enabled":true,"customer_id":"nope"}}`, k1, c.ID, k2)), ImportOptions{Format: FormatJSONL})
+	if !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("import with unknown customer err = %v", err)
+	}
+	if _, err := st.GetInfo(k1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("partial import left %s: %v", k1, err)
+	}
+	importJSONL(t, st, fmt.Sprintf(`{"license":{"key":%q,"limit":1,"enabled":true,"customer_id":" %s "}}`, k1, strings.ToUpper(zed.ID)))
+	if page, _ := st.QueryLicenses(LicenseFilter{CustomerID: zed.ID}, "", 10); len(page.Items) != 1 {
+		t.Errorf("imported customer licenses = %+v", page.Items)
+	}
+}
+
+func testAdmins(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, err := st.PutAdmin(Admin{ChatID: 1, Role: "god"}); err == nil {
+		t.Error("unknown role accepted")
+	}
+	if _, err := st.PutAdmin(Admin{Role: RoleOwner}); err == nil {
+		t.Error("zero chat accepted")
+	}
+	if _, err := st.GetAdmin(1); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("GetAdmin(missing) err = %v", err)
+	}
+	st.PutAdmin(Admin{ChatID: 3, Role: RoleReadOnly, Name: "reader"})
+	st.PutAdmin(Admin{ChatID: 2, Role: RoleOperator})
+	owner, err := st.PutAdmin(Admin{ChatID: 1, Role: RoleOwner, Name: " boss "})
+	if err != nil || owner.Name != "boss" || owner.AddedAt.IsZero() {
+		t.Fatalf("PutAdmin = %+v, %v", owner, err)
+	}
+	list, _ := st.ListAdmins()
+	if len(list) != 3 || list[0].ChatID != 1 || list[1].ChatID != 2 || list[2].ChatID != 3 {
+		t.Errorf("ListAdmins = %+v", list)
+	}
+
+	muted := []string{"bound"}
+	if a, err := st.SetAdminMuted(3, muted); err != nil || len(a.Muted) != 1 {
+		t.Errorf("SetAdminMuted = %+v, %v", a, err)
+	}
+	muted[0] = "changed"
+	a, err := st.PutAdmin(Admin{ChatID: 3, Role: RoleOperator})
+	if err != nil || a.Name != "reader" || len(a.Muted) != 1 || a.Muted[0] != "bound" {
+		t.Errorf("role change = %+v, %v", a, err)
+	}
+	a.Muted[0] = "aliased"
+	if a, _ := st.GetAdmin(3); a.Role != RoleOperator || a.Muted[0] != "bound" {
+		t.Errorf("GetAdmin = %+v", a)
+	}
+	if _, err := st.SetAdminMuted(9, nil); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("SetAdminMuted(missing) err = %v", err)
+	}
+	if err := st.RemoveAdmin(2); err != nil {
+		t.Errorf("RemoveAdmin: %v", err)
+	}
+	if err := st.RemoveAdmin(2); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("RemoveAdmin(missing) err = %v", err)
+	}
+}
+
+func testTokens(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, _, err := st.CreateAPIToken(" "); err == nil {
+		t.Error("nameless token accepted")
+	}
+	token, tok, err := st.CreateAPIToken("billing")
+	if err != nil || !strings.HasPrefix(token, "kpt_") || tok.Name != "billing" {
+		t.Fatalf("CreateAPIToken = %q, %+v, %v", token, tok, err)
+	}
+	got, err := st.AuthAPIToken(" " + token + " ")
+	if err != nil || got.ID != tok.ID || got.LastUsed.IsZero() {
+		t.Errorf("AuthAPIToken = %+v, %v", got, err)
+	}
+	if _, err := st.AuthAPIToken(token + "x"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("wrong token err = %v", err)
+	}
+	if list, _ := st.ListAPITokens(); len(list) != 1 || list[0].ID != tok.ID || list[0].LastUsed.IsZero() {
+		t.Errorf("ListAPITokens = %+v", list)
+	}
+	if err := st.RevokeAPIToken(tok.ID); err != nil {
+		t.Errorf("RevokeAPIToken: %v", err)
+	}
+	if err := st.RevokeAPIToken(tok.ID); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("second revoke err = %v", err)
+	}
+	if _, err := st.AuthAPIToken(token); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("revoked token err = %v", err)
+	}
+}
+
+func testAudit(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	start := time.Now().UTC()
+	lic := mustCreate(t, st.As("tg:1"), 1, "n", CreateOptions{})
+	st.As("api:x").SetLimit(lic.ID, 3)
+	mustActivate(t, st, lic.Key, "srv")
+	other := mustCreate(t, st, 1, "", CreateOptions{})
+
+	evs, err := st.ListAudit(AuditFilter{Key: lic.Key})
+	if err != nil || len(evs) != 3 {
+		t.Fatalf("ListAudit(key) = %+v, %v", evs, err)
+	}
+	for i, want := range []AuditEvent{
+		{Actor: "system", Action: AuditBind, Key: lic.ID, ServerID: "srv"},
+		{Actor: "api:x", Action: AuditSetLimit, Key: lic.ID, Detail: "1 -> 3"},
+		{Actor: "tg:1", Action: AuditCreate, Key: lic.ID, Detail: `limit=1 note="n"`},
+	} {
+		got := evs[i]
+		if got.At.Before(start) {
+			t.Errorf("event %d time %v before start", i, got.At)
+		}
+		got.At = time.Time{}
+		if got != want {
+			t.Errorf("event %d = %+v, want %+v", i, got, want)
+		}
+	}
+	if evs, _ := st.ListAudit(AuditFilter{Action: AuditCreate}); len(evs) != 2 || evs[0].Key != other.ID {
+		t.Errorf("ListAudit(action) = %+v", evs)
+	}
+	if evs, _ := st.ListAudit(AuditFilter{Limit: 1}); len(evs) != 1 || evs[0].Key != other.ID {
+		t.Errorf("ListAudit(limit) = %+v", evs)
+	}
+	if evs, _ := st.ListAudit(AuditFilter{Since: time.Now().Add(time.Hour)}); len(evs) != 0 {
+		t.Errorf("ListAudit(future) = %+v", evs)
+	}
+}
+
+func testWebhooks(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	if _, err := st.CreateWebhook("ftp://x", nil); err == nil {
+		t.Error("ftp url accepted")
+	}
+	if _, err := st.CreateWebhook("https://example.com", []string{"nope"}); err == nil {
+		t.Error("unknown event accepted")
+	}
+	all, err := st.CreateWebhook("https://example.com/all", nil)
+	if err != nil || !strings.HasPrefix(all.Secret, "whsec_") {
+		t.Fatalf("CreateWebhook = %+v, %v", all, err)
+	}
+	bound, _ := st.CreateWebhook("https://example.com/bound", []string{string(events.Bound)})
+	if list, _ := st.ListWebhooks(); len(list) != 2 || list[0].ID != all.ID || list[1].Events[0] != "bound" {
+		t.Errorf("ListWebhooks = %+v", list)
+	}
+
+	lic := mustCreate(t, st, 1, "n", CreateOptions{})
+	mustActivate(t, st, lic.Key, "a")
+	mustActivate(t, st, lic.Key, "a")
+	mustActivate(t, st, lic.Key, "b")
+	mustActivate(t, st, "not-a-key", "b")
+
+	now := time.Now().UTC()
+	due, err := st.DueDeliveries(now, 0)
+	if err != nil || len(due) != 3 {
+		t.Fatalf("DueDeliveries = %+v, %v; want bound x2 and limit_reached", due, err)
+	}
+	byHook := map[string]WebhookDelivery{}
+	for _, d := range due {
+		if d.State != DeliveryPending || d.Attempts != 0 {
+			t.Errorf("new delivery = %+v", d)
+		}
+		byHook[d.WebhookID+" "+d.Event] = d
+	}
+	allBound, hookBound, allLimit := byHook[all.ID+" bound"], byHook[bound.ID+" bound"], byHook[all.ID+" limit_reached"]
+	if allBound.ID == "" || hookBound.ID == "" || allLimit.ID == "" {
+		t.Fatalf("deliveries = %+v", due)
+	}
+	if !strings.Contains(string(allBound.Payload), `"license_id":"`+lic.ID+`"`) || !strings.Contains(string(allBound.Payload), `"id":"`+allBound.ID+`"`) {
+		t.Errorf("payload = %s", allBound.Payload)
+	}
+	if d, _ := st.DueDeliveries(now, 1); len(d) != 1 || d[0].ID != due[0].ID {
+		t.Errorf("DueDeliveries(limit 1) = %+v", d)
+	}
+
+	if err := st.RecordDelivery(hookBound.ID, DeliveryAttempt{Status: 500, Error: "boom", Retry: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RecordDelivery(allBound.ID, DeliveryAttempt{OK: true, Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RecordDelivery(allLimit.ID, DeliveryAttempt{Status: 410}); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := st.DueDeliveries(now, 0); len(d) != 0 {
+		t.Errorf("due after attempts = %+v", d)
+	}
+	if d, _ := st.DueDeliveries(now.Add(2*time.Hour), 0); len(d) != 1 || d[0].ID != hookBound.ID || d[0].Attempts != 1 || d[0].LastStatus != 500 || d[0].LastError != "boom" {
+		t.Errorf("retry = %+v", d)
+	}
+	log, _ := st.ListDeliveries(all.ID, 0)
+	if len(log) != 2 || log[0].ID != allLimit.ID || log[0].State != DeliveryFailed || log[1].State != DeliveryDelivered {
+		t.Errorf("ListDeliveries = %+v", log)
+	}
+	if log, _ := st.ListDeliveries(bound.ID, 0); len(log) != 1 || log[0].State != DeliveryPending {
+		t.Errorf("ListDeliveries(bound) = %+v", log)
+	}
+	if err := st.RecordDelivery("zz", DeliveryAttempt{}); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("RecordDelivery(bad id) err = %v", err)
+	}
+	if err := st.RecordDelivery("00000000000000ff", DeliveryAttempt{}); err != nil {
+		t.Errorf("RecordDelivery(missing) err = %v", err)
+	}
+
+	if n, _ := st.PruneDeliveries(now); n != 0 {
+		t.Errorf("PruneDeliveries(before attempts) = %d", n)
+	}
+	if n, err := st.PruneDeliveries(time.Now().Add(time.Minute)); err != nil || n != 2 {
+		t.Errorf("PruneDeliveries = %d, %v; want 2", n, err)
+	}
+	if err := st.DeleteWebhook(bound.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DeleteWebhook(bound.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("second delete err = %v", err)
+	}
+	if d, _ := st.DueDeliveries(now.Add(2*time.Hour), 0); len(d) != 0 {
+		t.Errorf("deliveries of deleted webhook = %+v", d)
+	}
+}
+
+func testEvents(t *testing.T, open opener) {
+	bus := events.NewBus()
+	ch, cancel := bus.Subscribe(16)
+	defer cancel()
+	st := open(t, Options{KeySecret: testSecret, Events: bus})
+	lic := mustCreate(t, st, 1, "n", CreateOptions{})
+	mustActivate(t, st.As("api"), lic.Key, "a")
+	mustActivate(t, st, lic.Key, "a")
+	mustActivate(t, st, lic.Key, "b")
+	st.SetEnabled(lic.ID, false)
+	mustActivate(t, st, lic.Key, "a")
+	mustActivate(t, st, "junk", "c")
+
+	want := []events.Event{
+		{Type: events.Bound, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: "n", ServerID: "a", Used: 1, Limit: 1, Actor: "api"},
+		{Type: events.LimitReached, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: "n", ServerID: "b", Used: 1, Limit: 1, Actor: "system"},
+		{Type: events.Disabled, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: "n", ServerID: "a", Limit: 1, Actor: "system"},
+		{Type: events.NotFound, ServerID: "c", Actor: "system"},
+	}
+	for i, w := range want {
+		select {
+		case got := <-ch:
+			if got.At.IsZero() {
+				t.Errorf("event %d has no time", i)
+			}
+			got.At = time.Time{}
+			if got != w {
+				t.Errorf("event %d = %+v, want %+v", i, got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not published", i)
+		}
+	}
+	select {
+	case ev := <-ch:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func testExportImport(t *testing.T, open opener) {
+	src := openDefault(t, open)
+	a := mustCreate(t, src, 2, "alpha, \"quoted\"", CreateOptions{ValidFor: time.Hour, GraceDays: 2})
+	b := mustCreate(t, src, 1, "", CreateOptions{})
+	mustActivate(t, src, a.Key, "srv-1")
+	mustActivate(t, src, a.Key, "srv-2")
+	src.SetEnabled(b.ID, false)
+
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := src.Export(&buf, ExportOptions{Format: format})
+			if err != nil || n != 2 {
+				t.Fatalf("Export = %d, %v", n, err)
+			}
+			if strings.Contains(buf.String(), a.Key) {
+				t.Error("export contains a plain key")
+			}
+			data := buf.Bytes()
+
+			dst := openDefault(t, open)
+			res, err := dst.As("cli").Import(bytes.NewReader(data), ImportOptions{Format: format})
+			if err != nil || res != (ImportResult{Created: 2}) {
+				t.Fatalf("Import = %+v, %v", res, err)
+			}
+			info, err := dst.GetInfo(a.Key)
+			if err != nil || info.Used != 2 || info.License.Note != a.Note || info.License.GraceDays != 2 || a.ExpiresAt.Sub(info.License.ExpiresAt) >= time.Second {
+				t.Errorf("imported = %+v, %v", info, err)
+			}
+			if info, _ := dst.GetInfo(b.ID); info.License.Enabled {
+				t.Error("disabled license imported enabled")
+			}
+			if res := mustActivate(t, dst, a.Key, "srv-3"); res.Reason != "limit_reached" {
+				t.Errorf("imported bindings not counted: %+v", res)
+			}
+			if evs, _ := dst.ListAudit(AuditFilter{Action: AuditImport}); len(evs) != 2 || evs[0].Actor != "cli" {
+				t.Errorf("import audit = %+v", evs)
+			}
+
+			if _, err := dst.Import(bytes.NewReader(data), ImportOptions{Format: format}); !errors.Is(err, ErrConflict) {
+				t.Errorf("conflicting import err = %v", err)
+			}
+			if res, err := dst.Import(bytes.NewReader(data), ImportOptions{Format: format, OnConflict: ConflictSkip}); err != nil || res != (ImportResult{Skipped: 2}) {
+				t.Errorf("skip import = %+v, %v", res, err)
+			}
+			dst.ResetBindings(a.ID)
+			if res, err := dst.Import(bytes.NewReader(data), ImportOptions{Format: format, OnConflict: ConflictOverwrite}); err != nil || res != (ImportResult{Overwritten: 2}) {
+				t.Errorf("overwrite import = %+v, %v", res, err)
+			}
+			if info, _ := dst.GetInfo(a.ID); info.Used != 2 {
+				t.Errorf("overwrite did not restore bindings: %+v", info)
+			}
+			if list, _ := dst.ListLicenses(); len(list) != 2 {
+				t.Errorf("licenses after overwrite = %d", len(list))
+			}
+		})
+	}
+
+	// A failing record rolls back the whole import.
+	dst := openDefault(t, open)
+	bad := fmt.Sprintf("{\"license\":{\"key\":%q,\"limit\":1}}\n{\"license\":{\"id\":\"xyz\",\"limit\":1}}\n", a.Key)
+	if _, err := dst.Import(strings.NewReader(bad), ImportOptions{}); err == nil {
+		t.Fatal("invalid record accepted")
+	}
+	if list, _ := dst.ListLicenses(); len(list) != 0 {
+		t.Errorf("partial import kept %d licenses", len(list))
+	}
+	if _, err := dst.Import(strings.NewReader(""), ImportOptions{OnConflict: "merge"}); err == nil {
+		t.Error("unknown conflict policy accepted")
+	}
+	var buf bytes.Buffer
+	if n, err := src.Backup(&buf); err != nil || n == 0 || int64(buf.Len()) != n {
+		t.Errorf("Backup = %d, %v (%d bytes written)", n, err, buf.Len())
+	}
+}
+
+func testConcurrency(t *testing.T, open opener) {
+	st := openDefault(t, open)
+	lic := mustCreate(t, st, 5, "", CreateOptions{})
+	var wg sync.WaitGroup
+	results := make(chan ActivateResult, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := st.Activate(lic.Key, fmt.Sprintf("srv-%d", i))
+			if err != nil {
+				t.Error(err)
+			}
+			results <- res
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+	ok := 0
+	for res := range results {
+		if res.OK {
+			ok++
+		} else if res.Reason != "limit_reached" {
+			t.Errorf("unexpected result %+v", res)
+		}
+	}
+	if info, _ := st.GetInfo(lic.ID); ok != 5 || info.Used != 5 {
+		t.Errorf("%d activations succeeded, %d seats used; want 5", ok, info.Used)
+	}
+}
+
+func TestConvertBBolt(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.db"), filepath.Join(dir, "dst.sqlite")
+	opts := Options{KeySecret: testSecret}
+	old, err := OpenBBolt(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := mustCreate(t, old, 2, "alpha", CreateOptions{ValidFor: time.Hour})
+	mustCreate(t, old, 1, "beta", CreateOptions{})
+	if _, err := old.CreateWebhook("https://example.com/hook", nil); err != nil {
+		t.Fatal(err)
+	}
+	mustActivate(t, old, a.Key, "srv-1")
+	token, _, _ := old.CreateAPIToken("ci")
+	old.PutAdmin(Admin{ChatID: 42, Role: RoleOwner, Muted: []string{"activated"}})
+	var before bytes.Buffer
+	old.Export(&before, ExportOptions{})
+	audit, _ := old.ListAudit(AuditFilter{})
+	deliveries, _ := old.DueDeliveries(time.Now().Add(time.Minute), 0)
+	old.Close()
+
+	res, err := ConvertBBolt(src, dst, opts)
+	if err != nil {
+		t.Fatalf("ConvertBBolt: %v", err)
+	}
+	if res.Licenses != 2 || res.Bindings != 1 || res.Tokens != 1 || res.Admins != 1 || res.Webhooks != 1 || res.Deliveries != len(deliveries) || res.Audit != len(audit) {
+		t.Errorf("result = %+v", res)
+	}
+	if _, err := ConvertBBolt(src, dst, opts); err == nil {
+		t.Error("converted into a non-empty database")
+	}
+
+	st, err := OpenSQLite(dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	var after bytes.Buffer
+	st.Export(&after, ExportOptions{})
+	if before.String() != after.String() {
+		t.Errorf("export differs:\n%s\n%s", before.String(), after.String())
+	}
+	if _, err := st.AuthAPIToken(token); err != nil {
+		t.Errorf("token after convert: %v", err)
+	}
+	if adm, err := st.GetAdmin(42); err != nil || len(adm.Muted) != 1 {
+		t.Errorf("admin = %+v, %v", adm, err)
+	}
+	if got, _ := st.ListAudit(AuditFilter{}); len(got) != len(audit) || got[0] != audit[0] {
+		t.Errorf("audit = %+v, want %+v", got, audit)
+	}
+	if got, _ := st.DueDeliveries(time.Now().Add(time.Minute), 0); len(got) != 1 || got[0].ID != deliveries[0].ID {
+		t.Errorf("deliveries = %+v, want %+v", got, deliveries)
+	}
+	if res := mustActivate(t, st, a.Key, "srv-2"); !res.OK || res.Used != 2 {
+		t.Errorf("activate after convert = %+v", res)
+	}
+}
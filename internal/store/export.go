@@ -0,0 +1,241 @@
+package store
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+)
+
+// csvColumns is the CSV export header. Import matches columns by name, so
+// spreadsheets may reorder or drop the optional ones.
+var csvColumns = []string{
+	"id", "key", "fingerprint", "limit", "note", "enabled", "created_at",
+	"expires_at", "grace_days", "idle_days", "batch_id", "customer_id", "mode", "used", "servers",
+}
+
+// csvServerSep joins server IDs in the "servers" column. CSV only keeps the
+// IDs; use JSON Lines to keep binding timestamps.
+const csvServerSep = ";"
+
+// recordWriter encodes licenses in one of the export formats.
+type recordWriter interface {
+	Write(info LicenseInfo) error
+	Flush() error
+}
+
+func newRecordWriter(w io.Writer, format string) (recordWriter, error) {
+	switch format {
+	case FormatJSONL, "":
+		bw := bufio.NewWriter(w)
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type jsonlWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(info LicenseInfo) error { return j.enc.Encode(info) }
+func (j *jsonlWriter) Flush() error                 { return j.w.Flush() }
+
+type csvWriter struct{ w *csv.Writer }
+
+func (c *csvWriter) Write(info LicenseInfo) error {
+	lic := info.License
+	servers := make([]string, len(info.Bindings))
+	for i, b := range info.Bindings {
+		servers[i] = b.ServerID
+	}
+	return c.w.Write([]string{
+		lic.ID, lic.Key, lic.Fingerprint, strconv.Itoa(lic.Limit), lic.Note,
+		strconv.FormatBool(lic.Enabled), formatTime(lic.CreatedAt), formatTime(lic.ExpiresAt),
+		strconv.Itoa(lic.GraceDays), strconv.Itoa(lic.IdleDays), lic.BatchID, lic.CustomerID, lic.Mode, strconv.Itoa(info.Used),
+		strings.Join(servers, csvServerSep),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// recordReader returns the next record, or io.EOF after the last one.
+type recordReader func() (LicenseInfo, error)
+
+func newRecordReader(r io.Reader, format string) (recordReader, error) {
+	switch format {
+	case FormatJSONL, "":
+		dec := json.NewDecoder(r)
+		n := 0
+		return func() (LicenseInfo, error) {
+			var info LicenseInfo
+			if err := dec.Decode(&info); err != nil {
+				if err == io.EOF {
+					return LicenseInfo{}, err
+				}
+				return LicenseInfo{}, fmt.Errorf("record %d: %w", n+1, err)
+			}
+			n++
+			return info, nil
+		}, nil
+	case FormatCSV:
+		return newCSVReader(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func newCSVReader(r io.Reader) (recordReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return func() (LicenseInfo, error) { return LicenseInfo{}, io.EOF }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["limit"]; !ok {
+		return nil, fmt.Errorf("csv: missing limit column")
+	}
+	_, hasID := col["id"]
+	_, hasKey := col["key"]
+	if !hasID && !hasKey {
+		return nil, fmt.Errorf("csv: need an id or key column")
+	}
+	now := time.Now().UTC()
+	return func() (LicenseInfo, error) {
+		row, err := cr.Read()
+		if err != nil {
+			return LicenseInfo{}, err
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		fail := func(name string, err error) (LicenseInfo, error) {
+			return LicenseInfo{}, fmt.Errorf("line %d: %s: %w", line, name, err)
+		}
+		lic := License{ID: get("id"), Key: get("key"), Fingerprint: get("fingerprint"), Note: get("note"), BatchID: get("batch_id"), CustomerID: get("customer_id"), Mode: get("mode"), Enabled: true}
+		if lic.Limit, err = strconv.Atoi(get("limit")); err != nil {
+			return fail("limit", err)
+		}
+		if v := get("enabled"); v != "" {
+			if lic.Enabled, err = strconv.ParseBool(v); err != nil {
+				return fail("enabled", err)
+			}
+		}
+		if lic.CreatedAt, err = parseTime(get("created_at")); err != nil {
+			return fail("created_at", err)
+		}
+		if lic.ExpiresAt, err = parseTime(get("expires_at")); err != nil {
+			return fail("expires_at", err)
+		}
+		if lic.GraceDays, err = atoiOrZero(get("grace_days")); err != nil {
+			return fail("grace_days", err)
+		}
+		if lic.IdleDays, err = atoiOrZero(get("idle_days")); err != nil {
+			return fail("idle_days", err)
+		}
+		info := LicenseInfo{License: lic}
+		for _, sid := range strings.Split(get("servers"), csvServerSep) {
+			if sid = strings.TrimSpace(sid); sid != "" {
+				info.Bindings = append(info.Bindings, ServerBinding{ServerID: sid, FirstSeen: now, LastSeen: now, SeenCount: 1})
+			}
+		}
+		return info, nil
+	}, nil
+}
+
+// importRecord validates a record and resolves its ID, hashing the plain key
+// when one is given.
+func importRecord(secret []byte, info LicenseInfo) (License, []ServerBinding, error) {
+	lic := info.License
+	if lic.Key != "" {
+		if !license.IsKey(lic.Key) {
+			return License{}, nil, fmt.Errorf("invalid key %q", lic.Key)
+		}
+		id := license.KeyID(secret, lic.Key)
+		if lic.ID != "" && !strings.EqualFold(lic.ID, id) {
+			return License{}, nil, fmt.Errorf("id %s does not match key (different key secret?)", lic.ID)
+		}
+		lic.ID = id
+		lic.Fingerprint = license.Fingerprint(lic.Key)
+		lic.Key = ""
+	}
+	lic.ID = strings.ToLower(lic.ID)
+	if b, err := hex.DecodeString(lic.ID); err != nil || len(b) != 16 {
+		return License{}, nil, fmt.Errorf("invalid id %q", lic.ID)
+	}
+	if lic.Limit <= 0 {
+		return License{}, nil, fmt.Errorf("%s: limit must be > 0", lic.ID)
+	}
+	if lic.GraceDays < 0 || lic.IdleDays < 0 {
+		return License{}, nil, fmt.Errorf("%s: days must be >= 0", lic.ID)
+	}
+	if err := checkMode(lic.Mode); err != nil {
+		return License{}, nil, fmt.Errorf("%s: %w", lic.ID, err)
+	}
+	// Stored the way CreateLicense stores it, so customer filters match.
+	lic.CustomerID = strings.ToLower(strings.TrimSpace(lic.CustomerID))
+	if lic.CreatedAt.IsZero() {
+		lic.CreatedAt = time.Now().UTC()
+	}
+	seen := map[string]bool{}
+	var bindings []ServerBinding
+	for _, b := range info.Bindings {
+		b.ServerID = strings.TrimSpace(b.ServerID)
+		if b.ServerID == "" || len(b.ServerID) > 128 || seen[b.ServerID] {
+			continue
+		}
+		seen[b.ServerID] = true
+		bindings = append(bindings, b)
+	}
+	return lic, bindings, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func atoiOrZero(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
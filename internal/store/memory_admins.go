@@ -0,0 +1,104 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *MemoryStore) GetAdmin(chatID int64) (Admin, error) {
+	var a Admin
+	err := s.do("GetAdmin", func(st *memState) error {
+		var ok bool
+		if a, ok = st.admins[chatID]; !ok {
+			return ErrAdminNotFound
+		}
+		a.Muted = slices.Clone(a.Muted)
+		return nil
+	})
+	if err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
+
+func (s *MemoryStore) ListAdmins() ([]Admin, error) {
+	var out []Admin
+	_ = s.do("ListAdmins", func(st *memState) error {
+		for _, a := range st.admins {
+			a.Muted = slices.Clone(a.Muted)
+			out = append(out, a)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if RoleLevel(out[i].Role) != RoleLevel(out[j].Role) {
+			return RoleLevel(out[i].Role) > RoleLevel(out[j].Role)
+		}
+		return out[i].AddedAt.Before(out[j].AddedAt)
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) PutAdmin(a Admin) (Admin, error) {
+	if RoleLevel(a.Role) == 0 {
+		return Admin{}, fmt.Errorf("unknown role %q", a.Role)
+	}
+	if a.ChatID == 0 {
+		return Admin{}, fmt.Errorf("chat id is required")
+	}
+	a.Name = strings.TrimSpace(a.Name)
+	_ = s.do("PutAdmin", func(st *memState) error {
+		if old, ok := st.admins[a.ChatID]; ok {
+			if old.Role == a.Role && (a.Name == "" || old.Name == a.Name) {
+				a = old
+				return nil
+			}
+			a.AddedAt = old.AddedAt
+			a.Muted = old.Muted
+			if a.Name == "" {
+				a.Name = old.Name
+			}
+		} else {
+			a.Muted = slices.Clone(a.Muted)
+		}
+		if a.AddedAt.IsZero() {
+			a.AddedAt = time.Now().UTC()
+		}
+		st.admins[a.ChatID] = a
+		s.audit(st, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("set %d role=%s", a.ChatID, a.Role)})
+		return nil
+	})
+	a.Muted = slices.Clone(a.Muted)
+	return a, nil
+}
+
+func (s *MemoryStore) RemoveAdmin(chatID int64) error {
+	return s.do("RemoveAdmin", func(st *memState) error {
+		if _, ok := st.admins[chatID]; !ok {
+			return ErrAdminNotFound
+		}
+		delete(st.admins, chatID)
+		s.audit(st, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("removed %d", chatID)})
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetAdminMuted(chatID int64, muted []string) (Admin, error) {
+	var a Admin
+	if err := s.do("SetAdminMuted", func(st *memState) error {
+		var ok bool
+		if a, ok = st.admins[chatID]; !ok {
+			return ErrAdminNotFound
+		}
+		a.Muted = slices.Clone(muted)
+		st.admins[chatID] = a
+		return nil
+	}); err != nil {
+		return Admin{}, err
+	}
+	a.Muted = slices.Clone(a.Muted)
+	return a, nil
+}
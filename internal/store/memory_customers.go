@@ -0,0 +1,104 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *MemoryStore) CreateCustomer(c Customer) (Customer, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Username = strings.TrimPrefix(strings.TrimSpace(c.Username), "@")
+	c.Contact = strings.TrimSpace(c.Contact)
+	c.Notes = strings.TrimSpace(c.Notes)
+	if c.Name == "" {
+		return Customer{}, fmt.Errorf("name is required")
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Customer{}, err
+	}
+	c.ID = hex.EncodeToString(id)
+	c.CreatedAt = time.Now().UTC()
+	_ = s.do("CreateCustomer", func(st *memState) error {
+		st.customers[c.ID] = c
+		s.audit(st, AuditEvent{Action: AuditCustomer, Detail: fmt.Sprintf("created %s %q", c.ID, c.Name)})
+		return nil
+	})
+	return c, nil
+}
+
+func (s *MemoryStore) GetCustomer(id string) (Customer, error) {
+	var c Customer
+	err := s.do("GetCustomer", func(st *memState) error {
+		var err error
+		c, err = st.customer(id)
+		return err
+	})
+	if err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *MemoryStore) ListCustomers() ([]Customer, error) {
+	var out []Customer
+	_ = s.do("ListCustomers", func(st *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(st.customers)) {
+			out = append(out, st.customers[id])
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+	return out, nil
+}
+
+func (s *MemoryStore) SetLicenseCustomer(key string, customerID string) (License, error) {
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	return s.change("SetLicenseCustomer", key, func(st *memState, lic *License) error {
+		detail := "unlinked"
+		if customerID != "" {
+			c, err := st.customer(customerID)
+			if err != nil {
+				return err
+			}
+			detail = fmt.Sprintf("linked to %s %q", c.ID, c.Name)
+		}
+		lic.CustomerID = customerID
+		s.audit(st, AuditEvent{Action: AuditCustomer, Key: lic.ID, Detail: detail})
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetCustomerEnabled(customerID string, enabled bool) (int, error) {
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	changed := 0
+	if err := s.do("SetCustomerEnabled", func(st *memState) error {
+		if _, err := st.customer(customerID); err != nil {
+			return err
+		}
+		for _, id := range slices.Sorted(maps.Keys(st.licenses)) {
+			lic := st.licenses[id]
+			if lic.CustomerID != customerID || lic.Enabled == enabled {
+				continue
+			}
+			lic.Enabled = enabled
+			st.putLicense(lic)
+			s.audit(st, AuditEvent{Action: action, Key: lic.ID, Detail: "customer " + customerID})
+			changed++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
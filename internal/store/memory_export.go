@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *MemoryStore) CreateLicenses(n, limit int, note string, opts CreateOptions) ([]License, error) {
+	if n <= 0 || n > MaxBatchSize {
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxBatchSize)
+	}
+	batchID, err := newBatchID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	lics := make([]License, n)
+	for i := range lics {
+		lic, err := s.opts.newLicense(limit, note, opts, now)
+		if err != nil {
+			return nil, err
+		}
+		lic.BatchID = batchID
+		lics[i] = lic
+	}
+	if err := s.atomic("CreateLicenses", func(st *memState) error {
+		for _, lic := range lics {
+			if err := s.insertLicense(st, lic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return lics, nil
+}
+
+func (s *MemoryStore) ListBatches() ([]Batch, error) {
+	byID := map[string]*Batch{}
+	_ = s.do("ListBatches", func(st *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(st.licenses)) {
+			lic := st.licenses[id]
+			if lic.BatchID == "" {
+				continue
+			}
+			b := byID[lic.BatchID]
+			if b == nil {
+				b = &Batch{ID: lic.BatchID, Note: lic.Note, Limit: lic.Limit, CreatedAt: lic.CreatedAt}
+				byID[lic.BatchID] = b
+			}
+			b.Size++
+			if lic.Enabled {
+				b.Enabled++
+			}
+		}
+		return nil
+	})
+	out := make([]Batch, 0, len(byID))
+	for _, b := range byID {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryStore) SetBatchEnabled(batchID string, enabled bool) (int, error) {
+	batchID = strings.ToLower(strings.TrimSpace(batchID))
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	changed := 0
+	if err := s.do("SetBatchEnabled", func(st *memState) error {
+		found := false
+		for _, id := range slices.Sorted(maps.Keys(st.licenses)) {
+			lic := st.licenses[id]
+			if lic.BatchID != batchID {
+				continue
+			}
+			found = true
+			if lic.Enabled == enabled {
+				continue
+			}
+			lic.Enabled = enabled
+			st.putLicense(lic)
+			s.audit(st, AuditEvent{Action: action, Key: lic.ID, Detail: "batch " + batchID})
+			changed++
+		}
+		if !found {
+			return ErrBatchNotFound
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// Backup writes every license with its bindings as JSON Lines (see
+// Export); a memory store has no database file to copy.
+func (s *MemoryStore) Backup(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	_, err := s.Export(cw, ExportOptions{Format: FormatJSONL})
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (s *MemoryStore) Export(w io.Writer, opts ExportOptions) (int, error) {
+	rw, err := newRecordWriter(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	var infos []LicenseInfo
+	_ = s.do("Export", func(st *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(st.licenses)) {
+			lic := st.licenses[id]
+			if opts.BatchID != "" && lic.BatchID != opts.BatchID {
+				continue
+			}
+			bindings := st.bindingList(id)
+			infos = append(infos, LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings})
+		}
+		return nil
+	})
+	if len(infos) == 0 && opts.BatchID != "" {
+		return 0, ErrBatchNotFound
+	}
+	for _, info := range infos {
+		if err := rw.Write(info); err != nil {
+			return 0, err
+		}
+	}
+	return len(infos), rw.Flush()
+}
+
+func (s *MemoryStore) Import(r io.Reader, opts ImportOptions) (ImportResult, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictFail
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return ImportResult{}, fmt.Errorf("unknown conflict policy %q", opts.OnConflict)
+	}
+	next, err := newRecordReader(r, opts.Format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var res ImportResult
+	err = s.atomic("Import", func(st *memState) error {
+		for {
+			info, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			lic, bindings, err := importRecord(s.opts.KeySecret, info)
+			if err != nil {
+				return err
+			}
+			action := "created"
+			if _, ok := st.licenses[lic.ID]; ok {
+				switch opts.OnConflict {
+				case ConflictSkip:
+					res.Skipped++
+					continue
+				case ConflictFail:
+					return fmt.Errorf("%s: %w", lic.ID, ErrConflict)
+				}
+				action = "overwritten"
+			}
+			if lic.CustomerID != "" {
+				if _, err := st.customer(lic.CustomerID); err != nil {
+					return fmt.Errorf("%s: %w", lic.ID, err)
+				}
+			}
+			usage := make(map[string]ServerBinding, len(bindings))
+			for _, b := range bindings {
+				usage[b.ServerID] = b
+			}
+			st.bindings[lic.ID] = usage
+			st.putLicense(lic)
+			if action == "created" {
+				res.Created++
+			} else {
+				res.Overwritten++
+			}
+			s.audit(st, AuditEvent{Action: AuditImport, Key: lic.ID, Detail: fmt.Sprintf("%s, %d bindings", action, len(bindings))})
+		}
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return res, nil
+}
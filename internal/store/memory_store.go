@@ -0,0 +1,634 @@
+package store
+
+import (
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+	"kypaqet-license-bot/internal/license"
+)
+
+// MemoryStore keeps everything in process memory. It behaves like
+// BBoltStore and is meant for tests and throwaway runs; nothing survives
+// Close.
+type MemoryStore struct {
+	*memDB
+	actor string
+}
+
+// memDB is shared by a MemoryStore and its As views.
+type memDB struct {
+	mu   sync.Mutex
+	opts Options
+	st   memState
+}
+
+// memState is the whole database. Every value is stored by copy so callers
+// never alias it.
+type memState struct {
+	licenses  map[string]License
+	bindings  map[string]map[string]ServerBinding
+	reaped    map[string][]ReapedBinding // oldest first
+	audit     []AuditEvent               // oldest first
+	tokens    map[string]APIToken        // by token hash
+	admins    map[int64]Admin
+	customers map[string]Customer
+	webhooks  map[string]Webhook
+	outbox    []WebhookDelivery // in enqueue order
+	outboxSeq uint64
+}
+
+// NewMemory returns an empty in-memory store. A random key secret is used
+// when opts has none.
+func NewMemory(opts Options) *MemoryStore {
+	if len(opts.KeySecret) == 0 {
+		opts.KeySecret = make([]byte, 32)
+		_, _ = rand.Read(opts.KeySecret)
+	}
+	return &MemoryStore{
+		memDB: &memDB{opts: opts, st: memState{
+			licenses:  map[string]License{},
+			bindings:  map[string]map[string]ServerBinding{},
+			reaped:    map[string][]ReapedBinding{},
+			tokens:    map[string]APIToken{},
+			admins:    map[int64]Admin{},
+			customers: map[string]Customer{},
+			webhooks:  map[string]Webhook{},
+		}},
+		actor: "system",
+	}
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+// As returns a view of the store that records actor in the audit log.
+func (s *MemoryStore) As(actor string) Store {
+	return &MemoryStore{memDB: s.memDB, actor: actor}
+}
+
+// do runs fn with the store locked, reporting it to ObserveTx like a
+// BBoltStore transaction.
+func (s *MemoryStore) do(op string, fn func(st *memState) error) error {
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx(op, time.Since(start)) }(time.Now())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(&s.st)
+}
+
+// atomic is do for operations that may fail half way: on error every
+// change fn made is rolled back.
+func (s *MemoryStore) atomic(op string, fn func(st *memState) error) error {
+	return s.do(op, func(st *memState) error {
+		saved := st.clone()
+		if err := fn(st); err != nil {
+			*st = saved
+			return err
+		}
+		return nil
+	})
+}
+
+func (st memState) clone() memState {
+	cp := st
+	cp.licenses = maps.Clone(st.licenses)
+	cp.bindings = make(map[string]map[string]ServerBinding, len(st.bindings))
+	for id, b := range st.bindings {
+		cp.bindings[id] = maps.Clone(b)
+	}
+	cp.reaped = make(map[string][]ReapedBinding, len(st.reaped))
+	for id, r := range st.reaped {
+		cp.reaped[id] = slices.Clone(r)
+	}
+	cp.audit = slices.Clone(st.audit)
+	cp.tokens = maps.Clone(st.tokens)
+	cp.admins = maps.Clone(st.admins)
+	cp.customers = maps.Clone(st.customers)
+	cp.webhooks = maps.Clone(st.webhooks)
+	cp.outbox = slices.Clone(st.outbox)
+	return cp
+}
+
+func (s *MemoryStore) audit(st *memState, ev AuditEvent) {
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	if ev.Actor == "" {
+		ev.Actor = s.actor
+	}
+	st.audit = append(st.audit, ev)
+}
+
+func (st *memState) license(id string) (License, error) {
+	lic, ok := st.licenses[id]
+	if !ok {
+		return License{}, ErrNotFound
+	}
+	return lic, nil
+}
+
+func (st *memState) putLicense(lic License) {
+	lic.Key = ""
+	st.licenses[lic.ID] = lic
+}
+
+// bindingList returns the bindings of a license, most recently seen first.
+func (st *memState) bindingList(id string) []ServerBinding {
+	b := st.bindings[id]
+	if b == nil {
+		return nil
+	}
+	out := make([]ServerBinding, 0, len(b))
+	for _, sb := range b {
+		out = append(out, sb)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+func (st *memState) customer(id string) (Customer, error) {
+	c, ok := st.customers[strings.ToLower(strings.TrimSpace(id))]
+	if !ok {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return c, nil
+}
+
+func (s *MemoryStore) insertLicense(st *memState, lic License) error {
+	if _, ok := st.licenses[lic.ID]; ok {
+		return fmt.Errorf("key collision, try again")
+	}
+	if lic.CustomerID != "" {
+		if _, err := st.customer(lic.CustomerID); err != nil {
+			return err
+		}
+	}
+	st.putLicense(lic)
+	st.bindings[lic.ID] = map[string]ServerBinding{}
+	detail := fmt.Sprintf("limit=%d note=%q", lic.Limit, lic.Note)
+	if lic.BatchID != "" {
+		detail += " batch=" + lic.BatchID
+	}
+	s.audit(st, AuditEvent{Action: AuditCreate, Key: lic.ID, Detail: detail})
+	return nil
+}
+
+func (s *MemoryStore) CreateLicense(limit int, note string, opts CreateOptions) (License, error) {
+	lic, err := s.opts.newLicense(limit, note, opts, time.Now().UTC())
+	if err != nil {
+		return License{}, err
+	}
+	if err := s.do("CreateLicense", func(st *memState) error {
+		return s.insertLicense(st, lic)
+	}); err != nil {
+		return License{}, err
+	}
+	return lic, nil
+}
+
+// change applies fn to a stored license and writes it back unless fn fails.
+func (s *MemoryStore) change(op, key string, fn func(st *memState, lic *License) error) (License, error) {
+	id := s.opts.ref(key)
+	var updated License
+	if err := s.do(op, func(st *memState) error {
+		lic, err := st.license(id)
+		if err != nil {
+			return err
+		}
+		if err := fn(st, &lic); err != nil {
+			return err
+		}
+		st.putLicense(lic)
+		updated = lic
+		return nil
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *MemoryStore) SetLimit(key string, limit int) (License, error) {
+	if limit <= 0 {
+		return License{}, fmt.Errorf("limit must be > 0")
+	}
+	return s.change("SetLimit", key, func(st *memState, lic *License) error {
+		old := lic.Limit
+		lic.Limit = limit
+		s.audit(st, AuditEvent{Action: AuditSetLimit, Key: lic.ID, Detail: fmt.Sprintf("%d -> %d", old, limit)})
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetEnabled(key string, enabled bool) (License, error) {
+	return s.change("SetEnabled", key, func(st *memState, lic *License) error {
+		lic.Enabled = enabled
+		action := AuditDisable
+		if enabled {
+			action = AuditEnable
+		}
+		s.audit(st, AuditEvent{Action: action, Key: lic.ID})
+		return nil
+	})
+}
+
+func (s *MemoryStore) Renew(key string, d time.Duration) (License, error) {
+	if d <= 0 {
+		return License{}, fmt.Errorf("duration must be > 0")
+	}
+	now := time.Now().UTC()
+	return s.change("Renew", key, func(st *memState, lic *License) error {
+		from := lic.ExpiresAt
+		if from.Before(now) {
+			from = now
+		}
+		lic.ExpiresAt = from.Add(d)
+		s.audit(st, AuditEvent{Action: AuditRenew, Key: lic.ID, Detail: "expires " + lic.ExpiresAt.Format(time.RFC3339)})
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetIdleDays(key string, days int) (License, error) {
+	if days < 0 {
+		return License{}, fmt.Errorf("days must be >= 0")
+	}
+	return s.change("SetIdleDays", key, func(st *memState, lic *License) error {
+		lic.IdleDays = days
+		s.audit(st, AuditEvent{Action: AuditSetIdle, Key: lic.ID, Detail: fmt.Sprintf("%d days", days)})
+		return nil
+	})
+}
+
+func (s *MemoryStore) SetMode(key string, mode string) (License, error) {
+	if err := checkMode(mode); err != nil {
+		return License{}, err
+	}
+	return s.change("SetMode", key, func(st *memState, lic *License) error {
+		s.audit(st, AuditEvent{Action: AuditSetMode, Key: lic.ID, Detail: fmt.Sprintf("%s -> %s", modeName(lic.Mode), modeName(mode))})
+		lic.Mode = mode
+		return nil
+	})
+}
+
+func (s *MemoryStore) Unbind(key string, serverID string) error {
+	id := s.opts.ref(key)
+	serverID = strings.TrimSpace(serverID)
+	return s.do("Unbind", func(st *memState) error {
+		if _, err := st.license(id); err != nil {
+			return err
+		}
+		if _, ok := st.bindings[id][serverID]; !ok {
+			return ErrNotBound
+		}
+		delete(st.bindings[id], serverID)
+		s.audit(st, AuditEvent{Action: AuditUnbind, Key: id, ServerID: serverID})
+		return nil
+	})
+}
+
+func (s *MemoryStore) ResetBindings(key string) (int, error) {
+	id := s.opts.ref(key)
+	n := 0
+	if err := s.do("ResetBindings", func(st *memState) error {
+		if _, err := st.license(id); err != nil {
+			return err
+		}
+		n = len(st.bindings[id])
+		st.bindings[id] = map[string]ServerBinding{}
+		s.audit(st, AuditEvent{Action: AuditReset, Key: id, Detail: fmt.Sprintf("released %d", n)})
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) ReapStale() (int, error) {
+	now := time.Now().UTC()
+	total := 0
+	err := s.do("ReapStale", func(st *memState) error {
+		for _, id := range slices.Sorted(maps.Keys(st.licenses)) {
+			total += s.reapLicense(st, st.licenses[id], now, "")
+		}
+		return nil
+	})
+	return total, err
+}
+
+// reapLicense releases bindings idle past the license TTL, except keep, and
+// returns how many it recorded as reaped; lapsed leases are just deleted.
+func (s *MemoryStore) reapLicense(st *memState, lic License, now time.Time, keep string) int {
+	ttl := s.opts.idleTTL(lic)
+	if ttl <= 0 {
+		return 0
+	}
+	usage := st.bindings[lic.ID]
+	n := 0
+	for _, sid := range slices.Sorted(maps.Keys(usage)) {
+		sb := usage[sid]
+		if sid == keep || now.Sub(sb.LastSeen) <= ttl {
+			continue
+		}
+		delete(usage, sid)
+		if lic.Floating() {
+			continue
+		}
+		st.reaped[lic.ID] = append(st.reaped[lic.ID], ReapedBinding{ServerBinding: sb, ReapedAt: now})
+		s.audit(st, AuditEvent{Action: AuditReap, Key: lic.ID, ServerID: sid, Detail: "last seen " + sb.LastSeen.Format(time.RFC3339)})
+		n++
+	}
+	return n
+}
+
+func (s *MemoryStore) ListReaped(key string) ([]ReapedBinding, error) {
+	id := s.opts.ref(key)
+	var out []ReapedBinding
+	err := s.do("ListReaped", func(st *memState) error {
+		if _, err := st.license(id); err != nil {
+			return err
+		}
+		r := st.reaped[id]
+		for i := len(r) - 1; i >= 0; i-- {
+			out = append(out, r[i])
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *MemoryStore) GetInfo(key string) (LicenseInfo, error) {
+	id := s.opts.ref(key)
+	var info LicenseInfo
+	now := time.Now().UTC()
+	if err := s.do("GetInfo", func(st *memState) error {
+		lic, err := st.license(id)
+		if err != nil {
+			return err
+		}
+		bindings := s.opts.live(lic, st.bindingList(id), now)
+		info = LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings}
+		return nil
+	}); err != nil {
+		return LicenseInfo{}, err
+	}
+	return info, nil
+}
+
+func (s *MemoryStore) ListLicenses() ([]LicenseInfo, error) {
+	var out []LicenseInfo
+	now := time.Now().UTC()
+	err := s.do("ListLicenses", func(st *memState) error {
+		for _, id := range st.newestFirst() {
+			lic := st.licenses[id]
+			out = append(out, LicenseInfo{License: lic, Used: len(s.opts.live(lic, st.bindingList(id), now))})
+		}
+		return nil
+	})
+	return out, err
+}
+
+// createdOrder returns license IDs in creation index order, oldest first.
+func (st *memState) createdOrder() []string {
+	keys := make([]string, 0, len(st.licenses))
+	for _, lic := range st.licenses {
+		keys = append(keys, string(createdKey(lic)))
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k[8:]
+	}
+	return keys
+}
+
+func (st *memState) newestFirst() []string {
+	ids := st.createdOrder()
+	slices.Reverse(ids)
+	return ids
+}
+
+func (s *MemoryStore) QueryLicenses(filter LicenseFilter, cursor string, limit int) (LicensePage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	now := time.Now().UTC()
+	match, err := newMatcher(filter, s.opts.ref)
+	if err != nil {
+		return LicensePage{}, err
+	}
+	from, backward, err := parseCursor(cursor)
+	if err != nil {
+		return LicensePage{}, err
+	}
+	var page LicensePage
+	err = s.do("QueryLicenses", func(st *memState) error {
+		ids := st.createdOrder()
+		i, step := len(ids)-1, -1
+		if backward {
+			step = 1
+		}
+		if from != "" {
+			lic, err := st.license(from)
+			if err != nil {
+				return err
+			}
+			// Start just past the cursor license in the scan direction.
+			ck := string(createdKey(lic))
+			i = sort.Search(len(ids), func(j int) bool {
+				k := string(createdKey(st.licenses[ids[j]]))
+				if backward {
+					return k > ck
+				}
+				return k >= ck
+			})
+			if !backward {
+				i--
+			}
+		}
+		var items []LicenseInfo
+		for ; i >= 0 && i < len(ids) && len(items) <= limit; i += step {
+			id := ids[i]
+			lic := st.licenses[id]
+			bindings := s.opts.live(lic, st.bindingList(id), now)
+			info := LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings}
+			if match(info) {
+				info.Bindings = nil
+				items = append(items, info)
+			}
+		}
+		page = newPage(items, limit, cursor, backward)
+		return nil
+	})
+	if err != nil {
+		return LicensePage{}, err
+	}
+	return page, nil
+}
+
+func (s *MemoryStore) Activate(key string, serverID string) (ActivateResult, error) {
+	serverID = strings.TrimSpace(serverID)
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason == "not_found" {
+		s.emit(events.Event{Type: events.NotFound, ServerID: serverID})
+	}
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
+	}
+
+	var res ActivateResult
+	var ev *events.Event
+	now := time.Now().UTC()
+	activate := func(st *memState) {
+		lic, err := st.license(id)
+		if err != nil {
+			res = ActivateResult{OK: false, Reason: "not_found"}
+			ev = &events.Event{Type: events.NotFound, Fingerprint: license.Fingerprint(key), ServerID: serverID}
+			return
+		}
+		newEvent := func(t events.Type, used int) *events.Event {
+			return &events.Event{Type: t, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: lic.Note, ServerID: serverID, Used: used, Limit: lic.Limit}
+		}
+		if !lic.Enabled {
+			res = ActivateResult{OK: false, Reason: "disabled", Limit: lic.Limit}
+			ev = newEvent(events.Disabled, 0)
+			return
+		}
+		status := lic.Status(now)
+		if status == StatusExpired {
+			res = ActivateResult{OK: false, Reason: "expired", Enabled: true, Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
+			return
+		}
+		if st.bindings[id] == nil {
+			st.bindings[id] = map[string]ServerBinding{}
+		}
+		usage := st.bindings[id]
+		s.reapLicense(st, lic, now, serverID)
+
+		sb, existing := usage[serverID]
+		if existing {
+			sb.LastSeen = now
+			sb.SeenCount++
+		} else {
+			if used := len(usage); used >= lic.Limit {
+				res = ActivateResult{OK: false, Reason: "limit_reached", Enabled: true, Used: used, Limit: lic.Limit}
+				ev = newEvent(events.LimitReached, used)
+				return
+			}
+			sb = ServerBinding{ServerID: serverID, FirstSeen: now, LastSeen: now, SeenCount: 1}
+		}
+		usage[serverID] = sb
+		used := len(usage)
+		if !existing && !lic.Floating() {
+			s.audit(st, AuditEvent{Action: AuditBind, Key: id, ServerID: serverID})
+			ev = newEvent(events.Bound, used)
+		}
+		reason := "ok"
+		if status == StatusInGrace {
+			reason = "in_grace"
+		}
+		res = ActivateResult{OK: true, Reason: reason, Enabled: true, Used: used, Limit: lic.Limit, NewlyBound: !existing,
+			ExpiresAt: expiresAt(lic), LeaseExpiresAt: s.opts.leaseExpiry(lic, now)}
+	}
+	_ = s.do("Activate", func(st *memState) error {
+		activate(st)
+		if ev != nil {
+			s.stamp(ev)
+			s.enqueueWebhooks(st, *ev)
+		}
+		return nil
+	})
+	if ev != nil {
+		s.opts.Events.Publish(*ev)
+	}
+	return res, nil
+}
+
+func (s *MemoryStore) stamp(ev *events.Event) {
+	ev.At = time.Now().UTC()
+	ev.Actor = s.actor
+}
+
+func (s *MemoryStore) emit(ev events.Event) {
+	s.stamp(&ev)
+	s.opts.Events.Publish(ev)
+}
+
+func (s *MemoryStore) Validate(key string, serverID string) (ActivateResult, error) {
+	serverID = strings.TrimSpace(serverID)
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
+	}
+
+	var res ActivateResult
+	now := time.Now().UTC()
+	_ = s.do("Validate", func(st *memState) error {
+		lic, err := st.license(id)
+		if err != nil {
+			res = ActivateResult{OK: false, Reason: "not_found"}
+			return nil
+		}
+		if lic.Floating() {
+			// A lapsed lease, this server's included, is gone.
+			s.reapLicense(st, lic, now, "")
+		}
+		usage := st.bindings[id]
+		sb, existing := usage[serverID]
+		res = ActivateResult{Enabled: lic.Enabled, Used: len(usage), Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
+		status := lic.Status(now)
+		switch {
+		case !lic.Enabled:
+			res.Reason = "disabled"
+			return nil
+		case status == StatusExpired:
+			res.Reason = "expired"
+			return nil
+		case !existing:
+			res.Reason = "not_bound"
+			return nil
+		}
+		sb.LastSeen = now
+		sb.SeenCount++
+		usage[serverID] = sb
+		res.OK = true
+		res.Reason = "ok"
+		res.LeaseExpiresAt = s.opts.leaseExpiry(lic, now)
+		if status == StatusInGrace {
+			res.Reason = "in_grace"
+		}
+		return nil
+	})
+	return res, nil
+}
+
+func (s *MemoryStore) ListAudit(filter AuditFilter) ([]AuditEvent, error) {
+	if filter.Key != "" {
+		filter.Key = s.opts.ref(filter.Key)
+	}
+	var out []AuditEvent
+	err := s.do("ListAudit", func(st *memState) error {
+		for i := len(st.audit) - 1; i >= 0; i-- {
+			ev := st.audit[i]
+			if !filter.Since.IsZero() && ev.At.Before(filter.Since) {
+				break
+			}
+			if filter.Key != "" && ev.Key != filter.Key {
+				continue
+			}
+			if filter.Action != "" && ev.Action != filter.Action {
+				continue
+			}
+			out = append(out, ev)
+			if filter.Limit > 0 && len(out) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return out, err
+}
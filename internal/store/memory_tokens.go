@@ -0,0 +1,77 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (s *MemoryStore) CreateAPIToken(name string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, fmt.Errorf("name is required")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, err
+	}
+	token := "kpt_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	h := hashToken(token)
+	t := APIToken{ID: h[:12], Name: name, CreatedAt: time.Now().UTC()}
+	_ = s.do("CreateAPIToken", func(st *memState) error {
+		st.tokens[h] = t
+		s.audit(st, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("created %s (%s)", t.ID, name)})
+		return nil
+	})
+	return token, t, nil
+}
+
+func (s *MemoryStore) ListAPITokens() ([]APIToken, error) {
+	var out []APIToken
+	_ = s.do("ListAPITokens", func(st *memState) error {
+		for _, t := range st.tokens {
+			out = append(out, t)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryStore) RevokeAPIToken(id string) error {
+	return s.do("RevokeAPIToken", func(st *memState) error {
+		for h, t := range st.tokens {
+			if t.ID != id {
+				continue
+			}
+			delete(st.tokens, h)
+			s.audit(st, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("revoked %s (%s)", t.ID, t.Name)})
+			return nil
+		}
+		return ErrUnauthorized
+	})
+}
+
+func (s *MemoryStore) AuthAPIToken(token string) (APIToken, error) {
+	h := hashToken(strings.TrimSpace(token))
+	var t APIToken
+	err := s.do("AuthAPIToken", func(st *memState) error {
+		var ok bool
+		if t, ok = st.tokens[h]; !ok {
+			return ErrUnauthorized
+		}
+		now := time.Now().UTC()
+		if now.Sub(t.LastUsed) >= tokenTouchEvery {
+			t.LastUsed = now
+			st.tokens[h] = t
+		}
+		return nil
+	})
+	if err != nil {
+		return APIToken{}, err
+	}
+	return t, nil
+}
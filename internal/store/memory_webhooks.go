@@ -0,0 +1,160 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+)
+
+func (s *MemoryStore) CreateWebhook(rawURL string, eventTypes []string) (Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid url %q", rawURL)
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(events.Types, events.Type(t)) {
+			return Webhook{}, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return Webhook{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	w := Webhook{ID: hex.EncodeToString(id), URL: u.String(), Secret: "whsec_" + hex.EncodeToString(secret), Events: slices.Clone(eventTypes), CreatedAt: time.Now().UTC()}
+	_ = s.do("CreateWebhook", func(st *memState) error {
+		st.webhooks[w.ID] = w
+		s.audit(st, AuditEvent{Action: AuditWebhook, Detail: fmt.Sprintf("created %s %s", w.ID, w.URL)})
+		return nil
+	})
+	w.Events = slices.Clone(w.Events)
+	return w, nil
+}
+
+func (s *MemoryStore) ListWebhooks() ([]Webhook, error) {
+	var out []Webhook
+	_ = s.do("ListWebhooks", func(st *memState) error {
+		for _, w := range st.webhooks {
+			w.Events = slices.Clone(w.Events)
+			out = append(out, w)
+		}
+		return nil
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryStore) DeleteWebhook(id string) error {
+	return s.do("DeleteWebhook", func(st *memState) error {
+		if _, ok := st.webhooks[id]; !ok {
+			return ErrWebhookNotFound
+		}
+		delete(st.webhooks, id)
+		st.outbox = slices.DeleteFunc(st.outbox, func(d WebhookDelivery) bool { return d.WebhookID == id })
+		s.audit(st, AuditEvent{Action: AuditWebhook, Detail: "deleted " + id})
+		return nil
+	})
+}
+
+// enqueueWebhooks queues ev for every subscribed webhook, in webhook ID
+// order like the bbolt outbox.
+func (s *MemoryStore) enqueueWebhooks(st *memState, ev events.Event) {
+	ids := make([]string, 0, len(st.webhooks))
+	for id := range st.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		w := st.webhooks[id]
+		if !w.Wants(string(ev.Type)) {
+			continue
+		}
+		st.outboxSeq++
+		d := WebhookDelivery{ID: hex.EncodeToString(seqKey(st.outboxSeq)), WebhookID: w.ID, Event: string(ev.Type), State: DeliveryPending, NextAttempt: ev.At, CreatedAt: ev.At, UpdatedAt: ev.At}
+		d.Payload, _ = json.Marshal(webhookPayload{
+			ID: d.ID, Type: d.Event, At: ev.At, LicenseID: ev.LicenseID, Fingerprint: ev.Fingerprint,
+			Note: ev.Note, ServerID: ev.ServerID, Used: ev.Used, Limit: ev.Limit,
+		})
+		st.outbox = append(st.outbox, d)
+	}
+}
+
+func (s *MemoryStore) DueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	_ = s.do("DueDeliveries", func(st *memState) error {
+		for _, d := range st.outbox {
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+			if d.State == DeliveryPending && !d.NextAttempt.After(now) {
+				out = append(out, d)
+			}
+		}
+		return nil
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) RecordDelivery(id string, attempt DeliveryAttempt) error {
+	if _, err := hex.DecodeString(id); err != nil {
+		return ErrWebhookNotFound
+	}
+	return s.do("RecordDelivery", func(st *memState) error {
+		i := slices.IndexFunc(st.outbox, func(d WebhookDelivery) bool { return d.ID == id })
+		if i < 0 {
+			// The webhook was deleted while the delivery was in flight.
+			return nil
+		}
+		d := &st.outbox[i]
+		d.Attempts++
+		d.LastStatus = attempt.Status
+		d.LastError = attempt.Error
+		d.UpdatedAt = time.Now().UTC()
+		switch {
+		case attempt.OK:
+			d.State = DeliveryDelivered
+		case attempt.Retry.IsZero():
+			d.State = DeliveryFailed
+		default:
+			d.NextAttempt = attempt.Retry
+		}
+		return nil
+	})
+}
+
+func (s *MemoryStore) ListDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	_ = s.do("ListDeliveries", func(st *memState) error {
+		for i := len(st.outbox) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+			if st.outbox[i].WebhookID == webhookID {
+				out = append(out, st.outbox[i])
+			}
+		}
+		return nil
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) PruneDeliveries(before time.Time) (int, error) {
+	n := 0
+	_ = s.do("PruneDeliveries", func(st *memState) error {
+		kept := len(st.outbox)
+		st.outbox = slices.DeleteFunc(st.outbox, func(d WebhookDelivery) bool {
+			return d.State != DeliveryPending && d.UpdatedAt.Before(before)
+		})
+		n = kept - len(st.outbox)
+		return nil
+	})
+	return n, nil
+}
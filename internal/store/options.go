@@ -0,0 +1,117 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+	"kypaqet-license-bot/internal/license"
+)
+
+// Options tunes store-wide behaviour.
+type Options struct {
+	// DefaultIdleTTL releases bindings not seen for this long; zero
+	// disables reaping for licenses without their own IdleDays.
+	DefaultIdleTTL time.Duration
+	// ObserveTx, if set, is called with the duration of every transaction.
+	ObserveTx func(op string, d time.Duration)
+	// KeySecret keys the hash that license keys are stored under.
+	KeySecret []byte
+	// Events, if set, receives client activity once it is committed.
+	Events *events.Bus
+	// LeaseTTL is how long a floating license's lease lasts without a
+	// heartbeat; zero uses DefaultLeaseTTL.
+	LeaseTTL time.Duration
+}
+
+const DefaultLeaseTTL = 10 * time.Minute
+
+func (o Options) leaseTTL() time.Duration {
+	if o.LeaseTTL > 0 {
+		return o.LeaseTTL
+	}
+	return DefaultLeaseTTL
+}
+
+// leaseExpiry is when a lease renewed at now lapses; nil unless lic is
+// floating.
+func (o Options) leaseExpiry(lic License, now time.Time) *time.Time {
+	if !lic.Floating() {
+		return nil
+	}
+	t := now.Add(o.leaseTTL())
+	return &t
+}
+
+// idleTTL is how long a binding of lic may go unseen before it is released.
+func (o Options) idleTTL(lic License) time.Duration {
+	if lic.Floating() {
+		return o.leaseTTL()
+	}
+	if lic.IdleDays > 0 {
+		return time.Duration(lic.IdleDays) * 24 * time.Hour
+	}
+	return o.DefaultIdleTTL
+}
+
+// lapsed reports whether sb is a floating lease that has run out by now.
+// A lapsed lease no longer holds a seat, even before a reap deletes it.
+func (o Options) lapsed(lic License, sb ServerBinding, now time.Time) bool {
+	return lic.Floating() && now.Sub(sb.LastSeen) > o.leaseTTL()
+}
+
+// live drops the lapsed leases from bindings.
+func (o Options) live(lic License, bindings []ServerBinding, now time.Time) []ServerBinding {
+	if !lic.Floating() {
+		return bindings
+	}
+	return slices.DeleteFunc(bindings, func(sb ServerBinding) bool { return o.lapsed(lic, sb, now) })
+}
+
+// newLicense generates a key and builds the license for it. The returned
+// value is the only place the key ever appears.
+func (o Options) newLicense(limit int, note string, opts CreateOptions, now time.Time) (License, error) {
+	if limit <= 0 {
+		return License{}, fmt.Errorf("limit must be > 0")
+	}
+	if opts.ValidFor < 0 || opts.GraceDays < 0 {
+		return License{}, fmt.Errorf("duration must be >= 0")
+	}
+	key, err := license.NewKey()
+	if err != nil {
+		return License{}, err
+	}
+	lic := License{ID: license.KeyID(o.KeySecret, key), Key: key, Fingerprint: license.Fingerprint(key), Limit: limit, Note: note, Enabled: true, CreatedAt: now, GraceDays: opts.GraceDays, CustomerID: opts.CustomerID}
+	if opts.ValidFor > 0 {
+		lic.ExpiresAt = now.Add(opts.ValidFor)
+	}
+	return lic, nil
+}
+
+// clientRef checks a client-supplied key and server ID and returns the
+// license ID, or a failure reason.
+func (o Options) clientRef(key, serverID string) (string, string) {
+	key = strings.TrimSpace(key)
+	if key == "" || serverID == "" {
+		return "", "invalid_request"
+	}
+	if len(serverID) > 128 {
+		return "", "server_id_too_long"
+	}
+	if !license.IsKey(key) {
+		// Never accept a bare ID here: it is readable from the database.
+		return "", "not_found"
+	}
+	return license.KeyID(o.KeySecret, key), ""
+}
+
+// ref resolves an admin-supplied license reference, either the key itself or
+// its ID, to the ID it is stored under.
+func (o Options) ref(keyOrID string) string {
+	if license.IsKey(keyOrID) {
+		return license.KeyID(o.KeySecret, keyOrID)
+	}
+	return strings.ToLower(strings.TrimSpace(keyOrID))
+}
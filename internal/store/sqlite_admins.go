@@ -0,0 +1,160 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonList stores a string list as a JSON array; an empty list is NULL.
+func jsonList(list []string) any {
+	if len(list) == 0 {
+		return nil
+	}
+	buf, _ := json.Marshal(list)
+	return string(buf)
+}
+
+// listCol scans a column written by jsonList.
+type listCol struct{ list *[]string }
+
+func (c listCol) Scan(v any) error {
+	var s string
+	if err := (stringCol{&s}).Scan(v); err != nil {
+		return err
+	}
+	*c.list = nil
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), c.list)
+}
+
+const adminCols = "chat_id, role, name, added_at, muted"
+
+func scanAdmin(sc scanner) (Admin, error) {
+	var a Admin
+	err := sc.Scan(&a.ChatID, &a.Role, &a.Name, timeCol{&a.AddedAt}, listCol{&a.Muted})
+	return a, err
+}
+
+func sqliteAdmin(tx *sql.Tx, chatID int64) (Admin, error) {
+	a, err := scanAdmin(tx.QueryRow("SELECT "+adminCols+" FROM admins WHERE chat_id = ?", chatID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Admin{}, ErrAdminNotFound
+	}
+	return a, err
+}
+
+func (s *SQLiteStore) GetAdmin(chatID int64) (Admin, error) {
+	var a Admin
+	if err := s.view("GetAdmin", func(tx *sql.Tx) error {
+		var err error
+		a, err = sqliteAdmin(tx, chatID)
+		return err
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
+
+func (s *SQLiteStore) ListAdmins() ([]Admin, error) {
+	var out []Admin
+	if err := s.view("ListAdmins", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT " + adminCols + " FROM admins ORDER BY chat_id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			a, err := scanAdmin(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, a)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if RoleLevel(out[i].Role) != RoleLevel(out[j].Role) {
+			return RoleLevel(out[i].Role) > RoleLevel(out[j].Role)
+		}
+		return out[i].AddedAt.Before(out[j].AddedAt)
+	})
+	return out, nil
+}
+
+func (s *SQLiteStore) PutAdmin(a Admin) (Admin, error) {
+	if RoleLevel(a.Role) == 0 {
+		return Admin{}, fmt.Errorf("unknown role %q", a.Role)
+	}
+	if a.ChatID == 0 {
+		return Admin{}, fmt.Errorf("chat id is required")
+	}
+	a.Name = strings.TrimSpace(a.Name)
+	if err := s.update("PutAdmin", func(tx *sql.Tx) error {
+		old, err := sqliteAdmin(tx, a.ChatID)
+		switch {
+		case err == nil:
+			if old.Role == a.Role && (a.Name == "" || old.Name == a.Name) {
+				a = old
+				return nil
+			}
+			a.AddedAt = old.AddedAt
+			a.Muted = old.Muted
+			if a.Name == "" {
+				a.Name = old.Name
+			}
+		case !errors.Is(err, ErrAdminNotFound):
+			return err
+		}
+		if a.AddedAt.IsZero() {
+			a.AddedAt = time.Now().UTC()
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO admins ("+adminCols+") VALUES (?, ?, ?, ?, ?)",
+			a.ChatID, a.Role, a.Name, sqlTime(a.AddedAt), jsonList(a.Muted)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("set %d role=%s", a.ChatID, a.Role)})
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
+
+func (s *SQLiteStore) RemoveAdmin(chatID int64) error {
+	return s.update("RemoveAdmin", func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM admins WHERE chat_id = ?", chatID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrAdminNotFound
+		}
+		return s.audit(tx, AuditEvent{Action: AuditAdmin, Detail: fmt.Sprintf("removed %d", chatID)})
+	})
+}
+
+func (s *SQLiteStore) SetAdminMuted(chatID int64, muted []string) (Admin, error) {
+	var a Admin
+	if err := s.update("SetAdminMuted", func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE admins SET muted = ? WHERE chat_id = ?", jsonList(muted), chatID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrAdminNotFound
+		}
+		a, err = sqliteAdmin(tx, chatID)
+		return err
+	}); err != nil {
+		return Admin{}, err
+	}
+	return a, nil
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// ConvertResult counts the rows copied by ConvertBBolt.
+type ConvertResult struct {
+	Licenses   int
+	Bindings   int
+	Reaped     int
+	Audit      int
+	Tokens     int
+	Admins     int
+	Customers  int
+	Webhooks   int
+	Deliveries int
+}
+
+// sqliteTables are checked to be empty before a conversion.
+var sqliteTables = []string{"licenses", "bindings", "reaped", "audit", "api_tokens", "admins", "customers", "webhooks", "outbox"}
+
+// ConvertBBolt copies everything in the bbolt database at src into the
+// SQLite database at dst, which must be new or empty. src is migrated to
+// the current schema first, as opening it would; it is otherwise left
+// alone. The copy is one transaction: on error dst stays empty.
+func ConvertBBolt(src, dst string, opts Options) (ConvertResult, error) {
+	from, err := OpenBBolt(src, opts)
+	if err != nil {
+		return ConvertResult{}, err
+	}
+	defer from.Close()
+	to, err := OpenSQLite(dst, opts)
+	if err != nil {
+		return ConvertResult{}, err
+	}
+	defer to.Close()
+
+	var res ConvertResult
+	err = from.view("Convert", func(btx *bbolt.Tx) error {
+		return to.update("Convert", func(tx *sql.Tx) error {
+			for _, table := range sqliteTables {
+				var n int
+				if err := tx.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+					return err
+				}
+				if n > 0 {
+					return fmt.Errorf("%s: table %s is not empty", dst, table)
+				}
+			}
+			return convertBuckets(btx, tx, &res)
+		})
+	})
+	if err != nil {
+		return ConvertResult{}, err
+	}
+	return res, nil
+}
+
+func convertBuckets(btx *bbolt.Tx, tx *sql.Tx, res *ConvertResult) error {
+	if err := btx.Bucket([]byte(bucketLicenses)).ForEach(func(_, v []byte) error {
+		var lic License
+		if err := json.Unmarshal(v, &lic); err != nil {
+			return err
+		}
+		res.Licenses++
+		return insertLicenseRow(tx, lic)
+	}); err != nil {
+		return fmt.Errorf("licenses: %w", err)
+	}
+
+	// usage and reaped hold one nested bucket per license ID.
+	if err := btx.Bucket([]byte(bucketUsage)).ForEach(func(id, _ []byte) error {
+		usage := btx.Bucket([]byte(bucketUsage)).Bucket(id)
+		if usage == nil {
+			return nil
+		}
+		return usage.ForEach(func(k, v []byte) error {
+			var sb ServerBinding
+			if err := json.Unmarshal(v, &sb); err != nil {
+				return err
+			}
+			res.Bindings++
+			_, err := tx.Exec("INSERT INTO bindings (license_id, server_id, first_seen, last_seen, seen_count) VALUES (?, ?, ?, ?, ?)",
+				string(id), string(k), sqlTime(sb.FirstSeen), sqlTime(sb.LastSeen), sb.SeenCount)
+			return err
+		})
+	}); err != nil {
+		return fmt.Errorf("bindings: %w", err)
+	}
+	if err := btx.Bucket([]byte(bucketReaped)).ForEach(func(id, _ []byte) error {
+		reaped := btx.Bucket([]byte(bucketReaped)).Bucket(id)
+		if reaped == nil {
+			return nil
+		}
+		return reaped.ForEach(func(_, v []byte) error {
+			var rb ReapedBinding
+			if err := json.Unmarshal(v, &rb); err != nil {
+				return err
+			}
+			res.Reaped++
+			_, err := tx.Exec("INSERT INTO reaped (license_id, server_id, first_seen, last_seen, seen_count, reaped_at) VALUES (?, ?, ?, ?, ?, ?)",
+				string(id), rb.ServerID, sqlTime(rb.FirstSeen), sqlTime(rb.LastSeen), rb.SeenCount, sqlTime(rb.ReapedAt))
+			return err
+		})
+	}); err != nil {
+		return fmt.Errorf("reaped: %w", err)
+	}
+
+	// Audit keys sort chronologically, so the new sequence keeps the order.
+	if err := btx.Bucket([]byte(bucketAudit)).ForEach(func(_, v []byte) error {
+		var ev AuditEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return err
+		}
+		res.Audit++
+		_, err := tx.Exec("INSERT INTO audit (at, actor, action, license_id, server_id, detail) VALUES (?, ?, ?, ?, ?, ?)",
+			sqlTime(ev.At), ev.Actor, ev.Action, ev.Key, ev.ServerID, ev.Detail)
+		return err
+	}); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if err := btx.Bucket([]byte(bucketTokens)).ForEach(func(h, v []byte) error {
+		var t APIToken
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		res.Tokens++
+		_, err := tx.Exec("INSERT INTO api_tokens (hash, id, name, created_at, last_used) VALUES (?, ?, ?, ?, ?)",
+			string(h), t.ID, t.Name, sqlTime(t.CreatedAt), sqlTime(t.LastUsed))
+		return err
+	}); err != nil {
+		return fmt.Errorf("tokens: %w", err)
+	}
+	if err := btx.Bucket([]byte(bucketAdmins)).ForEach(func(_, v []byte) error {
+		var a Admin
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+		res.Admins++
+		_, err := tx.Exec("INSERT INTO admins ("+adminCols+") VALUES (?, ?, ?, ?, ?)",
+			a.ChatID, a.Role, a.Name, sqlTime(a.AddedAt), jsonList(a.Muted))
+		return err
+	}); err != nil {
+		return fmt.Errorf("admins: %w", err)
+	}
+	if err := btx.Bucket([]byte(bucketCustomers)).ForEach(func(_, v []byte) error {
+		var c Customer
+		if err := json.Unmarshal(v, &c); err != nil {
+			return err
+		}
+		res.Customers++
+		_, err := tx.Exec("INSERT INTO customers ("+customerCols+") VALUES (?, ?, ?, ?, ?, ?)",
+			c.ID, c.Name, c.Username, c.Contact, c.Notes, sqlTime(c.CreatedAt))
+		return err
+	}); err != nil {
+		return fmt.Errorf("customers: %w", err)
+	}
+	if err := btx.Bucket([]byte(bucketWebhooks)).ForEach(func(_, v []byte) error {
+		var w Webhook
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		res.Webhooks++
+		_, err := tx.Exec("INSERT INTO webhooks (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)",
+			w.ID, w.URL, w.Secret, jsonList(w.Events), sqlTime(w.CreatedAt))
+		return err
+	}); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+
+	// Keep the outbox sequence: it is the delivery ID receivers have seen.
+	if err := btx.Bucket([]byte(bucketOutbox)).ForEach(func(k, v []byte) error {
+		if len(k) != 8 {
+			return nil
+		}
+		var d WebhookDelivery
+		if err := json.Unmarshal(v, &d); err != nil {
+			return err
+		}
+		res.Deliveries++
+		_, err := tx.Exec("INSERT INTO outbox ("+deliveryCols+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			int64(binary.BigEndian.Uint64(k)), d.WebhookID, d.Event, []byte(d.Payload), d.State, d.Attempts,
+			sqlTime(d.NextAttempt), d.LastStatus, d.LastError, sqlTime(d.CreatedAt), sqlTime(d.UpdatedAt))
+		return err
+	}); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const customerCols = "id, name, username, contact, notes, created_at"
+
+func scanCustomer(sc scanner) (Customer, error) {
+	var c Customer
+	err := sc.Scan(&c.ID, &c.Name, &c.Username, &c.Contact, &c.Notes, timeCol{&c.CreatedAt})
+	return c, err
+}
+
+func sqliteCustomer(tx *sql.Tx, id string) (Customer, error) {
+	c, err := scanCustomer(tx.QueryRow("SELECT "+customerCols+" FROM customers WHERE id = ?", strings.ToLower(strings.TrimSpace(id))))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Customer{}, ErrCustomerNotFound
+	}
+	return c, err
+}
+
+func (s *SQLiteStore) CreateCustomer(c Customer) (Customer, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Username = strings.TrimPrefix(strings.TrimSpace(c.Username), "@")
+	c.Contact = strings.TrimSpace(c.Contact)
+	c.Notes = strings.TrimSpace(c.Notes)
+	if c.Name == "" {
+		return Customer{}, fmt.Errorf("name is required")
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Customer{}, err
+	}
+	c.ID = hex.EncodeToString(id)
+	c.CreatedAt = time.Now().UTC()
+	if err := s.update("CreateCustomer", func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO customers ("+customerCols+") VALUES (?, ?, ?, ?, ?, ?)",
+			c.ID, c.Name, c.Username, c.Contact, c.Notes, sqlTime(c.CreatedAt)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditCustomer, Detail: fmt.Sprintf("created %s %q", c.ID, c.Name)})
+	}); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) GetCustomer(id string) (Customer, error) {
+	var c Customer
+	if err := s.view("GetCustomer", func(tx *sql.Tx) error {
+		var err error
+		c, err = sqliteCustomer(tx, id)
+		return err
+	}); err != nil {
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) ListCustomers() ([]Customer, error) {
+	var out []Customer
+	if err := s.view("ListCustomers", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT " + customerCols + " FROM customers ORDER BY id")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			c, err := scanCustomer(rows)
+			if err != nil {
+				return err
+			}
+			out = append(out, c)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	// SQLite's lower() only folds ASCII.
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+	return out, nil
+}
+
+func (s *SQLiteStore) SetLicenseCustomer(key string, customerID string) (License, error) {
+	id := s.opts.ref(key)
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	var updated License
+	if err := s.update("SetLicenseCustomer", func(tx *sql.Tx) error {
+		lic, err := sqliteLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		detail := "unlinked"
+		if customerID != "" {
+			c, err := sqliteCustomer(tx, customerID)
+			if err != nil {
+				return err
+			}
+			detail = fmt.Sprintf("linked to %s %q", c.ID, c.Name)
+		}
+		if _, err := tx.Exec("UPDATE licenses SET customer_id = ? WHERE id = ?", sqlString(customerID), id); err != nil {
+			return err
+		}
+		lic.CustomerID = customerID
+		updated = lic
+		return s.audit(tx, AuditEvent{Action: AuditCustomer, Key: id, Detail: detail})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *SQLiteStore) SetCustomerEnabled(customerID string, enabled bool) (int, error) {
+	customerID = strings.ToLower(strings.TrimSpace(customerID))
+	changed := 0
+	if err := s.update("SetCustomerEnabled", func(tx *sql.Tx) error {
+		if _, err := sqliteCustomer(tx, customerID); err != nil {
+			return err
+		}
+		var err error
+		changed, err = s.setGroupEnabled(tx, "customer_id", customerID, enabled, "customer "+customerID)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// setGroupEnabled enables or disables every license whose column equals
+// value, auditing each change, and returns how many changed.
+func (s *SQLiteStore) setGroupEnabled(tx *sql.Tx, column, value string, enabled bool, detail string) (int, error) {
+	rows, err := tx.Query("SELECT id FROM licenses WHERE "+column+" = ? AND enabled != ? ORDER BY id", value, enabled)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	for _, id := range ids {
+		if _, err := tx.Exec("UPDATE licenses SET enabled = ? WHERE id = ?", enabled, id); err != nil {
+			return 0, err
+		}
+		if err := s.audit(tx, AuditEvent{Action: action, Key: id, Detail: detail}); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func (s *SQLiteStore) CreateLicenses(n, limit int, note string, opts CreateOptions) ([]License, error) {
+	if n <= 0 || n > MaxBatchSize {
+		return nil, fmt.Errorf("count must be between 1 and %d", MaxBatchSize)
+	}
+	batchID, err := newBatchID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	lics := make([]License, n)
+	for i := range lics {
+		lic, err := s.opts.newLicense(limit, note, opts, now)
+		if err != nil {
+			return nil, err
+		}
+		lic.BatchID = batchID
+		lics[i] = lic
+	}
+	if err := s.update("CreateLicenses", func(tx *sql.Tx) error {
+		for _, lic := range lics {
+			if err := s.insertLicense(tx, lic); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return lics, nil
+}
+
+func (s *SQLiteStore) ListBatches() ([]Batch, error) {
+	var out []Batch
+	if err := s.view("ListBatches", func(tx *sql.Tx) error {
+		// With MIN(id), SQLite takes the bare columns from that row.
+		rows, err := tx.Query(`SELECT batch_id, note, seat_limit, created_at, MIN(id), COUNT(*), SUM(enabled)
+			FROM licenses WHERE batch_id IS NOT NULL GROUP BY batch_id ORDER BY created_at DESC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var b Batch
+			var first string
+			if err := rows.Scan(&b.ID, &b.Note, &b.Limit, timeCol{&b.CreatedAt}, &first, &b.Size, &b.Enabled); err != nil {
+				return err
+			}
+			out = append(out, b)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []Batch{}
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) SetBatchEnabled(batchID string, enabled bool) (int, error) {
+	batchID = strings.ToLower(strings.TrimSpace(batchID))
+	changed := 0
+	if err := s.update("SetBatchEnabled", func(tx *sql.Tx) error {
+		var size int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM licenses WHERE batch_id = ?", batchID).Scan(&size); err != nil {
+			return err
+		}
+		if size == 0 {
+			return ErrBatchNotFound
+		}
+		var err error
+		changed, err = s.setGroupEnabled(tx, "batch_id", batchID, enabled, "batch "+batchID)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// Backup writes a consistent copy of the database file, made with VACUUM
+// INTO while the store stays online.
+func (s *SQLiteStore) Backup(w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp("", "licensebot-backup-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "snapshot.db")
+	// VACUUM cannot run inside a transaction, and query_only rejects it, so
+	// it takes the writer connection; writers wait until the copy is done.
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx("Backup", time.Since(start)) }(time.Now())
+	}
+	if _, err := s.db.Exec("VACUUM INTO ?", tmp); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+func (s *SQLiteStore) Export(w io.Writer, opts ExportOptions) (int, error) {
+	rw, err := newRecordWriter(w, opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	where, args := "", []any{}
+	if opts.BatchID != "" {
+		where, args = " WHERE batch_id = ?", []any{opts.BatchID}
+	}
+	n := 0
+	if err := s.view("Export", func(tx *sql.Tx) error {
+		var infos []LicenseInfo
+		rows, err := tx.Query("SELECT "+licenseCols+" FROM licenses"+where+" ORDER BY id", args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			lic, err := scanLicense(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			infos = append(infos, LicenseInfo{License: lic, Bindings: make([]ServerBinding, 0)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// One pass over the bindings, in the same license order.
+		rows, err = tx.Query(`SELECT license_id, server_id, first_seen, last_seen, seen_count FROM bindings
+			WHERE license_id IN (SELECT id FROM licenses`+where+`) ORDER BY license_id, last_seen DESC, server_id`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		i := 0
+		for rows.Next() {
+			var id string
+			var sb ServerBinding
+			if err := rows.Scan(&id, &sb.ServerID, timeCol{&sb.FirstSeen}, timeCol{&sb.LastSeen}, &sb.SeenCount); err != nil {
+				return err
+			}
+			for i < len(infos) && infos[i].License.ID < id {
+				i++
+			}
+			if i < len(infos) && infos[i].License.ID == id {
+				infos[i].Bindings = append(infos[i].Bindings, sb)
+				infos[i].Used++
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if err := rw.Write(info); err != nil {
+				return err
+			}
+		}
+		n = len(infos)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if n == 0 && opts.BatchID != "" {
+		return 0, ErrBatchNotFound
+	}
+	return n, rw.Flush()
+}
+
+func (s *SQLiteStore) Import(r io.Reader, opts ImportOptions) (ImportResult, error) {
+	switch opts.OnConflict {
+	case "":
+		opts.OnConflict = ConflictFail
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return ImportResult{}, fmt.Errorf("unknown conflict policy %q", opts.OnConflict)
+	}
+	next, err := newRecordReader(r, opts.Format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	var res ImportResult
+	err = s.update("Import", func(tx *sql.Tx) error {
+		for {
+			info, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			lic, bindings, err := importRecord(s.opts.KeySecret, info)
+			if err != nil {
+				return err
+			}
+			action := "created"
+			if _, err := sqliteLicense(tx, lic.ID); err == nil {
+				switch opts.OnConflict {
+				case ConflictSkip:
+					res.Skipped++
+					continue
+				case ConflictFail:
+					return fmt.Errorf("%s: %w", lic.ID, ErrConflict)
+				}
+				action = "overwritten"
+				// Bindings go with the row (ON DELETE CASCADE).
+				if _, err := tx.Exec("DELETE FROM licenses WHERE id = ?", lic.ID); err != nil {
+					return err
+				}
+			} else if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if lic.CustomerID != "" {
+				if _, err := sqliteCustomer(tx, lic.CustomerID); err != nil {
+					return fmt.Errorf("%s: %w", lic.ID, err)
+				}
+			}
+			if err := insertLicenseRow(tx, lic); err != nil {
+				return err
+			}
+			for _, b := range bindings {
+				if _, err := tx.Exec("INSERT INTO bindings (license_id, server_id, first_seen, last_seen, seen_count) VALUES (?, ?, ?, ?, ?)",
+					lic.ID, b.ServerID, sqlTime(b.FirstSeen), sqlTime(b.LastSeen), b.SeenCount); err != nil {
+					return err
+				}
+			}
+			if action == "created" {
+				res.Created++
+			} else {
+				res.Overwritten++
+			}
+			if err := s.audit(tx, AuditEvent{Action: AuditImport, Key: lic.ID, Detail: fmt.Sprintf("%s, %d bindings", action, len(bindings))}); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+)
+
+// QueryLicenses pushes everything but the text search into SQL; the search
+// runs through the shared matcher so it folds case exactly like the other
+// backends.
+func (s *SQLiteStore) QueryLicenses(filter LicenseFilter, cursor string, limit int) (LicensePage, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	match, err := newMatcher(LicenseFilter{Status: filter.Status, Search: filter.Search}, s.opts.ref)
+	if err != nil {
+		return LicensePage{}, err
+	}
+	from, backward, err := parseCursor(cursor)
+	if err != nil {
+		return LicensePage{}, err
+	}
+
+	used := s.usedCol(time.Now())
+	var where []string
+	var args []any
+	switch filter.Status {
+	case FilterEnabled:
+		where = append(where, "l.enabled = 1")
+	case FilterDisabled:
+		where = append(where, "l.enabled = 0")
+	case FilterFull:
+		where = append(where, used+" >= l.seat_limit")
+	case FilterUnused:
+		where = append(where, used+" = 0")
+	}
+	if filter.CustomerID != "" {
+		where = append(where, "l.customer_id = ?")
+		args = append(args, filter.CustomerID)
+	}
+	if !filter.IdleSince.IsZero() {
+		where = append(where, "COALESCE((SELECT MAX(b.last_seen) FROM bindings b WHERE b.license_id = l.id), '') < ?")
+		args = append(args, sqlTime(filter.IdleSince))
+	}
+	search := strings.TrimSpace(filter.Search)
+	if license.IsKey(search) {
+		where = append(where, "l.id = ?")
+		args = append(args, s.opts.ref(search))
+	}
+
+	var page LicensePage
+	err = s.view("QueryLicenses", func(tx *sql.Tx) error {
+		order := "DESC"
+		if from != "" {
+			var created string
+			err := tx.QueryRow("SELECT created_at FROM licenses WHERE id = ?", from).Scan(&created)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			cmp := "<"
+			if backward {
+				cmp, order = ">", "ASC"
+			}
+			where = append(where, fmt.Sprintf("(l.created_at, l.id) %s (?, ?)", cmp))
+			args = append(args, created, from)
+		}
+		q := "SELECT " + licenseCols + ", " + used + " FROM licenses l"
+		if len(where) > 0 {
+			q += " WHERE " + strings.Join(where, " AND ")
+		}
+		q += fmt.Sprintf(" ORDER BY l.created_at %s, l.id %s", order, order)
+		if search == "" {
+			q += " LIMIT ?"
+			args = append(args, limit+1)
+		}
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var items []LicenseInfo
+		for len(items) <= limit && rows.Next() {
+			var info LicenseInfo
+			if info.License, err = scanLicense(rows, &info.Used); err != nil {
+				return err
+			}
+			if match(info) {
+				items = append(items, info)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		page = newPage(items, limit, cursor, backward)
+		return nil
+	})
+	if err != nil {
+		return LicensePage{}, err
+	}
+	return page, nil
+}
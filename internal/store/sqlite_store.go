@@ -0,0 +1,881 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+	"kypaqet-license-bot/internal/license"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore keeps the data in proper tables so other processes can read
+// (and report on) the file while the service runs.
+type SQLiteStore struct {
+	// db is the only writer: one connection, transactions take the write
+	// lock up front. ro is a pool of query-only connections for reads.
+	db    *sql.DB
+	ro    *sql.DB
+	opts  Options
+	actor string
+}
+
+// sqliteMigrations upgrade the schema by one version each, tracked in
+// PRAGMA user_version. Only ever append to this list.
+var sqliteMigrations = []string{
+	`CREATE TABLE licenses (
+		id          TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		seat_limit  INTEGER NOT NULL,
+		note        TEXT NOT NULL DEFAULT '',
+		enabled     INTEGER NOT NULL,
+		created_at  TEXT NOT NULL,
+		expires_at  TEXT,
+		grace_days  INTEGER NOT NULL DEFAULT 0,
+		idle_days   INTEGER NOT NULL DEFAULT 0,
+		batch_id    TEXT,
+		customer_id TEXT
+	);
+	CREATE INDEX licenses_created ON licenses (created_at, id);
+	CREATE INDEX licenses_batch ON licenses (batch_id) WHERE batch_id IS NOT NULL;
+	CREATE INDEX licenses_customer ON licenses (customer_id) WHERE customer_id IS NOT NULL;
+
+	CREATE TABLE bindings (
+		license_id TEXT NOT NULL REFERENCES licenses (id) ON DELETE CASCADE,
+		server_id  TEXT NOT NULL,
+		first_seen TEXT,
+		last_seen  TEXT,
+		seen_count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (license_id, server_id)
+	) WITHOUT ROWID;
+	CREATE INDEX bindings_last_seen ON bindings (last_seen);
+
+	CREATE TABLE reaped (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		license_id TEXT NOT NULL,
+		server_id  TEXT NOT NULL,
+		first_seen TEXT,
+		last_seen  TEXT,
+		seen_count INTEGER NOT NULL DEFAULT 0,
+		reaped_at  TEXT NOT NULL
+	);
+	CREATE INDEX reaped_license ON reaped (license_id, seq);
+
+	CREATE TABLE audit (
+		seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+		at         TEXT NOT NULL,
+		actor      TEXT NOT NULL,
+		action     TEXT NOT NULL,
+		license_id TEXT NOT NULL DEFAULT '',
+		server_id  TEXT NOT NULL DEFAULT '',
+		detail     TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_at ON audit (at, seq);
+	CREATE INDEX audit_license ON audit (license_id, at) WHERE license_id != '';
+	CREATE INDEX audit_action ON audit (action, at);
+
+	CREATE TABLE api_tokens (
+		hash       TEXT PRIMARY KEY,
+		id         TEXT NOT NULL UNIQUE,
+		name       TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		last_used  TEXT
+	);
+
+	CREATE TABLE admins (
+		chat_id  INTEGER PRIMARY KEY,
+		role     TEXT NOT NULL,
+		name     TEXT NOT NULL DEFAULT '',
+		added_at TEXT NOT NULL,
+		muted    TEXT
+	);
+
+	CREATE TABLE customers (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		username   TEXT NOT NULL DEFAULT '',
+		contact    TEXT NOT NULL DEFAULT '',
+		notes      TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	);
+
+	CREATE TABLE webhooks (
+		id         TEXT PRIMARY KEY,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		events     TEXT,
+		created_at TEXT NOT NULL
+	);
+
+	CREATE TABLE outbox (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id   TEXT NOT NULL,
+		event        TEXT NOT NULL,
+		payload      BLOB NOT NULL,
+		state        TEXT NOT NULL,
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		next_attempt TEXT NOT NULL,
+		last_status  INTEGER NOT NULL DEFAULT 0,
+		last_error   TEXT NOT NULL DEFAULT '',
+		created_at   TEXT NOT NULL,
+		updated_at   TEXT NOT NULL
+	);
+	CREATE INDEX outbox_due ON outbox (state, next_attempt);
+	CREATE INDEX outbox_webhook ON outbox (webhook_id, seq);`,
+
+	`ALTER TABLE licenses ADD COLUMN mode TEXT NOT NULL DEFAULT ''`,
+}
+
+// OpenSQLite opens or creates the database at path and applies pending
+// migrations.
+func OpenSQLite(path string, opts Options) (*SQLiteStore, error) {
+	if len(opts.KeySecret) == 0 {
+		return nil, fmt.Errorf("key secret is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	const common = "_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", "file:"+path+"?"+common+"&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	ro, err := sql.Open("sqlite", "file:"+path+"?"+common+"&_pragma=query_only(1)")
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db, ro: ro, opts: opts, actor: "system"}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return fmt.Errorf("%w (database %d, binary %d)", ErrSchemaTooNew, version, len(sqliteMigrations))
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			return fmt.Errorf("sqlite migration %d: %w", i+1, err)
+		}
+	}
+	// PRAGMA does not take parameters.
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteMigrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	return errors.Join(s.ro.Close(), s.db.Close())
+}
+
+func (s *SQLiteStore) update(op string, fn func(tx *sql.Tx) error) error {
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx(op, time.Since(start)) }(time.Now())
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// view runs fn in a read transaction, which sees one consistent snapshot.
+func (s *SQLiteStore) view(op string, fn func(tx *sql.Tx) error) error {
+	if s.opts.ObserveTx != nil {
+		defer func(start time.Time) { s.opts.ObserveTx(op, time.Since(start)) }(time.Now())
+	}
+	tx, err := s.ro.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// As returns a view of the store that records actor in the audit log.
+func (s *SQLiteStore) As(actor string) Store {
+	cp := *s
+	cp.actor = actor
+	return &cp
+}
+
+// sqlTimeLayout is fixed width so stored times sort as text, and SQLite's
+// date functions understand it.
+const sqlTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqlTime stores t; the zero time is NULL.
+func sqlTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+// timeCol scans a column written by sqlTime.
+type timeCol struct{ t *time.Time }
+
+func (c timeCol) Scan(v any) error {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		*c.t = time.Time{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("time column: unexpected %T", v)
+	}
+	t, err := time.Parse(sqlTimeLayout, s)
+	if err != nil {
+		return err
+	}
+	*c.t = t
+	return nil
+}
+
+// sqlString stores s; the empty string is NULL.
+func sqlString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// stringCol scans a nullable text column, NULL reading as "".
+type stringCol struct{ s *string }
+
+func (c stringCol) Scan(v any) error {
+	switch v := v.(type) {
+	case nil:
+		*c.s = ""
+	case string:
+		*c.s = v
+	case []byte:
+		*c.s = string(v)
+	default:
+		return fmt.Errorf("text column: unexpected %T", v)
+	}
+	return nil
+}
+
+type scanner interface{ Scan(dest ...any) error }
+
+const licenseCols = "id, fingerprint, seat_limit, note, enabled, created_at, expires_at, grace_days, idle_days, batch_id, customer_id, mode"
+
+// usedCol counts the seats held at now by the license row aliased l: its
+// bindings, less any lapsed floating leases.
+func (s *SQLiteStore) usedCol(now time.Time) string {
+	cutoff := now.Add(-s.opts.leaseTTL()).UTC().Format(sqlTimeLayout)
+	return fmt.Sprintf("(SELECT COUNT(*) FROM bindings b WHERE b.license_id = l.id AND (l.mode != '%s' OR COALESCE(b.last_seen, '') >= '%s'))", ModeFloating, cutoff)
+}
+
+func scanLicense(sc scanner, extra ...any) (License, error) {
+	var lic License
+	dest := []any{&lic.ID, &lic.Fingerprint, &lic.Limit, &lic.Note, &lic.Enabled, timeCol{&lic.CreatedAt}, timeCol{&lic.ExpiresAt},
+		&lic.GraceDays, &lic.IdleDays, stringCol{&lic.BatchID}, stringCol{&lic.CustomerID}, &lic.Mode}
+	err := sc.Scan(append(dest, extra...)...)
+	return lic, err
+}
+
+func sqliteLicense(tx *sql.Tx, id string) (License, error) {
+	lic, err := scanLicense(tx.QueryRow("SELECT "+licenseCols+" FROM licenses WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return License{}, ErrNotFound
+	}
+	return lic, err
+}
+
+func insertLicenseRow(tx *sql.Tx, lic License) error {
+	_, err := tx.Exec("INSERT INTO licenses ("+licenseCols+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		lic.ID, lic.Fingerprint, lic.Limit, lic.Note, lic.Enabled, sqlTime(lic.CreatedAt), sqlTime(lic.ExpiresAt),
+		lic.GraceDays, lic.IdleDays, sqlString(lic.BatchID), sqlString(lic.CustomerID), lic.Mode)
+	return err
+}
+
+// sqliteBindings returns the bindings of a license, most recently seen
+// first.
+func sqliteBindings(tx *sql.Tx, id string) ([]ServerBinding, error) {
+	rows, err := tx.Query("SELECT server_id, first_seen, last_seen, seen_count FROM bindings WHERE license_id = ? ORDER BY last_seen DESC, server_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bindings := make([]ServerBinding, 0)
+	for rows.Next() {
+		var sb ServerBinding
+		if err := rows.Scan(&sb.ServerID, timeCol{&sb.FirstSeen}, timeCol{&sb.LastSeen}, &sb.SeenCount); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, sb)
+	}
+	return bindings, rows.Err()
+}
+
+func countBindings(tx *sql.Tx, id string) (int, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM bindings WHERE license_id = ?", id).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteStore) audit(tx *sql.Tx, ev AuditEvent) error {
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	if ev.Actor == "" {
+		ev.Actor = s.actor
+	}
+	_, err := tx.Exec("INSERT INTO audit (at, actor, action, license_id, server_id, detail) VALUES (?, ?, ?, ?, ?, ?)",
+		sqlTime(ev.At), ev.Actor, ev.Action, ev.Key, ev.ServerID, ev.Detail)
+	return err
+}
+
+func (s *SQLiteStore) insertLicense(tx *sql.Tx, lic License) error {
+	if _, err := sqliteLicense(tx, lic.ID); err == nil {
+		return fmt.Errorf("key collision, try again")
+	}
+	if lic.CustomerID != "" {
+		if _, err := sqliteCustomer(tx, lic.CustomerID); err != nil {
+			return err
+		}
+	}
+	if err := insertLicenseRow(tx, lic); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("limit=%d note=%q", lic.Limit, lic.Note)
+	if lic.BatchID != "" {
+		detail += " batch=" + lic.BatchID
+	}
+	return s.audit(tx, AuditEvent{Action: AuditCreate, Key: lic.ID, Detail: detail})
+}
+
+func (s *SQLiteStore) CreateLicense(limit int, note string, opts CreateOptions) (License, error) {
+	lic, err := s.opts.newLicense(limit, note, opts, time.Now().UTC())
+	if err != nil {
+		return License{}, err
+	}
+	if err := s.update("CreateLicense", func(tx *sql.Tx) error {
+		return s.insertLicense(tx, lic)
+	}); err != nil {
+		return License{}, err
+	}
+	return lic, nil
+}
+
+// change updates one column of a stored license, writes the audit event
+// and returns the updated license.
+func (s *SQLiteStore) change(op, key, column string, value any, ev func(old License) AuditEvent) (License, error) {
+	id := s.opts.ref(key)
+	var updated License
+	if err := s.update(op, func(tx *sql.Tx) error {
+		old, err := sqliteLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE licenses SET "+column+" = ? WHERE id = ?", value, id); err != nil {
+			return err
+		}
+		if updated, err = sqliteLicense(tx, id); err != nil {
+			return err
+		}
+		e := ev(old)
+		e.Key = id
+		return s.audit(tx, e)
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *SQLiteStore) SetLimit(key string, limit int) (License, error) {
+	if limit <= 0 {
+		return License{}, fmt.Errorf("limit must be > 0")
+	}
+	return s.change("SetLimit", key, "seat_limit", limit, func(old License) AuditEvent {
+		return AuditEvent{Action: AuditSetLimit, Detail: fmt.Sprintf("%d -> %d", old.Limit, limit)}
+	})
+}
+
+func (s *SQLiteStore) SetEnabled(key string, enabled bool) (License, error) {
+	action := AuditDisable
+	if enabled {
+		action = AuditEnable
+	}
+	return s.change("SetEnabled", key, "enabled", enabled, func(License) AuditEvent {
+		return AuditEvent{Action: action}
+	})
+}
+
+func (s *SQLiteStore) Renew(key string, d time.Duration) (License, error) {
+	if d <= 0 {
+		return License{}, fmt.Errorf("duration must be > 0")
+	}
+	id := s.opts.ref(key)
+	now := time.Now().UTC()
+	var updated License
+	if err := s.update("Renew", func(tx *sql.Tx) error {
+		lic, err := sqliteLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		from := lic.ExpiresAt
+		if from.Before(now) {
+			from = now
+		}
+		lic.ExpiresAt = from.Add(d)
+		updated = lic
+		if _, err := tx.Exec("UPDATE licenses SET expires_at = ? WHERE id = ?", sqlTime(lic.ExpiresAt), id); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditRenew, Key: id, Detail: "expires " + lic.ExpiresAt.Format(time.RFC3339)})
+	}); err != nil {
+		return License{}, err
+	}
+	return updated, nil
+}
+
+func (s *SQLiteStore) SetIdleDays(key string, days int) (License, error) {
+	if days < 0 {
+		return License{}, fmt.Errorf("days must be >= 0")
+	}
+	return s.change("SetIdleDays", key, "idle_days", days, func(License) AuditEvent {
+		return AuditEvent{Action: AuditSetIdle, Detail: fmt.Sprintf("%d days", days)}
+	})
+}
+
+func (s *SQLiteStore) SetMode(key string, mode string) (License, error) {
+	if err := checkMode(mode); err != nil {
+		return License{}, err
+	}
+	return s.change("SetMode", key, "mode", mode, func(old License) AuditEvent {
+		return AuditEvent{Action: AuditSetMode, Detail: fmt.Sprintf("%s -> %s", modeName(old.Mode), modeName(mode))}
+	})
+}
+
+func (s *SQLiteStore) Unbind(key string, serverID string) error {
+	id := s.opts.ref(key)
+	serverID = strings.TrimSpace(serverID)
+	return s.update("Unbind", func(tx *sql.Tx) error {
+		if _, err := sqliteLicense(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec("DELETE FROM bindings WHERE license_id = ? AND server_id = ?", id, serverID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotBound
+		}
+		return s.audit(tx, AuditEvent{Action: AuditUnbind, Key: id, ServerID: serverID})
+	})
+}
+
+func (s *SQLiteStore) ResetBindings(key string) (int, error) {
+	id := s.opts.ref(key)
+	n := 0
+	if err := s.update("ResetBindings", func(tx *sql.Tx) error {
+		if _, err := sqliteLicense(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec("DELETE FROM bindings WHERE license_id = ?", id)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		n = int(affected)
+		return s.audit(tx, AuditEvent{Action: AuditReset, Key: id, Detail: fmt.Sprintf("released %d", n)})
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) ReapStale() (int, error) {
+	now := time.Now().UTC()
+	total := 0
+	if err := s.update("ReapStale", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT " + licenseCols + " FROM licenses l WHERE EXISTS (SELECT 1 FROM bindings b WHERE b.license_id = l.id) ORDER BY id")
+		if err != nil {
+			return err
+		}
+		var lics []License
+		for rows.Next() {
+			lic, err := scanLicense(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			lics = append(lics, lic)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, lic := range lics {
+			n, err := s.reapLicense(tx, lic, now, "")
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// reapLicense moves bindings idle past the license TTL into the reaped
+// table and returns how many it moved; lapsed leases are just deleted.
+// keep is never reaped (the server currently activating).
+func (s *SQLiteStore) reapLicense(tx *sql.Tx, lic License, now time.Time, keep string) (int, error) {
+	ttl := s.opts.idleTTL(lic)
+	if ttl <= 0 {
+		return 0, nil
+	}
+	rows, err := tx.Query(`SELECT server_id, first_seen, last_seen, seen_count FROM bindings
+		WHERE license_id = ? AND server_id != ? AND COALESCE(last_seen, '') < ? ORDER BY server_id`,
+		lic.ID, keep, sqlTime(now.Add(-ttl)))
+	if err != nil {
+		return 0, err
+	}
+	var stale []ServerBinding
+	for rows.Next() {
+		var sb ServerBinding
+		if err := rows.Scan(&sb.ServerID, timeCol{&sb.FirstSeen}, timeCol{&sb.LastSeen}, &sb.SeenCount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stale = append(stale, sb)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, sb := range stale {
+		if _, err := tx.Exec("DELETE FROM bindings WHERE license_id = ? AND server_id = ?", lic.ID, sb.ServerID); err != nil {
+			return 0, err
+		}
+		if lic.Floating() {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO reaped (license_id, server_id, first_seen, last_seen, seen_count, reaped_at) VALUES (?, ?, ?, ?, ?, ?)",
+			lic.ID, sb.ServerID, sqlTime(sb.FirstSeen), sqlTime(sb.LastSeen), sb.SeenCount, sqlTime(now)); err != nil {
+			return 0, err
+		}
+		if err := s.audit(tx, AuditEvent{Action: AuditReap, Key: lic.ID, ServerID: sb.ServerID, Detail: "last seen " + sb.LastSeen.Format(time.RFC3339)}); err != nil {
+			return 0, err
+		}
+	}
+	if lic.Floating() {
+		return 0, nil
+	}
+	return len(stale), nil
+}
+
+func (s *SQLiteStore) ListReaped(key string) ([]ReapedBinding, error) {
+	id := s.opts.ref(key)
+	var out []ReapedBinding
+	if err := s.view("ListReaped", func(tx *sql.Tx) error {
+		if _, err := sqliteLicense(tx, id); err != nil {
+			return err
+		}
+		rows, err := tx.Query("SELECT server_id, first_seen, last_seen, seen_count, reaped_at FROM reaped WHERE license_id = ? ORDER BY seq DESC", id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var rb ReapedBinding
+			if err := rows.Scan(&rb.ServerID, timeCol{&rb.FirstSeen}, timeCol{&rb.LastSeen}, &rb.SeenCount, timeCol{&rb.ReapedAt}); err != nil {
+				return err
+			}
+			out = append(out, rb)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) GetInfo(key string) (LicenseInfo, error) {
+	id := s.opts.ref(key)
+	var info LicenseInfo
+	now := time.Now().UTC()
+	if err := s.view("GetInfo", func(tx *sql.Tx) error {
+		lic, err := sqliteLicense(tx, id)
+		if err != nil {
+			return err
+		}
+		bindings, err := sqliteBindings(tx, id)
+		if err != nil {
+			return err
+		}
+		bindings = s.opts.live(lic, bindings, now)
+		info = LicenseInfo{License: lic, Used: len(bindings), Bindings: bindings}
+		return nil
+	}); err != nil {
+		return LicenseInfo{}, err
+	}
+	return info, nil
+}
+
+func (s *SQLiteStore) ListLicenses() ([]LicenseInfo, error) {
+	var out []LicenseInfo
+	if err := s.view("ListLicenses", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT " + licenseCols + ", " + s.usedCol(time.Now()) + " FROM licenses l ORDER BY created_at DESC, id DESC")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var used int
+			lic, err := scanLicense(rows, &used)
+			if err != nil {
+				return err
+			}
+			out = append(out, LicenseInfo{License: lic, Used: used})
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) Activate(key string, serverID string) (ActivateResult, error) {
+	serverID = strings.TrimSpace(serverID)
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason == "not_found" {
+		s.emit(events.Event{Type: events.NotFound, ServerID: serverID})
+	}
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
+	}
+
+	var res ActivateResult
+	var ev *events.Event
+	now := time.Now().UTC()
+	activate := func(tx *sql.Tx) error {
+		lic, err := sqliteLicense(tx, id)
+		if errors.Is(err, ErrNotFound) {
+			res = ActivateResult{OK: false, Reason: "not_found"}
+			ev = &events.Event{Type: events.NotFound, Fingerprint: license.Fingerprint(key), ServerID: serverID}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		newEvent := func(t events.Type, used int) *events.Event {
+			return &events.Event{Type: t, LicenseID: lic.ID, Fingerprint: lic.Fingerprint, Note: lic.Note, ServerID: serverID, Used: used, Limit: lic.Limit}
+		}
+		if !lic.Enabled {
+			res = ActivateResult{OK: false, Reason: "disabled", Limit: lic.Limit}
+			ev = newEvent(events.Disabled, 0)
+			return nil
+		}
+		status := lic.Status(now)
+		if status == StatusExpired {
+			res = ActivateResult{OK: false, Reason: "expired", Enabled: true, Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
+			return nil
+		}
+		if _, err := s.reapLicense(tx, lic, now, serverID); err != nil {
+			return err
+		}
+
+		upd, err := tx.Exec("UPDATE bindings SET last_seen = ?, seen_count = seen_count + 1 WHERE license_id = ? AND server_id = ?", sqlTime(now), id, serverID)
+		if err != nil {
+			return err
+		}
+		existing, _ := upd.RowsAffected()
+		newBinding := existing == 0
+		if newBinding {
+			used, err := countBindings(tx, id)
+			if err != nil {
+				return err
+			}
+			if used >= lic.Limit {
+				res = ActivateResult{OK: false, Reason: "limit_reached", Enabled: true, Used: used, Limit: lic.Limit}
+				ev = newEvent(events.LimitReached, used)
+				return nil
+			}
+			if _, err := tx.Exec("INSERT INTO bindings (license_id, server_id, first_seen, last_seen, seen_count) VALUES (?, ?, ?, ?, 1)",
+				id, serverID, sqlTime(now), sqlTime(now)); err != nil {
+				return err
+			}
+			if !lic.Floating() {
+				if err := s.audit(tx, AuditEvent{Action: AuditBind, Key: id, ServerID: serverID}); err != nil {
+					return err
+				}
+			}
+		}
+		used, err := countBindings(tx, id)
+		if err != nil {
+			return err
+		}
+		if newBinding && !lic.Floating() {
+			ev = newEvent(events.Bound, used)
+		}
+		reason := "ok"
+		if status == StatusInGrace {
+			reason = "in_grace"
+		}
+		res = ActivateResult{OK: true, Reason: reason, Enabled: true, Used: used, Limit: lic.Limit, NewlyBound: newBinding,
+			ExpiresAt: expiresAt(lic), LeaseExpiresAt: s.opts.leaseExpiry(lic, now)}
+		return nil
+	}
+	if err := s.update("Activate", func(tx *sql.Tx) error {
+		ev = nil
+		if err := activate(tx); err != nil || ev == nil {
+			return err
+		}
+		s.stamp(ev)
+		return s.enqueueWebhooks(tx, *ev)
+	}); err != nil {
+		return ActivateResult{}, err
+	}
+	if ev != nil {
+		s.opts.Events.Publish(*ev)
+	}
+	return res, nil
+}
+
+func (s *SQLiteStore) stamp(ev *events.Event) {
+	ev.At = time.Now().UTC()
+	ev.Actor = s.actor
+}
+
+func (s *SQLiteStore) emit(ev events.Event) {
+	s.stamp(&ev)
+	s.opts.Events.Publish(ev)
+}
+
+func (s *SQLiteStore) Validate(key string, serverID string) (ActivateResult, error) {
+	serverID = strings.TrimSpace(serverID)
+	id, reason := s.opts.clientRef(key, serverID)
+	if reason != "" {
+		return ActivateResult{OK: false, Reason: reason}, nil
+	}
+
+	var res ActivateResult
+	now := time.Now().UTC()
+	if err := s.update("Validate", func(tx *sql.Tx) error {
+		lic, err := sqliteLicense(tx, id)
+		if errors.Is(err, ErrNotFound) {
+			res = ActivateResult{OK: false, Reason: "not_found"}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if lic.Floating() {
+			// A lapsed lease, this server's included, is gone.
+			if _, err := s.reapLicense(tx, lic, now, ""); err != nil {
+				return err
+			}
+		}
+		used, err := countBindings(tx, id)
+		if err != nil {
+			return err
+		}
+		res = ActivateResult{Enabled: lic.Enabled, Used: used, Limit: lic.Limit, ExpiresAt: expiresAt(lic)}
+		status := lic.Status(now)
+		switch {
+		case !lic.Enabled:
+			res.Reason = "disabled"
+			return nil
+		case status == StatusExpired:
+			res.Reason = "expired"
+			return nil
+		}
+		upd, err := tx.Exec("UPDATE bindings SET last_seen = ?, seen_count = seen_count + 1 WHERE license_id = ? AND server_id = ?", sqlTime(now), id, serverID)
+		if err != nil {
+			return err
+		}
+		if n, _ := upd.RowsAffected(); n == 0 {
+			res.Reason = "not_bound"
+			return nil
+		}
+		res.OK = true
+		res.Reason = "ok"
+		res.LeaseExpiresAt = s.opts.leaseExpiry(lic, now)
+		if status == StatusInGrace {
+			res.Reason = "in_grace"
+		}
+		return nil
+	}); err != nil {
+		return ActivateResult{}, err
+	}
+	return res, nil
+}
+
+func (s *SQLiteStore) ListAudit(filter AuditFilter) ([]AuditEvent, error) {
+	var where []string
+	var args []any
+	if filter.Key != "" {
+		where = append(where, "license_id = ?")
+		args = append(args, s.opts.ref(filter.Key))
+	}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "at >= ?")
+		args = append(args, sqlTime(filter.Since))
+	}
+	q := "SELECT at, actor, action, license_id, server_id, detail FROM audit"
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY at DESC, seq DESC"
+	if filter.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	var out []AuditEvent
+	if err := s.view("ListAudit", func(tx *sql.Tx) error {
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var ev AuditEvent
+			if err := rows.Scan(timeCol{&ev.At}, &ev.Actor, &ev.Action, &ev.Key, &ev.ServerID, &ev.Detail); err != nil {
+				return err
+			}
+			out = append(out, ev)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (s *SQLiteStore) CreateAPIToken(name string) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", APIToken{}, fmt.Errorf("name is required")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", APIToken{}, err
+	}
+	token := "kpt_" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	h := hashToken(token)
+	t := APIToken{ID: h[:12], Name: name, CreatedAt: time.Now().UTC()}
+	if err := s.update("CreateAPIToken", func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO api_tokens (hash, id, name, created_at) VALUES (?, ?, ?, ?)", h, t.ID, t.Name, sqlTime(t.CreatedAt)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("created %s (%s)", t.ID, name)})
+	}); err != nil {
+		return "", APIToken{}, err
+	}
+	return token, t, nil
+}
+
+func (s *SQLiteStore) ListAPITokens() ([]APIToken, error) {
+	var out []APIToken
+	if err := s.view("ListAPITokens", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id, name, created_at, last_used FROM api_tokens ORDER BY created_at DESC")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var t APIToken
+			if err := rows.Scan(&t.ID, &t.Name, timeCol{&t.CreatedAt}, timeCol{&t.LastUsed}); err != nil {
+				return err
+			}
+			out = append(out, t)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) RevokeAPIToken(id string) error {
+	return s.update("RevokeAPIToken", func(tx *sql.Tx) error {
+		var name string
+		err := tx.QueryRow("SELECT name FROM api_tokens WHERE id = ?", id).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnauthorized
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM api_tokens WHERE id = ?", id); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditToken, Detail: fmt.Sprintf("revoked %s (%s)", id, name)})
+	})
+}
+
+func (s *SQLiteStore) AuthAPIToken(token string) (APIToken, error) {
+	h := hashToken(strings.TrimSpace(token))
+	var t APIToken
+	if err := s.view("AuthAPIToken", func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT id, name, created_at, last_used FROM api_tokens WHERE hash = ?", h).
+			Scan(&t.ID, &t.Name, timeCol{&t.CreatedAt}, timeCol{&t.LastUsed})
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnauthorized
+		}
+		return err
+	}); err != nil {
+		return APIToken{}, err
+	}
+	now := time.Now().UTC()
+	if now.Sub(t.LastUsed) < tokenTouchEvery {
+		return t, nil
+	}
+	t.LastUsed = now
+	err := s.update("AuthAPIToken", func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE api_tokens SET last_used = ? WHERE hash = ?", sqlTime(now), h)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	return t, err
+}
@@ -0,0 +1,240 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+)
+
+func (s *SQLiteStore) CreateWebhook(rawURL string, eventTypes []string) (Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid url %q", rawURL)
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(events.Types, events.Type(t)) {
+			return Webhook{}, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	id := make([]byte, 6)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return Webhook{}, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	w := Webhook{ID: hex.EncodeToString(id), URL: u.String(), Secret: "whsec_" + hex.EncodeToString(secret), Events: eventTypes, CreatedAt: time.Now().UTC()}
+	if err := s.update("CreateWebhook", func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO webhooks (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)",
+			w.ID, w.URL, w.Secret, jsonList(w.Events), sqlTime(w.CreatedAt)); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditWebhook, Detail: fmt.Sprintf("created %s %s", w.ID, w.URL)})
+	}); err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s *SQLiteStore) ListWebhooks() ([]Webhook, error) {
+	var out []Webhook
+	if err := s.view("ListWebhooks", func(tx *sql.Tx) error {
+		var err error
+		out, err = sqliteWebhooks(tx, "created_at, id")
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func sqliteWebhooks(tx *sql.Tx, order string) ([]Webhook, error) {
+	rows, err := tx.Query("SELECT id, url, secret, events, created_at FROM webhooks ORDER BY " + order)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, listCol{&w.Events}, timeCol{&w.CreatedAt}); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) DeleteWebhook(id string) error {
+	return s.update("DeleteWebhook", func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrWebhookNotFound
+		}
+		if _, err := tx.Exec("DELETE FROM outbox WHERE webhook_id = ?", id); err != nil {
+			return err
+		}
+		return s.audit(tx, AuditEvent{Action: AuditWebhook, Detail: "deleted " + id})
+	})
+}
+
+// deliveryID is the outbox row's sequence number, hex encoded like the
+// bbolt outbox key.
+func deliveryID(seq int64) string {
+	return hex.EncodeToString(seqKey(uint64(seq)))
+}
+
+// deliverySeq reverses deliveryID; ok is false for IDs of another shape.
+func deliverySeq(id string) (seq int64, ok bool, err error) {
+	k, err := hex.DecodeString(id)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(k) != 8 {
+		return 0, false, nil
+	}
+	return int64(binary.BigEndian.Uint64(k)), true, nil
+}
+
+// enqueueWebhooks queues ev for every subscribed webhook in the same
+// transaction that produced it, so no event is lost on a crash.
+func (s *SQLiteStore) enqueueWebhooks(tx *sql.Tx, ev events.Event) error {
+	hooks, err := sqliteWebhooks(tx, "id")
+	if err != nil {
+		return err
+	}
+	for _, w := range hooks {
+		if !w.Wants(string(ev.Type)) {
+			continue
+		}
+		// Insert first to learn the sequence the payload embeds.
+		res, err := tx.Exec(`INSERT INTO outbox (webhook_id, event, payload, state, next_attempt, created_at, updated_at)
+			VALUES (?, ?, '', ?, ?, ?, ?)`, w.ID, string(ev.Type), DeliveryPending, sqlTime(ev.At), sqlTime(ev.At), sqlTime(ev.At))
+		if err != nil {
+			return err
+		}
+		seq, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		payload, _ := json.Marshal(webhookPayload{
+			ID: deliveryID(seq), Type: string(ev.Type), At: ev.At, LicenseID: ev.LicenseID, Fingerprint: ev.Fingerprint,
+			Note: ev.Note, ServerID: ev.ServerID, Used: ev.Used, Limit: ev.Limit,
+		})
+		if _, err := tx.Exec("UPDATE outbox SET payload = ? WHERE seq = ?", payload, seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const deliveryCols = "seq, webhook_id, event, payload, state, attempts, next_attempt, last_status, last_error, created_at, updated_at"
+
+func scanDeliveries(rows *sql.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var seq int64
+		var payload []byte
+		if err := rows.Scan(&seq, &d.WebhookID, &d.Event, &payload, &d.State, &d.Attempts, timeCol{&d.NextAttempt},
+			&d.LastStatus, &d.LastError, timeCol{&d.CreatedAt}, timeCol{&d.UpdatedAt}); err != nil {
+			return nil, err
+		}
+		d.ID = deliveryID(seq)
+		d.Payload = json.RawMessage(payload)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// limitClause returns " LIMIT n", or nothing for limit <= 0.
+func limitClause(limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", limit)
+}
+
+func (s *SQLiteStore) DueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	if err := s.view("DueDeliveries", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT "+deliveryCols+" FROM outbox WHERE state = ? AND next_attempt <= ? ORDER BY seq"+limitClause(limit),
+			DeliveryPending, sqlTime(now))
+		if err != nil {
+			return err
+		}
+		out, err = scanDeliveries(rows)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) RecordDelivery(id string, attempt DeliveryAttempt) error {
+	seq, ok, err := deliverySeq(id)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+	if !ok {
+		return nil
+	}
+	state, next := DeliveryPending, sqlTime(attempt.Retry)
+	switch {
+	case attempt.OK:
+		state, next = DeliveryDelivered, nil
+	case attempt.Retry.IsZero():
+		state = DeliveryFailed
+	}
+	// A missing row means the webhook was deleted while the delivery was
+	// in flight; that is not an error.
+	return s.update("RecordDelivery", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE outbox SET attempts = attempts + 1, last_status = ?, last_error = ?, updated_at = ?,
+			state = ?, next_attempt = COALESCE(?, next_attempt) WHERE seq = ?`,
+			attempt.Status, attempt.Error, sqlTime(time.Now().UTC()), state, next, seq)
+		return err
+	})
+}
+
+func (s *SQLiteStore) ListDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	var out []WebhookDelivery
+	if err := s.view("ListDeliveries", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT "+deliveryCols+" FROM outbox WHERE webhook_id = ? ORDER BY seq DESC"+limitClause(limit), webhookID)
+		if err != nil {
+			return err
+		}
+		out, err = scanDeliveries(rows)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) PruneDeliveries(before time.Time) (int, error) {
+	n := 0
+	err := s.update("PruneDeliveries", func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM outbox WHERE state != ? AND updated_at < ?", DeliveryPending, sqlTime(before))
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		n = int(affected)
+		return nil
+	})
+	return n, err
+}
@@ -1,20 +1,157 @@
 package store
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
 
 type License struct {
-	Key       string    `json:"key"`
-	Limit     int       `json:"limit"`
+	// ID is a keyed hash of the license key and is what the store indexes
+	// by; the key itself is never stored and Key is only filled in on the
+	// value returned from CreateLicense.
+	ID          string    `json:"id"`
+	Key         string    `json:"key,omitempty"`
+	Fingerprint string    `json:"fingerprint"`
+	Limit       int       `json:"limit"`
+	Note        string    `json:"note"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	// ExpiresAt is zero for perpetual licenses.
+	ExpiresAt time.Time `json:"expires_at"`
+	// GraceDays keeps an expired license usable for a few more days
+	// (activation then reports "in_grace").
+	GraceDays int `json:"grace_days"`
+	// IdleDays overrides the store-wide inactivity TTL after which a
+	// binding stops counting toward Limit; zero uses the default.
+	IdleDays int `json:"idle_days"`
+	// BatchID groups licenses made by one CreateLicenses call.
+	BatchID string `json:"batch_id,omitempty"`
+	// CustomerID links the license to a Customer; empty if unassigned.
+	CustomerID string `json:"customer_id,omitempty"`
+	// Mode is ModeNodeLocked (also when empty) or ModeFloating.
+	Mode string `json:"mode,omitempty"`
+}
+
+// License modes. A node-locked license keeps up to Limit servers bound
+// until they are released; a floating one hands out up to Limit concurrent
+// leases that lapse unless renewed by heartbeat (Options.LeaseTTL).
+const (
+	ModeNodeLocked = "node_locked"
+	ModeFloating   = "floating"
+)
+
+// Floating reports whether the license hands out leases.
+func (l License) Floating() bool { return l.Mode == ModeFloating }
+
+// modeName spells out the empty (default) mode for audit details.
+func modeName(mode string) string {
+	if mode == "" {
+		return ModeNodeLocked
+	}
+	return mode
+}
+
+func checkMode(mode string) error {
+	switch mode {
+	case "", ModeNodeLocked, ModeFloating:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (%s or %s)", mode, ModeNodeLocked, ModeFloating)
+}
+
+const (
+	StatusActive  = "active"
+	StatusInGrace = "in_grace"
+	StatusExpired = "expired"
+)
+
+// Status reports whether the license is active, inside its grace window or
+// expired at the given time. It does not look at Enabled.
+func (l License) Status(now time.Time) string {
+	if l.ExpiresAt.IsZero() || now.Before(l.ExpiresAt) {
+		return StatusActive
+	}
+	if now.Before(l.ExpiresAt.AddDate(0, 0, l.GraceDays)) {
+		return StatusInGrace
+	}
+	return StatusExpired
+}
+
+type CreateOptions struct {
+	// ValidFor is the lifetime of the license; zero means perpetual.
+	ValidFor  time.Duration
+	GraceDays int
+	// CustomerID assigns the new license to an existing customer.
+	CustomerID string
+}
+
+// Customer is who a license was sold to.
+type Customer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Username is the customer's Telegram username, without "@".
+	Username  string    `json:"username,omitempty"`
+	Contact   string    `json:"contact,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LicenseFilter statuses.
+const (
+	FilterEnabled  = "enabled"
+	FilterDisabled = "disabled"
+	// FilterFull matches licenses with every seat taken.
+	FilterFull = "full"
+	// FilterUnused matches licenses with no bound server.
+	FilterUnused = "unused"
+)
+
+// LicenseFilter selects licenses for QueryLicenses; zero fields match all.
+type LicenseFilter struct {
+	Status string
+	// IdleSince matches licenses with no server seen at or after it.
+	IdleSince time.Time
+	// Search matches a case-insensitive substring of the note, fingerprint,
+	// ID or batch ID, or a full license key.
+	Search string
+	// CustomerID matches one customer's licenses.
+	CustomerID string
+}
+
+// LicensePage is one page of QueryLicenses, newest first. Next and Prev are
+// cursors for the neighbouring pages, empty at either end.
+type LicensePage struct {
+	Items []LicenseInfo `json:"items"`
+	Next  string        `json:"next,omitempty"`
+	Prev  string        `json:"prev,omitempty"`
+}
+
+// MaxBatchSize caps the number of keys CreateLicenses makes at once.
+const MaxBatchSize = 1000
+
+// Batch summarises the licenses created by one CreateLicenses call.
+type Batch struct {
+	ID        string    `json:"id"`
 	Note      string    `json:"note"`
-	Enabled   bool      `json:"enabled"`
+	Limit     int       `json:"limit"`
 	CreatedAt time.Time `json:"created_at"`
+	Size      int       `json:"size"`
+	Enabled   int       `json:"enabled"`
 }
 
 type ServerBinding struct {
-	ServerID   string    `json:"server_id"`
-	FirstSeen  time.Time `json:"first_seen"`
-	LastSeen   time.Time `json:"last_seen"`
-	SeenCount  int       `json:"seen_count"`
+	ServerID  string    `json:"server_id"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	SeenCount int       `json:"seen_count"`
+}
+
+// ReapedBinding is a binding that was released for inactivity.
+type ReapedBinding struct {
+	ServerBinding
+	ReapedAt time.Time `json:"reaped_at"`
 }
 
 type LicenseInfo struct {
@@ -24,21 +161,297 @@ type LicenseInfo struct {
 }
 
 type ActivateResult struct {
-	OK         bool   `json:"ok"`
-	Reason     string `json:"reason"`
-	Used       int    `json:"used"`
-	Limit      int    `json:"limit"`
-	NewlyBound bool   `json:"newly_bound"`
+	OK     bool   `json:"ok"`
+	Reason string `json:"reason"`
+	// Enabled is the license's current state; false as well when the
+	// license was not found.
+	Enabled    bool `json:"enabled"`
+	Used       int  `json:"used"`
+	Limit      int  `json:"limit"`
+	NewlyBound bool `json:"newly_bound"`
+	// ExpiresAt is omitted for perpetual licenses.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LeaseExpiresAt is set for floating licenses: the seat is released
+	// unless the client sends a heartbeat before then.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	// Token is a signed activation token (see license.VerifyToken) clients
+	// can check offline; empty when signing is not configured.
+	Token string `json:"token,omitempty"`
+}
+
+// Audit actions.
+const (
+	AuditCreate   = "create"
+	AuditSetLimit = "set_limit"
+	AuditEnable   = "enable"
+	AuditDisable  = "disable"
+	AuditRenew    = "renew"
+	AuditSetIdle  = "set_idle"
+	AuditSetMode  = "set_mode"
+	AuditBind     = "bind"
+	AuditUnbind   = "unbind"
+	AuditReset    = "reset"
+	AuditReap     = "reap"
+	AuditToken    = "api_token"
+	AuditAdmin    = "admin"
+	AuditImport   = "import"
+	AuditWebhook  = "webhook"
+	AuditCustomer = "customer"
+)
+
+type AuditEvent struct {
+	At       time.Time `json:"at"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	Key      string    `json:"key,omitempty"`
+	ServerID string    `json:"server_id,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// AuditFilter selects audit events; zero fields match everything.
+type AuditFilter struct {
+	Key    string
+	Action string
+	Since  time.Time
+	// Limit caps the number of (newest first) events returned.
+	Limit int
+}
+
+// APIToken describes an admin API bearer token. Only a hash of the token is
+// stored; the plain value is shown once at creation.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"`
+}
+
+// Admin roles, from least to most privileged.
+const (
+	RoleReadOnly = "readonly"
+	RoleOperator = "operator"
+	RoleOwner    = "owner"
+)
+
+// RoleLevel orders roles for permission checks; unknown roles are 0.
+func RoleLevel(role string) int {
+	switch role {
+	case RoleReadOnly:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleOwner:
+		return 3
+	}
+	return 0
+}
+
+// Admin is a Telegram chat allowed to use the bot.
+type Admin struct {
+	ChatID  int64     `json:"chat_id"`
+	Role    string    `json:"role"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at"`
+	// Muted lists notification event types this admin does not receive.
+	Muted []string `json:"muted,omitempty"`
+}
+
+// Webhook is an outbound subscription to license events. Secret keys the
+// HMAC-SHA256 signature of each delivery.
+type Webhook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	// Events lists the subscribed event types; empty means all.
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to event type t.
+func (w Webhook) Wants(t string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook in the outbox.
+type WebhookDelivery struct {
+	ID          string          `json:"id"`
+	WebhookID   string          `json:"webhook_id"`
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	State       string          `json:"state"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastStatus  int             `json:"last_status,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// DeliveryAttempt is the outcome of one delivery try. A failed attempt with
+// a zero Retry gives up on the delivery.
+type DeliveryAttempt struct {
+	OK     bool
+	Status int
+	Error  string
+	Retry  time.Time
+}
+
+// Export formats.
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ExportOptions selects what Export writes.
+type ExportOptions struct {
+	// Format is FormatJSONL (one LicenseInfo per line, lossless) or
+	// FormatCSV (one row per license, for spreadsheets).
+	Format string
+	// BatchID limits the export to one batch.
+	BatchID string
+}
+
+// Import conflict policies, applied when a license ID already exists.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+type ImportOptions struct {
+	Format     string
+	OnConflict string
+}
+
+type ImportResult struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
 }
 
+// Store methods that take a key accept either the license key or its ID,
+// except Activate, which only accepts the key.
 type Store interface {
 	Close() error
+	// As returns a view of the store whose changes are attributed to
+	// actor in the audit log (e.g. "tg:123", "api").
+	As(actor string) Store
 
-	CreateLicense(limit int, note string) (License, error)
+	CreateLicense(limit int, note string, opts CreateOptions) (License, error)
+	// CreateLicenses makes n licenses sharing a new batch ID in a single
+	// transaction. As with CreateLicense, the keys are only returned here.
+	CreateLicenses(n, limit int, note string, opts CreateOptions) ([]License, error)
+	// ListBatches returns batches newest first.
+	ListBatches() ([]Batch, error)
+	// SetBatchEnabled enables or disables every license in a batch and
+	// returns how many changed.
+	SetBatchEnabled(batchID string, enabled bool) (int, error)
 	SetLimit(key string, limit int) (License, error)
 	SetEnabled(key string, enabled bool) (License, error)
+	// Renew extends the expiry by d, counting from now if the license
+	// has already expired.
+	Renew(key string, d time.Duration) (License, error)
+	// Unbind releases the seat held by serverID (ErrNotBound if none).
+	Unbind(key string, serverID string) error
+	// ResetBindings releases every seat and returns how many were freed.
+	ResetBindings(key string) (int, error)
+	// SetIdleDays sets the per-license inactivity TTL (0 = default).
+	SetIdleDays(key string, days int) (License, error)
+	// SetMode switches between ModeNodeLocked and ModeFloating. Current
+	// bindings are kept and become leases (or permanent seats).
+	SetMode(key string, mode string) (License, error)
+	// ReapStale releases bindings idle longer than their TTL across all
+	// licenses and returns how many were released. Lapsed floating leases
+	// are deleted silently and not counted.
+	ReapStale() (int, error)
+	ListReaped(key string) ([]ReapedBinding, error)
 	GetInfo(key string) (LicenseInfo, error)
 	ListLicenses() ([]LicenseInfo, error)
+	// QueryLicenses returns up to limit licenses matching filter, starting
+	// at cursor ("" for the newest), without loading the rest.
+	QueryLicenses(filter LicenseFilter, cursor string, limit int) (LicensePage, error)
 
+	// Activate binds serverID, or for a floating license leases it a seat;
+	// only unexpired leases count toward Limit. Leases come and go with
+	// every client restart, so taking one is not audited and publishes no
+	// Bound event, and a lapsed lease is deleted without a reaped record or
+	// audit entry; only new permanent seats are announced.
 	Activate(key string, serverID string) (ActivateResult, error)
+	// Validate is a heartbeat for an existing binding: it refreshes
+	// LastSeen (renewing a lease) and reports the license state but never
+	// binds a new seat (reason "not_bound", also for a lapsed lease). Like
+	// Activate it only accepts the key.
+	Validate(key string, serverID string) (ActivateResult, error)
+
+	ListAudit(filter AuditFilter) ([]AuditEvent, error)
+
+	// CreateAPIToken returns the plain token; it cannot be recovered later.
+	CreateAPIToken(name string) (string, APIToken, error)
+	ListAPITokens() ([]APIToken, error)
+	RevokeAPIToken(id string) error
+	// AuthAPIToken returns ErrUnauthorized for unknown tokens.
+	AuthAPIToken(token string) (APIToken, error)
+
+	// GetAdmin returns ErrAdminNotFound for chats that are not admins.
+	GetAdmin(chatID int64) (Admin, error)
+	ListAdmins() ([]Admin, error)
+	// PutAdmin adds an admin or changes its role/name.
+	PutAdmin(a Admin) (Admin, error)
+	RemoveAdmin(chatID int64) error
+	// SetAdminMuted replaces the admin's muted notification types.
+	SetAdminMuted(chatID int64, muted []string) (Admin, error)
+
+	// Backup writes a consistent snapshot of the database to w while the
+	// store stays online.
+	Backup(w io.Writer) (int64, error)
+
+	CreateCustomer(c Customer) (Customer, error)
+	// GetCustomer returns ErrCustomerNotFound for unknown IDs.
+	GetCustomer(id string) (Customer, error)
+	// ListCustomers returns customers sorted by name.
+	ListCustomers() ([]Customer, error)
+	// SetLicenseCustomer links a license to a customer; an empty
+	// customerID unlinks it.
+	SetLicenseCustomer(key string, customerID string) (License, error)
+	// SetCustomerEnabled enables or disables every license of a customer
+	// and returns how many changed.
+	SetCustomerEnabled(customerID string, enabled bool) (int, error)
+
+	// CreateWebhook subscribes url to the given event types (all if
+	// empty) with a newly generated signing secret.
+	CreateWebhook(url string, eventTypes []string) (Webhook, error)
+	ListWebhooks() ([]Webhook, error)
+	// DeleteWebhook also drops its queued deliveries.
+	DeleteWebhook(id string) error
+	// DueDeliveries returns up to limit pending deliveries whose next
+	// attempt is not after now, oldest first.
+	DueDeliveries(now time.Time, limit int) ([]WebhookDelivery, error)
+	RecordDelivery(id string, attempt DeliveryAttempt) error
+	// ListDeliveries returns a webhook's deliveries, newest first.
+	ListDeliveries(webhookID string, limit int) ([]WebhookDelivery, error)
+	// PruneDeliveries removes finished deliveries last updated before t.
+	PruneDeliveries(before time.Time) (int, error)
+
+	// Export writes every license with its bindings and returns how many
+	// licenses were written.
+	Export(w io.Writer, opts ExportOptions) (int, error)
+	// Import loads licenses in an Export format in a single transaction.
+	// Records carry either the ID (only meaningful under the same key
+	// secret) or the plain key, which is hashed on import.
+	Import(r io.Reader, opts ImportOptions) (ImportResult, error)
 }
@@ -0,0 +1,135 @@
+package telegram
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func (b *Bot) handleNewBatchInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <count> <limit> <days> [note]")
+		return
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n <= 0 || n > store.MaxBatchSize {
+		b.reply(chatID, fmt.Sprintf("count باید بین 1 و %d باشد", store.MaxBatchSize))
+		return
+	}
+	limit, err := strconv.Atoi(fields[1])
+	if err != nil || limit <= 0 {
+		b.reply(chatID, "limit نامعتبر است")
+		return
+	}
+	days, err := strconv.Atoi(fields[2])
+	if err != nil || days < 0 {
+		b.reply(chatID, "days نامعتبر است")
+		return
+	}
+	note := strings.Join(fields[3:], " ")
+	lics, err := b.as(chatID).CreateLicenses(n, limit, note, store.CreateOptions{ValidFor: time.Duration(days) * 24 * time.Hour})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.setState(chatID, stateNone)
+
+	var buf bytes.Buffer
+	for _, lic := range lics {
+		buf.WriteString(lic.Key + "\n")
+	}
+	batchID := lics[0].BatchID
+	b.sendDocument(chatID, "batch-"+batchID+".txt", buf.Bytes(),
+		fmt.Sprintf("%d کلید ساخته شد (batch %s). کلیدها فقط همین یک بار ارسال می‌شوند.", len(lics), batchID))
+	b.cmdBatch(chatID, batchID)
+}
+
+func (b *Bot) cmdBatches(chatID int64) {
+	batches, err := b.st.ListBatches()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	if len(batches) == 0 {
+		b.sendMenu(chatID, "هیچ batch‌ای وجود ندارد")
+		return
+	}
+	if len(batches) > 20 {
+		batches = batches[:20]
+	}
+	lines := []string{"آخرین batch‌ها:"}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(batches)+1)
+	for _, bt := range batches {
+		lines = append(lines, fmt.Sprintf("- %s | %s | %d کلید (%d فعال) | %s", bt.ID, bt.CreatedAt.Format("2006-01-02"), bt.Size, bt.Enabled, safeNote(bt.Note)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📦 "+bt.ID, "batch:"+bt.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) cmdBatch(chatID int64, batchID string) {
+	batches, err := b.st.ListBatches()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	for _, bt := range batches {
+		if bt.ID != batchID {
+			continue
+		}
+		text := fmt.Sprintf("Batch: %s\nCreated: %s\nKeys: %d\nEnabled: %d\nLimit: %d\nNote: %s",
+			bt.ID, bt.CreatedAt.Format("2006-01-02 15:04"), bt.Size, bt.Enabled, bt.Limit, safeNote(bt.Note))
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = keyboard(b.roleOf(chatID),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("✅ فعال کردن همه", "ben:"+bt.ID),
+				tgbotapi.NewInlineKeyboardButtonData("⛔ غیرفعال کردن همه", "bdis:"+bt.ID),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("📤 CSV", "bexp:"+bt.ID),
+				tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+			),
+		)
+		_, _ = b.api.Send(msg)
+		return
+	}
+	b.sendMenu(chatID, "batch پیدا نشد")
+}
+
+func (b *Bot) cmdSetBatchEnabled(chatID int64, batchID string, enabled bool) {
+	n, err := b.as(chatID).SetBatchEnabled(batchID, enabled)
+	if errors.Is(err, store.ErrBatchNotFound) {
+		b.sendMenu(chatID, "batch پیدا نشد")
+		return
+	}
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("OK\n%d لایسنس تغییر کرد", n))
+	b.cmdBatch(chatID, batchID)
+}
+
+func (b *Bot) cmdExportBatch(chatID int64, batchID string) {
+	var buf bytes.Buffer
+	n, err := b.st.Export(&buf, store.ExportOptions{Format: store.FormatCSV, BatchID: batchID})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.sendDocument(chatID, "batch-"+batchID+".csv", buf.Bytes(), fmt.Sprintf("%d لایسنس", n))
+}
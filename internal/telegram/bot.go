@@ -2,77 +2,137 @@ package telegram
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"kypaqet-license-bot/internal/metrics"
 	"kypaqet-license-bot/internal/store"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// sender is the part of the Telegram API the handlers use. *tgbotapi.BotAPI
+// implements it; tests substitute a recording fake.
+type sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
 type Bot struct {
-	api         *tgbotapi.BotAPI
-	adminChatID int64
+	api sender
+	// tg receives updates in Run and RunWebhook; nil in tests.
+	tg *tgbotapi.BotAPI
+	// ownerChatID is always an owner; other admins are kept in the store.
+	ownerChatID int64
 	st          store.Store
 
 	mu     sync.Mutex
 	states map[int64]pendingState
+	// filters holds each chat's search text and idle date, which do not
+	// fit in callback data.
+	filters map[int64]store.LicenseFilter
+	// webhookUpdates queues updates from WebhookHandler for RunWebhook.
+	webhookUpdates chan tgbotapi.Update
 }
 
 type pendingState string
 
 const (
-	stateNone        pendingState = ""
-	stateNewLicense  pendingState = "new_license"
-	stateAskInfo     pendingState = "ask_info"
-	stateAskSetLimit pendingState = "ask_setlimit"
-	stateAskEnable   pendingState = "ask_enable"
-	stateAskDisable  pendingState = "ask_disable"
+	stateNone         pendingState = ""
+	stateNewLicense   pendingState = "new_license"
+	stateAskInfo      pendingState = "ask_info"
+	stateAskSetLimit  pendingState = "ask_setlimit"
+	stateAskEnable    pendingState = "ask_enable"
+	stateAskDisable   pendingState = "ask_disable"
+	stateNewTimed     pendingState = "new_timed"
+	stateAskRenew     pendingState = "ask_renew"
+	stateAskIdle      pendingState = "ask_idle"
+	stateAskToken     pendingState = "ask_token"
+	stateAskAdmin     pendingState = "ask_admin"
+	stateNewBatch     pendingState = "new_batch"
+	stateAskWebhook   pendingState = "ask_webhook"
+	stateAskSearch    pendingState = "ask_search"
+	stateAskIdleSince pendingState = "ask_idle_since"
+	stateNewCustomer  pendingState = "cust_new"
+	stateAskLink      pendingState = "ask_link"
 )
 
-func NewBot(token string, adminChatID int64, st store.Store) (*Bot, error) {
+func NewBot(token string, ownerChatID int64, st store.Store) (*Bot, error) {
 	api, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, err
 	}
 	api.Debug = false
-	return &Bot{api: api, adminChatID: adminChatID, st: st, states: map[int64]pendingState{}}, nil
+	b, err := newBot(api, ownerChatID, st)
+	if err != nil {
+		return nil, err
+	}
+	b.tg = api
+	return b, nil
+}
+
+func newBot(api sender, ownerChatID int64, st store.Store) (*Bot, error) {
+	b := &Bot{api: api, ownerChatID: ownerChatID, st: st, states: map[int64]pendingState{}, filters: map[int64]store.LicenseFilter{},
+		webhookUpdates: make(chan tgbotapi.Update, webhookQueue)}
+	if err := b.ensureOwner(); err != nil {
+		return nil, err
+	}
+	return b, nil
 }
 
+// Run receives updates by long polling. It removes any registered webhook
+// first, since Telegram refuses getUpdates while one is set.
 func (b *Bot) Run(ctx context.Context) error {
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("delete webhook: %w", err)
+	}
 	upd := tgbotapi.NewUpdate(0)
 	upd.Timeout = 30
-	updates := b.api.GetUpdatesChan(upd)
+	updates := b.tg.GetUpdatesChan(upd)
+	defer b.tg.StopReceivingUpdates()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case u := <-updates:
-			if u.CallbackQuery != nil {
-				b.handleCallback(u.CallbackQuery)
-				continue
-			}
-			if u.Message != nil {
-				b.handleMessage(u.Message)
-				continue
-			}
+			b.dispatch(u)
 		}
 	}
 }
 
+func (b *Bot) dispatch(u tgbotapi.Update) {
+	if u.CallbackQuery != nil {
+		metrics.TelegramUpdates.WithLabelValues("callback").Inc()
+		b.handleCallback(u.CallbackQuery)
+		return
+	}
+	if u.Message != nil {
+		metrics.TelegramUpdates.WithLabelValues("message").Inc()
+		b.handleMessage(u.Message)
+		return
+	}
+	metrics.TelegramUpdates.WithLabelValues("other").Inc()
+}
+
 func (b *Bot) handleMessage(m *tgbotapi.Message) {
+	if m.Chat == nil {
+		return
+	}
 	chatID := m.Chat.ID
 	text := strings.TrimSpace(m.Text)
 	if text == "" {
 		return
 	}
 
-	// Only admin can manage
-	if chatID != b.adminChatID {
+	// Only admins can manage
+	role := b.roleOf(chatID)
+	if role == "" {
 		msg := tgbotapi.NewMessage(chatID, "این ربات فقط برای ادمین فعال است.")
 		_, _ = b.api.Send(msg)
 		return
@@ -86,6 +146,11 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 	}
 
 	st := b.getState(chatID)
+	if st != stateNone && !allowed(role, stateRole(st)) {
+		b.setState(chatID, stateNone)
+		b.sendMenu(chatID, "اجازه این کار را ندارید")
+		return
+	}
 	switch st {
 	case stateNewLicense:
 		b.handleNewLicenseInput(chatID, text)
@@ -98,6 +163,43 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 	case stateAskSetLimit:
 		b.handleSetLimitInput(chatID, text)
 		return
+	case stateNewTimed:
+		b.handleNewTimedInput(chatID, text)
+		return
+	case stateAskRenew:
+		b.handleRenewInput(chatID, text)
+		return
+	case stateAskIdle:
+		b.handleIdleInput(chatID, text)
+		return
+	case stateAskToken:
+		b.setState(chatID, stateNone)
+		b.cmdCreateToken(chatID, text)
+		b.sendMenu(chatID, "")
+		return
+	case stateAskAdmin:
+		b.handleAdminInput(chatID, text)
+		return
+	case stateNewBatch:
+		b.handleNewBatchInput(chatID, text)
+		return
+	case stateAskWebhook:
+		b.handleWebhookInput(chatID, text)
+		return
+	case stateAskSearch:
+		b.setState(chatID, stateNone)
+		b.setFilter(chatID, store.LicenseFilter{Search: text})
+		b.cmdQuery(chatID, filterSearch, "")
+		return
+	case stateAskIdleSince:
+		b.handleIdleSinceInput(chatID, text)
+		return
+	case stateNewCustomer:
+		b.handleNewCustomerInput(chatID, text)
+		return
+	case stateAskLink:
+		b.handleLinkInput(chatID, text)
+		return
 	case stateAskEnable:
 		b.setState(chatID, stateNone)
 		b.cmdEnable(chatID, []string{text}, true)
@@ -115,15 +217,19 @@ func (b *Bot) handleMessage(m *tgbotapi.Message) {
 }
 
 func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
+	// Callbacks from inline-mode messages have no chat to act in.
+	if q.Message == nil || q.Message.Chat == nil {
+		_ = b.answerCallback(q.ID, "")
+		return
+	}
 	chatID := q.Message.Chat.ID
 
-	// Only admin can manage
-	if chatID != b.adminChatID {
+	// Only admins can manage, and only what their role allows
+	data := strings.TrimSpace(q.Data)
+	if !allowed(b.roleOf(chatID), callbackRole(data)) {
 		_ = b.answerCallback(q.ID, "اجازه دسترسی ندارید")
 		return
 	}
-
-	data := strings.TrimSpace(q.Data)
 	_ = b.answerCallback(q.ID, "")
 
 	switch {
@@ -133,9 +239,121 @@ func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
 	case data == "new":
 		b.setState(chatID, stateNewLicense)
 		b.reply(chatID, "عدد limit را بفرست (اختیاری: بعدش note)\nمثال: 3 مشتری-الف")
+	case data == "new_timed":
+		b.setState(chatID, stateNewTimed)
+		b.reply(chatID, "فرمت: <limit> <days> <grace_days> [note]\nمثال: 3 30 7 مشتری-الف")
+	case data == "ask_renew":
+		b.setState(chatID, stateAskRenew)
+		b.reply(chatID, "فرمت: <license> <days>\nمثال: KYPAQET-.... 30")
+	case data == "ask_idle":
+		b.setState(chatID, stateAskIdle)
+		b.reply(chatID, "فرمت: <license> <days>\nسرورهایی که این مدت فعالیت نداشته باشند آزاد می‌شوند (0 = پیش‌فرض)")
+	case strings.HasPrefix(data, "reaped:"):
+		b.setState(chatID, stateNone)
+		b.cmdReaped(chatID, strings.TrimPrefix(data, "reaped:"))
+	case strings.HasPrefix(data, "hist:"):
+		b.setState(chatID, stateNone)
+		b.cmdHistory(chatID, strings.TrimPrefix(data, "hist:"))
+	case data == "tokens":
+		b.setState(chatID, stateNone)
+		b.cmdTokens(chatID)
+	case data == "tok_new":
+		b.setState(chatID, stateAskToken)
+		b.reply(chatID, "یک نام برای توکن API بفرست (مثلاً billing):")
+	case strings.HasPrefix(data, "tokrev:"):
+		b.setState(chatID, stateNone)
+		if err := b.as(chatID).RevokeAPIToken(strings.TrimPrefix(data, "tokrev:")); err != nil {
+			b.reply(chatID, "خطا: "+err.Error())
+		} else {
+			b.reply(chatID, "OK\nتوکن باطل شد")
+		}
+		b.cmdTokens(chatID)
+	case data == "admins":
+		b.setState(chatID, stateNone)
+		b.cmdAdmins(chatID)
+	case data == "adm_add":
+		b.setState(chatID, stateAskAdmin)
+		b.reply(chatID, "فرمت: <chat_id> <owner|operator|readonly> [name]\nمثال: 123456789 operator پشتیبانی")
+	case strings.HasPrefix(data, "adm_rm:"):
+		b.setState(chatID, stateNone)
+		b.cmdRemoveAdmin(chatID, strings.TrimPrefix(data, "adm_rm:"))
+		b.cmdAdmins(chatID)
+	case data == "notif":
+		b.setState(chatID, stateNone)
+		b.cmdNotifications(chatID)
+	case strings.HasPrefix(data, "mute:"):
+		b.setState(chatID, stateNone)
+		b.cmdToggleMute(chatID, strings.TrimPrefix(data, "mute:"))
+	case data == "hooks":
+		b.setState(chatID, stateNone)
+		b.cmdWebhooks(chatID)
+	case data == "hook_new":
+		b.setState(chatID, stateAskWebhook)
+		b.reply(chatID, webhookPrompt())
+	case strings.HasPrefix(data, "hookrm:"):
+		b.setState(chatID, stateNone)
+		b.cmdDeleteWebhook(chatID, strings.TrimPrefix(data, "hookrm:"))
+	case strings.HasPrefix(data, "hooklog:"):
+		b.setState(chatID, stateNone)
+		b.cmdWebhookLog(chatID, strings.TrimPrefix(data, "hooklog:"))
+	case data == "custs":
+		b.setState(chatID, stateNone)
+		b.cmdCustomers(chatID)
+	case data == "cust_new":
+		b.setState(chatID, stateNewCustomer)
+		b.reply(chatID, "فرمت: <name> | [@username] | [contact] | [notes]\nمثال: شرکت الف | @alpha | 0912... | نماینده تهران")
+	case strings.HasPrefix(data, "cust:"):
+		b.setState(chatID, stateNone)
+		b.cmdCustomer(chatID, strings.TrimPrefix(data, "cust:"))
+	case strings.HasPrefix(data, "clic:"):
+		b.setState(chatID, stateNone)
+		b.cmdCustomerLicenses(chatID, strings.TrimPrefix(data, "clic:"))
+	case strings.HasPrefix(data, "cen:"):
+		b.setState(chatID, stateNone)
+		b.cmdSetCustomerEnabled(chatID, strings.TrimPrefix(data, "cen:"), true)
+	case strings.HasPrefix(data, "cdis:"):
+		b.setState(chatID, stateNone)
+		b.cmdSetCustomerEnabled(chatID, strings.TrimPrefix(data, "cdis:"), false)
+	case data == "ask_link":
+		b.setState(chatID, stateAskLink)
+		b.reply(chatID, "فرمت: <license> <customer_id>\nبرای جدا کردن لایسنس از مشتری به جای ID علامت - بفرست")
+	case data == "backup":
+		b.setState(chatID, stateNone)
+		b.cmdBackup(chatID)
+	case data == "new_batch":
+		b.setState(chatID, stateNewBatch)
+		b.reply(chatID, fmt.Sprintf("فرمت: <count> <limit> <days> [note]\ndays=0 یعنی بدون انقضا، حداکثر %d کلید\nمثال: 100 1 365 نماینده-الف", store.MaxBatchSize))
+	case data == "batches":
+		b.setState(chatID, stateNone)
+		b.cmdBatches(chatID)
+	case strings.HasPrefix(data, "batch:"):
+		b.setState(chatID, stateNone)
+		b.cmdBatch(chatID, strings.TrimPrefix(data, "batch:"))
+	case strings.HasPrefix(data, "ben:"):
+		b.setState(chatID, stateNone)
+		b.cmdSetBatchEnabled(chatID, strings.TrimPrefix(data, "ben:"), true)
+	case strings.HasPrefix(data, "bdis:"):
+		b.setState(chatID, stateNone)
+		b.cmdSetBatchEnabled(chatID, strings.TrimPrefix(data, "bdis:"), false)
+	case strings.HasPrefix(data, "bexp:"):
+		b.setState(chatID, stateNone)
+		b.cmdExportBatch(chatID, strings.TrimPrefix(data, "bexp:"))
+	case strings.HasPrefix(data, "export:"):
+		b.setState(chatID, stateNone)
+		b.cmdExport(chatID, strings.TrimPrefix(data, "export:"))
+	case strings.HasPrefix(data, "lp:"):
+		b.setState(chatID, stateNone)
+		code, cursor, _ := strings.Cut(strings.TrimPrefix(data, "lp:"), ":")
+		b.cmdQuery(chatID, code, cursor)
+	case data == "ask_search":
+		b.setState(chatID, stateAskSearch)
+		b.reply(chatID, "بخشی از note، اثر کلید (مثلاً ABCD)، ID یا batch را بفرست (یا کل کلید):")
+	case data == "ask_idle_since":
+		b.setState(chatID, stateAskIdleSince)
+		b.reply(chatID, "تاریخ را بفرست (YYYY-MM-DD) یا تعداد روز؛ لایسنس‌هایی که از آن زمان هیچ سروری فعالیت نداشته نمایش داده می‌شوند:")
 	case data == "list":
 		b.setState(chatID, stateNone)
-		b.cmdListWithButtons(chatID)
+		b.cmdQuery(chatID, filterAll, "")
 	case data == "ask_info":
 		b.setState(chatID, stateAskInfo)
 		b.reply(chatID, "کلید لایسنس را ارسال کن:")
@@ -153,6 +371,40 @@ func (b *Bot) handleCallback(q *tgbotapi.CallbackQuery) {
 		key := strings.TrimPrefix(data, "info:")
 		b.cmdInfo(chatID, []string{key})
 		b.sendMenu(chatID, "")
+	case strings.HasPrefix(data, "ub:"):
+		b.setState(chatID, stateNone)
+		rest := strings.TrimPrefix(data, "ub:")
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			b.sendMenu(chatID, "عملیات نامعتبر")
+			return
+		}
+		b.cmdUnbind(chatID, rest[:i], rest[i+1:])
+		b.cmdInfo(chatID, []string{rest[:i]})
+	case strings.HasPrefix(data, "mode:"):
+		b.setState(chatID, stateNone)
+		rest := strings.TrimPrefix(data, "mode:")
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			b.sendMenu(chatID, "عملیات نامعتبر")
+			return
+		}
+		b.cmdSetMode(chatID, rest[:i], rest[i+1:])
+		b.cmdInfo(chatID, []string{rest[:i]})
+	case strings.HasPrefix(data, "rst:"):
+		b.setState(chatID, stateNone)
+		key := strings.TrimPrefix(data, "rst:")
+		msg := tgbotapi.NewMessage(chatID, "همه سرورهای این لایسنس آزاد شوند؟\n"+key)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ بله", "rst!:"+key),
+			tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+		))
+		_, _ = b.api.Send(msg)
+	case strings.HasPrefix(data, "rst!:"):
+		b.setState(chatID, stateNone)
+		key := strings.TrimPrefix(data, "rst!:")
+		b.cmdResetBindings(chatID, key)
+		b.sendMenu(chatID, "")
 	default:
 		b.sendMenu(chatID, "عملیات نامعتبر")
 	}
@@ -164,7 +416,7 @@ func (b *Bot) sendMenu(chatID int64, title string) {
 	}
 	msg := tgbotapi.NewMessage(chatID, title)
 	msg.DisableWebPagePreview = true
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+	msg.ReplyMarkup = keyboard(b.roleOf(chatID),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("➕ ساخت لایسنس", "new"),
 			tgbotapi.NewInlineKeyboardButtonData("📋 لیست", "list"),
@@ -173,49 +425,41 @@ func (b *Bot) sendMenu(chatID int64, title string) {
 			tgbotapi.NewInlineKeyboardButtonData("ℹ️ اطلاعات", "ask_info"),
 			tgbotapi.NewInlineKeyboardButtonData("✏️ تغییر لیمیت", "ask_setlimit"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏳ لایسنس زمان‌دار", "new_timed"),
+			tgbotapi.NewInlineKeyboardButtonData("🔁 تمدید", "ask_renew"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📦 ساخت گروهی", "new_batch"),
+			tgbotapi.NewInlineKeyboardButtonData("🗂 batch‌ها", "batches"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 مشتری‌ها", "custs"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏱ TTL غیرفعالی", "ask_idle"),
+			tgbotapi.NewInlineKeyboardButtonData("🔑 توکن API", "tokens"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✅ فعال", "ask_enable"),
 			tgbotapi.NewInlineKeyboardButtonData("⛔ غیرفعال", "ask_disable"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👥 ادمین‌ها", "admins"),
+			tgbotapi.NewInlineKeyboardButtonData("💾 بکاپ", "backup"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📤 خروجی CSV", "export:"+store.FormatCSV),
+			tgbotapi.NewInlineKeyboardButtonData("📤 خروجی JSONL", "export:"+store.FormatJSONL),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔔 اعلان‌ها", "notif"),
+			tgbotapi.NewInlineKeyboardButtonData("🪝 وب‌هوک‌ها", "hooks"),
+		),
 	)
 	_, _ = b.api.Send(msg)
 }
 
-func (b *Bot) cmdListWithButtons(chatID int64) {
-	list, err := b.st.ListLicenses()
-	if err != nil {
-		b.reply(chatID, "خطا: "+err.Error())
-		return
-	}
-	if len(list) == 0 {
-		b.reply(chatID, "هیچ لایسنس‌ای وجود ندارد")
-		return
-	}
-
-	lines := []string{"آخرین لایسنس‌ها (برای جزئیات روی دکمه بزن):"}
-	max := len(list)
-	if max > 20 {
-		max = 20
-	}
-	buttons := make([][]tgbotapi.InlineKeyboardButton, 0)
-	for i := 0; i < max; i++ {
-		it := list[i]
-		lines = append(lines, fmt.Sprintf("- %s | %d/%d | enabled=%v", it.License.Key, it.Used, it.License.Limit, it.License.Enabled))
-		// One button per row (keeps callback data short and UI clean)
-		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("ℹ️ " + shortKey(it.License.Key), "info:"+it.License.Key),
-		))
-	}
-	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
-	))
-
-	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
-	msg.DisableWebPagePreview = true
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-	_, _ = b.api.Send(msg)
-}
-
 func shortKey(k string) string {
 	// Keep button label short; full key is in callback data.
 	k = strings.TrimSpace(k)
@@ -238,13 +482,87 @@ func (b *Bot) handleNewLicenseInput(chatID int64, text string) {
 	}
 	note := strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
 	note = strings.TrimSpace(note)
-	lic, err := b.st.CreateLicense(limit, note)
+	lic, err := b.as(chatID).CreateLicense(limit, note, store.CreateOptions{})
 	if err != nil {
 		b.reply(chatID, "خطا: "+err.Error())
 		return
 	}
 	b.setState(chatID, stateNone)
-	b.reply(chatID, fmt.Sprintf("License ساخته شد:\n%s\nLimit: %d\nEnabled: %v\nNote: %s", lic.Key, lic.Limit, lic.Enabled, safeNote(lic.Note)))
+	b.reply(chatID, fmt.Sprintf("License ساخته شد (کلید فقط همین یک بار نمایش داده می‌شود):\n%s\nLimit: %d\nEnabled: %v\nNote: %s", lic.Key, lic.Limit, lic.Enabled, safeNote(lic.Note)))
+	b.sendMenu(chatID, "")
+}
+
+func (b *Bot) handleNewTimedInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <limit> <days> <grace_days> [note]")
+		return
+	}
+	limit, err := strconv.Atoi(fields[0])
+	if err != nil || limit <= 0 {
+		b.reply(chatID, "limit نامعتبر است")
+		return
+	}
+	days, err := strconv.Atoi(fields[1])
+	if err != nil || days <= 0 {
+		b.reply(chatID, "days نامعتبر است")
+		return
+	}
+	grace, err := strconv.Atoi(fields[2])
+	if err != nil || grace < 0 {
+		b.reply(chatID, "grace_days نامعتبر است")
+		return
+	}
+	note := strings.Join(fields[3:], " ")
+	lic, err := b.as(chatID).CreateLicense(limit, note, store.CreateOptions{ValidFor: time.Duration(days) * 24 * time.Hour, GraceDays: grace})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.setState(chatID, stateNone)
+	b.reply(chatID, fmt.Sprintf("License ساخته شد (کلید فقط همین یک بار نمایش داده می‌شود):\n%s\nLimit: %d\nExpires: %s\nGrace: %d days\nNote: %s", lic.Key, lic.Limit, formatExpiry(lic), lic.GraceDays, safeNote(lic.Note)))
+	b.sendMenu(chatID, "")
+}
+
+func (b *Bot) handleRenewInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <license> <days>")
+		return
+	}
+	days, err := strconv.Atoi(fields[1])
+	if err != nil || days <= 0 {
+		b.reply(chatID, "days نامعتبر است")
+		return
+	}
+	b.setState(chatID, stateNone)
+	lic, err := b.as(chatID).Renew(fields[0], time.Duration(days)*24*time.Hour)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+	} else {
+		b.reply(chatID, fmt.Sprintf("OK\n%s\nExpires: %s", lic.Fingerprint, formatExpiry(lic)))
+	}
+	b.sendMenu(chatID, "")
+}
+
+func (b *Bot) handleIdleInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <license> <days>")
+		return
+	}
+	days, err := strconv.Atoi(fields[1])
+	if err != nil || days < 0 {
+		b.reply(chatID, "days نامعتبر است")
+		return
+	}
+	b.setState(chatID, stateNone)
+	lic, err := b.as(chatID).SetIdleDays(fields[0], days)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+	} else {
+		b.reply(chatID, fmt.Sprintf("OK\n%s\nIdle TTL: %s", lic.Fingerprint, formatIdle(lic)))
+	}
 	b.sendMenu(chatID, "")
 }
 
@@ -286,33 +604,6 @@ func (b *Bot) getState(chatID int64) pendingState {
 	return b.states[chatID]
 }
 
-func (b *Bot) cmdNew(chatID int64, raw string, args []string) {
-	if len(args) < 1 {
-		b.reply(chatID, "استفاده: /new <limit> [note]")
-		return
-	}
-	limit, err := strconv.Atoi(args[0])
-	if err != nil || limit <= 0 {
-		b.reply(chatID, "limit نامعتبر است")
-		return
-	}
-
-	// note = rest of message after first arg
-	note := ""
-	idx := strings.Index(raw, args[0])
-	if idx >= 0 {
-		rest := strings.TrimSpace(raw[idx+len(args[0]):])
-		rest = strings.TrimSpace(strings.TrimPrefix(rest, " "))
-		note = strings.TrimSpace(rest)
-	}
-	lic, err := b.st.CreateLicense(limit, note)
-	if err != nil {
-		b.reply(chatID, "خطا: "+err.Error())
-		return
-	}
-	b.reply(chatID, fmt.Sprintf("License ساخته شد:\n%s\nLimit: %d\nEnabled: %v\nNote: %s", lic.Key, lic.Limit, lic.Enabled, safeNote(lic.Note)))
-}
-
 func (b *Bot) cmdInfo(chatID int64, args []string) {
 	if len(args) != 1 {
 		b.reply(chatID, "استفاده: /info <license>")
@@ -324,15 +615,35 @@ func (b *Bot) cmdInfo(chatID int64, args []string) {
 		return
 	}
 	lines := []string{
-		"License: " + info.License.Key,
+		"License: " + info.License.Fingerprint,
+		"ID: " + info.License.ID,
 		fmt.Sprintf("Enabled: %v", info.License.Enabled),
 		fmt.Sprintf("Limit: %d", info.License.Limit),
 		fmt.Sprintf("Used: %d", info.Used),
+		"Mode: " + formatMode(info.License),
+		"Expires: " + formatExpiry(info.License),
+		fmt.Sprintf("Grace: %d days", info.License.GraceDays),
+		"Idle TTL: " + formatIdle(info.License),
 		"Note: " + safeNote(info.License.Note),
 		"Created: " + info.License.CreatedAt.Format(time.RFC3339),
 	}
+	if info.License.BatchID != "" {
+		lines = append(lines, "Batch: "+info.License.BatchID)
+	}
+	if id := info.License.CustomerID; id != "" {
+		name := id
+		if c, err := b.st.GetCustomer(id); err == nil {
+			name = fmt.Sprintf("%s (%s)", safeNote(c.Name), id)
+		}
+		lines = append(lines, "Customer: "+name)
+	}
+	buttons := make([][]tgbotapi.InlineKeyboardButton, 0)
 	if len(info.Bindings) > 0 {
-		lines = append(lines, "Servers:")
+		if info.License.Floating() {
+			lines = append(lines, "Leases:")
+		} else {
+			lines = append(lines, "Servers:")
+		}
 		max := len(info.Bindings)
 		if max > 30 {
 			max = 30
@@ -340,32 +651,62 @@ func (b *Bot) cmdInfo(chatID int64, args []string) {
 		for i := 0; i < max; i++ {
 			s := info.Bindings[i]
 			lines = append(lines, fmt.Sprintf("- %s (last: %s)", s.ServerID, s.LastSeen.Format(time.RFC3339)))
+			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑 "+shortKey(s.ServerID), "ub:"+info.License.ID+":"+serverRef(s.ServerID)),
+			))
 		}
 		if len(info.Bindings) > max {
 			lines = append(lines, fmt.Sprintf("... (%d more)", len(info.Bindings)-max))
 		}
 	}
-	b.reply(chatID, strings.Join(lines, "\n"))
+	if info.Used > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("♻️ آزاد کردن همه سرورها", "rst:"+info.License.ID),
+		))
+	}
+	if info.License.Floating() {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔒 تغییر به قفل روی سرور", "mode:"+info.License.ID+":"+store.ModeNodeLocked),
+		))
+	} else {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔁 تغییر به شناور (floating)", "mode:"+info.License.ID+":"+store.ModeFloating),
+		))
+	}
+	if id := info.License.CustomerID; id != "" {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 مشتری", "cust:"+id),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🧹 آزادشده‌ها", "reaped:"+info.License.ID),
+		tgbotapi.NewInlineKeyboardButtonData("🕘 تاریخچه", "hist:"+info.License.ID),
+	))
+
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = keyboard(b.roleOf(chatID), buttons...)
+	_, _ = b.api.Send(msg)
 }
 
-func (b *Bot) cmdList(chatID int64) {
-	list, err := b.st.ListLicenses()
+func (b *Bot) cmdReaped(chatID int64, key string) {
+	list, err := b.st.ListReaped(key)
 	if err != nil {
 		b.reply(chatID, "خطا: "+err.Error())
 		return
 	}
 	if len(list) == 0 {
-		b.reply(chatID, "هیچ لایسنس‌ای وجود ندارد")
+		b.reply(chatID, "هیچ سروری به خاطر غیرفعالی آزاد نشده است")
 		return
 	}
-	lines := []string{"Licenses:"}
+	lines := []string{"سرورهای آزادشده (غیرفعال):"}
 	max := len(list)
-	if max > 50 {
-		max = 50
+	if max > 30 {
+		max = 30
 	}
 	for i := 0; i < max; i++ {
-		it := list[i]
-		lines = append(lines, fmt.Sprintf("- %s | %d/%d | enabled=%v", it.License.Key, it.Used, it.License.Limit, it.License.Enabled))
+		r := list[i]
+		lines = append(lines, fmt.Sprintf("- %s (last: %s, reaped: %s)", r.ServerID, r.LastSeen.Format(time.RFC3339), r.ReapedAt.Format(time.RFC3339)))
 	}
 	if len(list) > max {
 		lines = append(lines, fmt.Sprintf("... (%d more)", len(list)-max))
@@ -373,6 +714,116 @@ func (b *Bot) cmdList(chatID int64) {
 	b.reply(chatID, strings.Join(lines, "\n"))
 }
 
+// serverRef is a short stable reference to a server id; callback data is
+// limited to 64 bytes so the id itself may not fit next to the key.
+func serverRef(serverID string) string {
+	sum := sha256.Sum256([]byte(serverID))
+	return hex.EncodeToString(sum[:4])
+}
+
+func (b *Bot) cmdUnbind(chatID int64, key, ref string) {
+	info, err := b.st.GetInfo(key)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	for _, s := range info.Bindings {
+		if serverRef(s.ServerID) != ref {
+			continue
+		}
+		if err := b.as(chatID).Unbind(key, s.ServerID); err != nil {
+			b.reply(chatID, "خطا: "+err.Error())
+			return
+		}
+		b.reply(chatID, fmt.Sprintf("OK\nسرور %s آزاد شد", s.ServerID))
+		return
+	}
+	b.reply(chatID, "خطا: "+store.ErrNotBound.Error())
+}
+
+func (b *Bot) cmdSetMode(chatID int64, key, mode string) {
+	lic, err := b.as(chatID).SetMode(key, mode)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("OK\n%s\nMode: %s", lic.Fingerprint, formatMode(lic)))
+}
+
+func (b *Bot) cmdResetBindings(chatID int64, key string) {
+	n, err := b.as(chatID).ResetBindings(key)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("OK\n%d سرور آزاد شد", n))
+}
+
+const historySize = 20
+
+func (b *Bot) cmdHistory(chatID int64, key string) {
+	events, err := b.st.ListAudit(store.AuditFilter{Key: key, Limit: historySize})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	if len(events) == 0 {
+		b.reply(chatID, "تاریخچه‌ای ثبت نشده است")
+		return
+	}
+	lines := []string{fmt.Sprintf("آخرین %d رویداد:", len(events))}
+	for _, ev := range events {
+		line := fmt.Sprintf("- %s %s by %s", ev.At.Format(time.RFC3339), ev.Action, ev.Actor)
+		if ev.ServerID != "" {
+			line += " server=" + ev.ServerID
+		}
+		if ev.Detail != "" {
+			line += " (" + ev.Detail + ")"
+		}
+		lines = append(lines, line)
+	}
+	b.reply(chatID, strings.Join(lines, "\n"))
+}
+
+func (b *Bot) cmdTokens(chatID int64) {
+	list, err := b.st.ListAPITokens()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	lines := []string{"توکن‌های API (برای باطل کردن روی دکمه بزن):"}
+	buttons := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, t := range list {
+		last := "never"
+		if !t.LastUsed.IsZero() {
+			last = t.LastUsed.Format(time.RFC3339)
+		}
+		lines = append(lines, fmt.Sprintf("- %s | %s | last used: %s", t.ID, t.Name, last))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 "+t.Name, "tokrev:"+t.ID),
+		))
+	}
+	if len(list) == 0 {
+		lines = append(lines, "-")
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ توکن جدید", "tok_new"),
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) cmdCreateToken(chatID int64, name string) {
+	token, t, err := b.as(chatID).CreateAPIToken(name)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("توکن ساخته شد (فقط همین یک بار نمایش داده می‌شود):\n%s\nID: %s\nName: %s", token, t.ID, t.Name))
+}
+
 func (b *Bot) cmdSetLimit(chatID int64, args []string) {
 	if len(args) != 2 {
 		b.reply(chatID, "استفاده: /setlimit <license> <limit>")
@@ -383,12 +834,12 @@ func (b *Bot) cmdSetLimit(chatID int64, args []string) {
 		b.reply(chatID, "limit نامعتبر است")
 		return
 	}
-	lic, err := b.st.SetLimit(args[0], limit)
+	lic, err := b.as(chatID).SetLimit(args[0], limit)
 	if err != nil {
 		b.reply(chatID, "خطا: "+err.Error())
 		return
 	}
-	b.reply(chatID, fmt.Sprintf("OK\n%s\nNew limit: %d", lic.Key, lic.Limit))
+	b.reply(chatID, fmt.Sprintf("OK\n%s\nNew limit: %d", lic.Fingerprint, lic.Limit))
 }
 
 func (b *Bot) cmdEnable(chatID int64, args []string, enabled bool) {
@@ -400,12 +851,17 @@ func (b *Bot) cmdEnable(chatID int64, args []string, enabled bool) {
 		}
 		return
 	}
-	lic, err := b.st.SetEnabled(args[0], enabled)
+	lic, err := b.as(chatID).SetEnabled(args[0], enabled)
 	if err != nil {
 		b.reply(chatID, "خطا: "+err.Error())
 		return
 	}
-	b.reply(chatID, fmt.Sprintf("OK\n%s\nEnabled: %v", lic.Key, lic.Enabled))
+	b.reply(chatID, fmt.Sprintf("OK\n%s\nEnabled: %v", lic.Fingerprint, lic.Enabled))
+}
+
+// as attributes store changes made from chatID in the audit log.
+func (b *Bot) as(chatID int64) store.Store {
+	return b.st.As(fmt.Sprintf("tg:%d", chatID))
 }
 
 func (b *Bot) reply(chatID int64, text string) {
@@ -414,8 +870,25 @@ func (b *Bot) reply(chatID int64, text string) {
 	_, _ = b.api.Send(msg)
 }
 
-func helpText() string {
-	return "برای مدیریت از دکمه‌های منو استفاده کن. /menu"
+func formatExpiry(lic store.License) string {
+	if lic.ExpiresAt.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s)", lic.ExpiresAt.Format(time.RFC3339), lic.Status(time.Now()))
+}
+
+func formatIdle(lic store.License) string {
+	if lic.IdleDays == 0 {
+		return "default"
+	}
+	return fmt.Sprintf("%d days", lic.IdleDays)
+}
+
+func formatMode(lic store.License) string {
+	if lic.Floating() {
+		return "floating (leases)"
+	}
+	return "node-locked"
 }
 
 func safeNote(s string) string {
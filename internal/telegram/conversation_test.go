@@ -0,0 +1,268 @@
+package telegram
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ownerChat    int64 = 100
+	operatorChat int64 = 200
+	readerChat   int64 = 300
+	strangerChat int64 = 400
+)
+
+// harness drives a Bot with a recordingSender and an in-memory store,
+// feeding it updates as Telegram would.
+type harness struct {
+	t   *testing.T
+	bot *Bot
+	tg  *recordingSender
+	st  store.Store
+	// updateID numbers the fake updates.
+	updateID int
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	tg := &recordingSender{}
+	st := store.NewMemory(store.Options{KeySecret: []byte("test-secret")})
+	bot, err := newBot(tg, ownerChat, st)
+	if err != nil {
+		t.Fatalf("newBot: %v", err)
+	}
+	for chat, role := range map[int64]string{operatorChat: store.RoleOperator, readerChat: store.RoleReadOnly} {
+		if _, err := st.PutAdmin(store.Admin{ChatID: chat, Role: role}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &harness{t: t, bot: bot, tg: tg, st: st}
+}
+
+// step is one admin action and what the bot must answer. A zero chat means
+// the owner.
+type step struct {
+	chat int64
+	// Exactly one of send (message text) and press (callback data).
+	send  string
+	press string
+	// want lists substrings that must appear in the replies to this step.
+	want []string
+	// buttons lists callback data that must be offered in the replies.
+	buttons []string
+	// hidden lists callback data that must not be offered.
+	hidden []string
+	// state is the chat's pending input state after the step.
+	state pendingState
+}
+
+// run replays steps in order and checks each one's replies and the
+// resulting state.
+func (h *harness) run(steps ...step) {
+	h.t.Helper()
+	for i, s := range steps {
+		chat := s.chat
+		if chat == 0 {
+			chat = ownerChat
+		}
+		before := h.tg.count()
+		h.updateID++
+		u := tgbotapi.Update{UpdateID: h.updateID}
+		msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chat}, Text: s.send}
+		if s.press != "" {
+			u.CallbackQuery = &tgbotapi.CallbackQuery{ID: "cb", Data: s.press, Message: msg}
+		} else {
+			u.Message = msg
+		}
+		h.bot.dispatch(u)
+
+		var text []string
+		var buttons []string
+		for _, m := range h.tg.since(before) {
+			if m.ChatID != chat {
+				h.t.Errorf("step %d: message sent to chat %d, want %d", i, m.ChatID, chat)
+			}
+			text = append(text, m.Text)
+			buttons = append(buttons, m.Buttons...)
+		}
+		all := strings.Join(text, "\n---\n")
+		for _, w := range s.want {
+			if !strings.Contains(all, w) {
+				h.t.Errorf("step %d (%q%q): reply missing %q; got:\n%s", i, s.send, s.press, w, all)
+			}
+		}
+		for _, b := range s.buttons {
+			if !slices.Contains(buttons, b) {
+				h.t.Errorf("step %d: button %q not offered; got %v", i, b, buttons)
+			}
+		}
+		for _, b := range s.hidden {
+			if slices.Contains(buttons, b) {
+				h.t.Errorf("step %d: button %q should be hidden", i, b)
+			}
+		}
+		if got := h.bot.getState(chat); got != s.state {
+			h.t.Errorf("step %d: state = %q, want %q", i, got, s.state)
+		}
+	}
+}
+
+// newLicense creates a license directly in the store and returns its key.
+func (h *harness) newLicense(limit int) string {
+	h.t.Helper()
+	lic, err := h.st.CreateLicense(limit, "", store.CreateOptions{})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return lic.Key
+}
+
+// license reads a license back from the store by key or ID.
+func (h *harness) license(key string) store.License {
+	h.t.Helper()
+	info, err := h.st.GetInfo(key)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return info.License
+}
+
+// licenses returns every stored license.
+func (h *harness) licenses() []store.License {
+	h.t.Helper()
+	list, err := h.st.ListLicenses()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	out := make([]store.License, 0, len(list))
+	for _, info := range list {
+		out = append(out, info.License)
+	}
+	return out
+}
+
+func TestCreateLicenseConversation(t *testing.T) {
+	h := newHarness(t)
+	h.run(
+		step{send: "/start", want: []string{"منوی مدیریت لایسنس"}, buttons: []string{"new", "tokens", "admins"}},
+		step{press: "new", want: []string{"limit"}, state: stateNewLicense},
+		step{send: "abc", want: []string{"limit نامعتبر است"}, state: stateNewLicense},
+		step{send: "3 مشتری الف", want: []string{"License ساخته شد", "Limit: 3", "Note: مشتری الف"}},
+	)
+	lics := h.licenses()
+	if len(lics) != 1 {
+		t.Fatalf("licenses = %d, want 1", len(lics))
+	}
+	lic := lics[0]
+	if lic.Limit != 3 || lic.Note != "مشتری الف" || !lic.Enabled {
+		t.Errorf("stored license = %+v", lic)
+	}
+	hist, err := h.st.ListAudit(store.AuditFilter{Key: lic.ID, Action: store.AuditCreate})
+	if err != nil || len(hist) != 1 || hist[0].Actor != "tg:100" {
+		t.Errorf("create audit = %+v, %v", hist, err)
+	}
+}
+
+func TestSetLimitConversation(t *testing.T) {
+	h := newHarness(t)
+	key := h.newLicense(1)
+	h.run(
+		step{chat: operatorChat, press: "ask_setlimit", want: []string{"<license> <limit>"}, state: stateAskSetLimit},
+		step{chat: operatorChat, send: key, want: []string{"ورودی نامعتبر"}, state: stateAskSetLimit},
+		step{chat: operatorChat, send: key + " 0", want: []string{"limit نامعتبر است"}, state: stateAskSetLimit},
+		step{chat: operatorChat, send: key + " 7", want: []string{"New limit: 7"}},
+		step{chat: operatorChat, press: "ask_setlimit", state: stateAskSetLimit},
+		step{chat: operatorChat, send: "KYPAQET-0000-0000-0000-0000 2", want: []string{"خطا:"}},
+	)
+	if lic := h.license(key); lic.Limit != 7 {
+		t.Errorf("limit = %d, want 7", lic.Limit)
+	}
+}
+
+func TestEnableDisableConversation(t *testing.T) {
+	h := newHarness(t)
+	key := h.newLicense(2)
+	h.run(
+		step{chat: operatorChat, press: "ask_disable", state: stateAskDisable},
+		step{chat: operatorChat, send: key, want: []string{"Enabled: false"}},
+	)
+	if lic := h.license(key); lic.Enabled {
+		t.Fatal("license still enabled")
+	}
+	h.run(
+		step{chat: operatorChat, press: "ask_enable", state: stateAskEnable},
+		step{chat: operatorChat, send: key, want: []string{"Enabled: true"}},
+	)
+	if lic := h.license(key); !lic.Enabled {
+		t.Fatal("license still disabled")
+	}
+}
+
+func TestInfoCallback(t *testing.T) {
+	h := newHarness(t)
+	key := h.newLicense(4)
+	lic := h.license(key)
+	h.run(
+		step{chat: readerChat, press: "info:" + lic.ID, want: []string{"License: " + lic.Fingerprint, "Limit: 4", "Used: 0"},
+			buttons: []string{"hist:" + lic.ID}},
+		step{chat: readerChat, press: "ask_info", state: stateAskInfo},
+		step{chat: readerChat, send: key, want: []string{"ID: " + lic.ID}},
+	)
+}
+
+func TestModeToggle(t *testing.T) {
+	h := newHarness(t)
+	key := h.newLicense(2)
+	lic := h.license(key)
+	toFloating := "mode:" + lic.ID + ":" + store.ModeFloating
+	h.run(
+		step{chat: readerChat, press: "info:" + lic.ID, want: []string{"Mode: node-locked"}, hidden: []string{toFloating}},
+		step{chat: operatorChat, press: "info:" + lic.ID, buttons: []string{toFloating}},
+		step{chat: operatorChat, press: toFloating, want: []string{"Mode: floating"},
+			buttons: []string{"mode:" + lic.ID + ":" + store.ModeNodeLocked}},
+		step{chat: operatorChat, press: "mode:" + lic.ID + ":bogus", want: []string{"خطا:"}},
+	)
+	if lic := h.license(key); !lic.Floating() {
+		t.Errorf("mode = %q, want floating", lic.Mode)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	h := newHarness(t)
+	h.run(
+		step{chat: strangerChat, send: "/start", want: []string{"فقط برای ادمین"}},
+		step{chat: readerChat, send: "/menu", buttons: []string{"list", "ask_info"}, hidden: []string{"new", "ask_setlimit", "tokens", "admins"}},
+		step{chat: operatorChat, send: "/menu", buttons: []string{"new", "ask_setlimit"}, hidden: []string{"tokens", "admins"}},
+		// A forbidden callback is only answered, with no message.
+		step{chat: readerChat, press: "new"},
+		step{chat: operatorChat, press: "admins"},
+	)
+	if got := h.tg.answers[len(h.tg.answers)-2:]; got[0] != "اجازه دسترسی ندارید" || got[1] != "اجازه دسترسی ندارید" {
+		t.Errorf("answers = %q", got)
+	}
+}
+
+func TestDemotedAdminCannotFinishInput(t *testing.T) {
+	h := newHarness(t)
+	h.run(step{chat: operatorChat, press: "new", state: stateNewLicense})
+	if _, err := h.st.PutAdmin(store.Admin{ChatID: operatorChat, Role: store.RoleReadOnly}); err != nil {
+		t.Fatal(err)
+	}
+	h.run(step{chat: operatorChat, send: "5", want: []string{"اجازه این کار را ندارید"}})
+	if len(h.licenses()) != 0 {
+		t.Errorf("license created by demoted admin")
+	}
+}
+
+func TestOwnerIsEnsured(t *testing.T) {
+	h := newHarness(t)
+	a, err := h.st.GetAdmin(ownerChat)
+	if err != nil || a.Role != store.RoleOwner {
+		t.Fatalf("owner = %+v, %v", a, err)
+	}
+}
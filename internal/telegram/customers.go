@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// customerCountMax caps the licenses counted on a customer screen; the full
+// list is paged through cmdQuery.
+const customerCountMax = 100
+
+// handleNewCustomerInput parses "<name> | [@username] | [contact] | [notes]".
+func (b *Bot) handleNewCustomerInput(chatID int64, text string) {
+	parts := strings.SplitN(text, "|", 4)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	if strings.TrimSpace(parts[0]) == "" {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <name> | [@username] | [contact] | [notes]")
+		return
+	}
+	c, err := b.as(chatID).CreateCustomer(store.Customer{Name: parts[0], Username: parts[1], Contact: parts[2], Notes: parts[3]})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.setState(chatID, stateNone)
+	b.cmdCustomer(chatID, c.ID)
+}
+
+func (b *Bot) cmdCustomers(chatID int64) {
+	list, err := b.st.ListCustomers()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	lines := []string{"مشتری‌ها:"}
+	if len(list) == 0 {
+		lines = append(lines, "(هیچ)")
+	}
+	if len(list) > 30 {
+		lines = append(lines, fmt.Sprintf("(30 از %d نمایش داده شده)", len(list)))
+		list = list[:30]
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(list)+1)
+	for _, c := range list {
+		lines = append(lines, fmt.Sprintf("- %s | %s | %s", c.ID, safeNote(c.Name), formatUsername(c.Username)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 "+shortKey(c.Name), "cust:"+c.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ مشتری جدید", "cust_new"),
+		tgbotapi.NewInlineKeyboardButtonData("🔗 اتصال لایسنس", "ask_link"),
+	), tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = keyboard(b.roleOf(chatID), rows...)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) cmdCustomer(chatID int64, id string) {
+	c, err := b.st.GetCustomer(id)
+	if errors.Is(err, store.ErrCustomerNotFound) {
+		b.sendMenu(chatID, "مشتری پیدا نشد")
+		return
+	}
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	page, err := b.st.QueryLicenses(store.LicenseFilter{CustomerID: c.ID}, "", customerCountMax)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	enabled := 0
+	for _, it := range page.Items {
+		if it.License.Enabled {
+			enabled++
+		}
+	}
+	count := fmt.Sprint(len(page.Items))
+	if page.Next != "" {
+		count += "+"
+	}
+	text := fmt.Sprintf("Customer: %s\nID: %s\nTelegram: %s\nContact: %s\nNotes: %s\nCreated: %s\nLicenses: %s (%d فعال)",
+		safeNote(c.Name), c.ID, formatUsername(c.Username), safeNote(c.Contact), safeNote(c.Notes),
+		c.CreatedAt.Format("2006-01-02 15:04"), count, enabled)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = keyboard(b.roleOf(chatID),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📋 لایسنس‌ها", "clic:"+c.ID),
+			tgbotapi.NewInlineKeyboardButtonData("🔗 اتصال لایسنس", "ask_link"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ فعال کردن همه", "cen:"+c.ID),
+			tgbotapi.NewInlineKeyboardButtonData("⛔ غیرفعال کردن همه", "cdis:"+c.ID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("👤 مشتری‌ها", "custs"),
+			tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+		),
+	)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) cmdCustomerLicenses(chatID int64, id string) {
+	b.setFilter(chatID, store.LicenseFilter{CustomerID: id})
+	b.cmdQuery(chatID, filterCustomer, "")
+}
+
+func (b *Bot) cmdSetCustomerEnabled(chatID int64, id string, enabled bool) {
+	n, err := b.as(chatID).SetCustomerEnabled(id, enabled)
+	if errors.Is(err, store.ErrCustomerNotFound) {
+		b.sendMenu(chatID, "مشتری پیدا نشد")
+		return
+	}
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("OK\n%d لایسنس تغییر کرد", n))
+	b.cmdCustomer(chatID, id)
+}
+
+// handleLinkInput parses "<license> <customer_id>"; "-" as the customer
+// unlinks the license.
+func (b *Bot) handleLinkInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <license> <customer_id|->")
+		return
+	}
+	customerID := fields[1]
+	if customerID == "-" {
+		customerID = ""
+	}
+	lic, err := b.as(chatID).SetLicenseCustomer(fields[0], customerID)
+	if errors.Is(err, store.ErrCustomerNotFound) {
+		b.reply(chatID, "مشتری پیدا نشد")
+		return
+	}
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.setState(chatID, stateNone)
+	b.cmdInfo(chatID, []string{lic.ID})
+	b.sendMenu(chatID, "")
+}
+
+func formatUsername(u string) string {
+	if u == "" {
+		return "-"
+	}
+	return "@" + u
+}
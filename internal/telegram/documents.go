@@ -0,0 +1,42 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"kypaqet-license-bot/internal/backup"
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendDocument uploads data as a file to the chat.
+func (b *Bot) sendDocument(chatID int64, name string, data []byte, caption string) {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	if _, err := b.api.Send(doc); err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+	}
+}
+
+func (b *Bot) cmdBackup(chatID int64) {
+	var buf bytes.Buffer
+	if _, err := b.st.Backup(&buf); err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.sendDocument(chatID, backup.FileName(time.Now()), buf.Bytes(),
+		"بکاپ دیتابیس. فایل key.secret جداگانه نگه داشته شود؛ بدون آن کلیدها قابل استفاده نیستند.")
+}
+
+func (b *Bot) cmdExport(chatID int64, format string) {
+	var buf bytes.Buffer
+	n, err := b.st.Export(&buf, store.ExportOptions{Format: format})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	name := "licenses-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	b.sendDocument(chatID, name, buf.Bytes(), fmt.Sprintf("%d لایسنس", n))
+}
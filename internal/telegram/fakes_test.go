@@ -0,0 +1,78 @@
+package telegram
+
+import (
+	"fmt"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sentMessage is what the bot sent to a chat, flattened for assertions.
+type sentMessage struct {
+	ChatID int64
+	// Text is the message text or document caption.
+	Text string
+	// Buttons holds the callback data of every inline button.
+	Buttons []string
+	// File is the name of a sent document.
+	File string
+}
+
+// recordingSender is a sender that records messages instead of calling
+// Telegram.
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []sentMessage
+	// answers holds the text of every answered callback query.
+	answers []string
+}
+
+func (r *recordingSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var m sentMessage
+	switch c := c.(type) {
+	case tgbotapi.MessageConfig:
+		m = sentMessage{ChatID: c.ChatID, Text: c.Text}
+		if kb, ok := c.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+			for _, row := range kb.InlineKeyboard {
+				for _, btn := range row {
+					if btn.CallbackData != nil {
+						m.Buttons = append(m.Buttons, *btn.CallbackData)
+					}
+				}
+			}
+		}
+	case tgbotapi.DocumentConfig:
+		m = sentMessage{ChatID: c.ChatID, Text: c.Caption}
+		if f, ok := c.File.(tgbotapi.FileBytes); ok {
+			m.File = f.Name
+		}
+	default:
+		return tgbotapi.Message{}, fmt.Errorf("recordingSender: unexpected %T", c)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, m)
+	return tgbotapi.Message{}, nil
+}
+
+func (r *recordingSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if cb, ok := c.(tgbotapi.CallbackConfig); ok {
+		r.mu.Lock()
+		r.answers = append(r.answers, cb.Text)
+		r.mu.Unlock()
+	}
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+// since returns the messages sent after the first n.
+func (r *recordingSender) since(n int) []sentMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sentMessage(nil), r.sent[n:]...)
+}
+
+func (r *recordingSender) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sent)
+}
@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// listPageSize is the number of licenses per list page.
+const listPageSize = 10
+
+// List filter codes used in "lp:<code>:<cursor>" callback data. Search, idle
+// and customer take their argument from the chat's saved filter.
+const (
+	filterAll      = "a"
+	filterEnabled  = "e"
+	filterDisabled = "d"
+	filterFull     = "f"
+	filterUnused   = "u"
+	filterIdle     = "i"
+	filterSearch   = "s"
+	filterCustomer = "c"
+)
+
+var filterStatus = map[string]string{
+	filterEnabled:  store.FilterEnabled,
+	filterDisabled: store.FilterDisabled,
+	filterFull:     store.FilterFull,
+	filterUnused:   store.FilterUnused,
+}
+
+func (b *Bot) setFilter(chatID int64, f store.LicenseFilter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.filters[chatID] = f
+}
+
+func (b *Bot) filterFor(chatID int64, code string) (store.LicenseFilter, string) {
+	b.mu.Lock()
+	saved := b.filters[chatID]
+	b.mu.Unlock()
+	switch code {
+	case filterIdle:
+		return store.LicenseFilter{IdleSince: saved.IdleSince}, "بدون فعالیت از " + saved.IdleSince.Format("2006-01-02")
+	case filterSearch:
+		return store.LicenseFilter{Search: saved.Search}, "جستجو: " + saved.Search
+	case filterCustomer:
+		return store.LicenseFilter{CustomerID: saved.CustomerID}, "مشتری " + saved.CustomerID
+	}
+	if status, ok := filterStatus[code]; ok {
+		return store.LicenseFilter{Status: status}, status
+	}
+	return store.LicenseFilter{}, "همه"
+}
+
+func (b *Bot) cmdQuery(chatID int64, code, cursor string) {
+	filter, title := b.filterFor(chatID, code)
+	page, err := b.st.QueryLicenses(filter, cursor, listPageSize)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+
+	lines := []string{fmt.Sprintf("لایسنس‌ها (%s) — برای جزئیات روی دکمه بزن:", title)}
+	if len(page.Items) == 0 {
+		lines = append(lines, "(هیچ)")
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(page.Items)+4)
+	for _, it := range page.Items {
+		lines = append(lines, fmt.Sprintf("- %s | %d/%d | enabled=%v | %s", it.License.Fingerprint, it.Used, it.License.Limit, it.License.Enabled, safeNote(it.License.Note)))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("ℹ️ "+it.License.Fingerprint, "info:"+it.License.ID),
+		))
+	}
+	var nav []tgbotapi.InlineKeyboardButton
+	if page.Prev != "" {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️ قبلی", "lp:"+code+":"+page.Prev))
+	}
+	if page.Next != "" {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("بعدی ▶️", "lp:"+code+":"+page.Next))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("همه", "lp:"+filterAll+":"),
+			tgbotapi.NewInlineKeyboardButtonData("✅ فعال", "lp:"+filterEnabled+":"),
+			tgbotapi.NewInlineKeyboardButtonData("⛔ غیرفعال", "lp:"+filterDisabled+":"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🈵 پر", "lp:"+filterFull+":"),
+			tgbotapi.NewInlineKeyboardButtonData("🆓 بدون سرور", "lp:"+filterUnused+":"),
+			tgbotapi.NewInlineKeyboardButtonData("💤 بی‌فعالیت", "ask_idle_since"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔎 جستجو", "ask_search"),
+			tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, _ = b.api.Send(msg)
+}
+
+// handleIdleSinceInput accepts a date (YYYY-MM-DD) or a number of days ago.
+func (b *Bot) handleIdleSinceInput(chatID int64, text string) {
+	var since time.Time
+	if days, err := strconv.Atoi(text); err == nil && days >= 0 {
+		since = time.Now().UTC().AddDate(0, 0, -days)
+	} else if t, err := time.Parse("2006-01-02", text); err == nil {
+		since = t
+	} else {
+		b.reply(chatID, "ورودی نامعتبر. مثال: 2025-01-31 یا 30")
+		return
+	}
+	b.setState(chatID, stateNone)
+	b.setFilter(chatID, store.LicenseFilter{IdleSince: since})
+	b.cmdQuery(chatID, filterIdle, "")
+}
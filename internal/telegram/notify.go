@@ -0,0 +1,182 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// notFoundMin is how many unknown-key attempts in one window it takes to
+// notify; a single typo is not worth a message.
+const notFoundMin = 3
+
+// maxPending caps the events kept per type in a window; the rest are only
+// counted.
+const maxPending = 500
+
+var eventTitles = map[events.Type]string{
+	events.Bound:        "🔗 سرور جدید",
+	events.LimitReached: "🚫 پر بودن ظرفیت",
+	events.Disabled:     "⛔ استفاده از کلید غیرفعال",
+	events.NotFound:     "❓ کلید نامعتبر",
+}
+
+type eventBatch struct {
+	count  int
+	events []events.Event
+}
+
+// Notify forwards store events to admins until ctx is done. Events are
+// collected for window after the first one arrives and then sent as one
+// message per type, so a burst of failures produces a single summary.
+func (b *Bot) Notify(ctx context.Context, bus *events.Bus, window time.Duration) {
+	ch, cancel := bus.Subscribe(256)
+	defer cancel()
+
+	pending := map[events.Type]*eventBatch{}
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			eb := pending[ev.Type]
+			if eb == nil {
+				eb = &eventBatch{}
+				pending[ev.Type] = eb
+			}
+			eb.count++
+			if len(eb.events) < maxPending {
+				eb.events = append(eb.events, ev)
+			}
+			if flush == nil {
+				flush = time.After(window)
+			}
+		case <-flush:
+			flush = nil
+			for _, t := range events.Types {
+				if eb := pending[t]; eb != nil {
+					if text := summarize(t, eb, window); text != "" {
+						b.broadcast(t, text)
+					}
+				}
+			}
+			pending = map[events.Type]*eventBatch{}
+		}
+	}
+}
+
+func summarize(t events.Type, eb *eventBatch, window time.Duration) string {
+	if t == events.NotFound && eb.count < notFoundMin {
+		return ""
+	}
+	if eb.count == 1 {
+		ev := eb.events[0]
+		lines := []string{eventTitles[t]}
+		if ev.Fingerprint != "" {
+			lines = append(lines, fmt.Sprintf("License: %s (%s)", ev.Fingerprint, safeNote(ev.Note)))
+		}
+		lines = append(lines, "Server: "+ev.ServerID)
+		if ev.Limit > 0 && t != events.Disabled {
+			lines = append(lines, fmt.Sprintf("Used: %d/%d", ev.Used, ev.Limit))
+		}
+		return strings.Join(append(lines, "From: "+ev.Actor), "\n")
+	}
+
+	// Group by license, or by requester for unknown keys.
+	counts := map[string]int{}
+	for _, ev := range eb.events {
+		label := ev.Actor
+		if t != events.NotFound {
+			label = fmt.Sprintf("%s (%s)", ev.Fingerprint, safeNote(ev.Note))
+		}
+		counts[label]++
+	}
+	labels := make([]string, 0, len(counts))
+	for l := range counts {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if counts[labels[i]] != counts[labels[j]] {
+			return counts[labels[i]] > counts[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	lines := []string{fmt.Sprintf("%s: %d مورد در %s", eventTitles[t], eb.count, window)}
+	for i, l := range labels {
+		if i == 10 {
+			lines = append(lines, fmt.Sprintf("… و %d مورد دیگر", len(labels)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- %s × %d", l, counts[l]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// broadcast sends text to every admin that has not muted t.
+func (b *Bot) broadcast(t events.Type, text string) {
+	admins, err := b.st.ListAdmins()
+	if err != nil {
+		return
+	}
+	for _, a := range admins {
+		if !slices.Contains(a.Muted, string(t)) {
+			b.reply(a.ChatID, text)
+		}
+	}
+}
+
+func (b *Bot) cmdNotifications(chatID int64) {
+	a, err := b.st.GetAdmin(chatID)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(events.Types)+1)
+	for _, t := range events.Types {
+		label := "🔔 " + eventTitles[t]
+		if slices.Contains(a.Muted, string(t)) {
+			label = "🔕 " + eventTitles[t]
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "mute:"+string(t)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, "اعلان‌ها (برای روشن/خاموش کردن روی هر مورد بزن):")
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) cmdToggleMute(chatID int64, t string) {
+	if _, ok := eventTitles[events.Type(t)]; !ok {
+		b.sendMenu(chatID, "عملیات نامعتبر")
+		return
+	}
+	a, err := b.st.GetAdmin(chatID)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	muted := slices.DeleteFunc(slices.Clone(a.Muted), func(m string) bool { return m == t })
+	if len(muted) == len(a.Muted) {
+		muted = append(muted, t)
+	}
+	if _, err := b.st.SetAdminMuted(chatID, muted); err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.cmdNotifications(chatID)
+}
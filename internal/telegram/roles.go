@@ -0,0 +1,220 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// callbackRoles is the minimum role for each callback action (the part of
+// the callback data before the first ':'). Unknown actions need owner.
+var callbackRoles = map[string]string{
+	"menu":           store.RoleReadOnly,
+	"list":           store.RoleReadOnly,
+	"ask_info":       store.RoleReadOnly,
+	"info":           store.RoleReadOnly,
+	"reaped":         store.RoleReadOnly,
+	"hist":           store.RoleReadOnly,
+	"export":         store.RoleReadOnly,
+	"batches":        store.RoleReadOnly,
+	"batch":          store.RoleReadOnly,
+	"bexp":           store.RoleReadOnly,
+	"notif":          store.RoleReadOnly,
+	"lp":             store.RoleReadOnly,
+	"ask_search":     store.RoleReadOnly,
+	"ask_idle_since": store.RoleReadOnly,
+	"mute":           store.RoleReadOnly,
+	"custs":          store.RoleReadOnly,
+	"cust":           store.RoleReadOnly,
+	"clic":           store.RoleReadOnly,
+
+	"new":          store.RoleOperator,
+	"new_timed":    store.RoleOperator,
+	"ask_setlimit": store.RoleOperator,
+	"ask_enable":   store.RoleOperator,
+	"ask_disable":  store.RoleOperator,
+	"ask_renew":    store.RoleOperator,
+	"ask_idle":     store.RoleOperator,
+	"ub":           store.RoleOperator,
+	"mode":         store.RoleOperator,
+	"rst":          store.RoleOperator,
+	"rst!":         store.RoleOperator,
+	"new_batch":    store.RoleOperator,
+	"ben":          store.RoleOperator,
+	"bdis":         store.RoleOperator,
+	"cust_new":     store.RoleOperator,
+	"cen":          store.RoleOperator,
+	"cdis":         store.RoleOperator,
+	"ask_link":     store.RoleOperator,
+
+	"tokens":   store.RoleOwner,
+	"tok_new":  store.RoleOwner,
+	"tokrev":   store.RoleOwner,
+	"admins":   store.RoleOwner,
+	"adm_add":  store.RoleOwner,
+	"adm_rm":   store.RoleOwner,
+	"backup":   store.RoleOwner,
+	"hooks":    store.RoleOwner,
+	"hook_new": store.RoleOwner,
+	"hookrm":   store.RoleOwner,
+	"hooklog":  store.RoleOwner,
+}
+
+// stateRoles is the minimum role to complete a pending text input.
+var stateRoles = map[pendingState]string{
+	stateAskInfo:      store.RoleReadOnly,
+	stateAskSearch:    store.RoleReadOnly,
+	stateAskIdleSince: store.RoleReadOnly,
+	stateNewLicense:   store.RoleOperator,
+	stateNewTimed:     store.RoleOperator,
+	stateAskSetLimit:  store.RoleOperator,
+	stateAskEnable:    store.RoleOperator,
+	stateAskDisable:   store.RoleOperator,
+	stateAskRenew:     store.RoleOperator,
+	stateAskIdle:      store.RoleOperator,
+	stateNewBatch:     store.RoleOperator,
+	stateNewCustomer:  store.RoleOperator,
+	stateAskLink:      store.RoleOperator,
+	stateAskToken:     store.RoleOwner,
+	stateAskAdmin:     store.RoleOwner,
+	stateAskWebhook:   store.RoleOwner,
+}
+
+func callbackRole(data string) string {
+	action, _, _ := strings.Cut(data, ":")
+	if role, ok := callbackRoles[action]; ok {
+		return role
+	}
+	return store.RoleOwner
+}
+
+func stateRole(st pendingState) string {
+	if role, ok := stateRoles[st]; ok {
+		return role
+	}
+	return store.RoleOwner
+}
+
+// roleOf returns the chat's role, or "" if it is not an admin.
+func (b *Bot) roleOf(chatID int64) string {
+	a, err := b.st.GetAdmin(chatID)
+	if err != nil {
+		return ""
+	}
+	return a.Role
+}
+
+func allowed(role, need string) bool {
+	return store.RoleLevel(role) >= store.RoleLevel(need)
+}
+
+// keyboard builds an inline keyboard without the buttons role may not use.
+func keyboard(role string, rows ...[]tgbotapi.InlineKeyboardButton) tgbotapi.InlineKeyboardMarkup {
+	out := make([][]tgbotapi.InlineKeyboardButton, 0, len(rows))
+	for _, row := range rows {
+		kept := make([]tgbotapi.InlineKeyboardButton, 0, len(row))
+		for _, btn := range row {
+			if btn.CallbackData != nil && !allowed(role, callbackRole(*btn.CallbackData)) {
+				continue
+			}
+			kept = append(kept, btn)
+		}
+		if len(kept) > 0 {
+			out = append(out, kept)
+		}
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(out...)
+}
+
+// ensureOwner makes the configured chat an owner so the bot is never left
+// without someone who can manage admins.
+func (b *Bot) ensureOwner() error {
+	a, err := b.st.GetAdmin(b.ownerChatID)
+	if err == nil && a.Role == store.RoleOwner {
+		return nil
+	}
+	if err != nil && !errors.Is(err, store.ErrAdminNotFound) {
+		return err
+	}
+	_, err = b.st.PutAdmin(store.Admin{ChatID: b.ownerChatID, Role: store.RoleOwner, Name: "owner"})
+	return err
+}
+
+func (b *Bot) cmdAdmins(chatID int64) {
+	list, err := b.st.ListAdmins()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	lines := []string{"ادمین‌ها (برای حذف روی دکمه بزن):"}
+	buttons := make([][]tgbotapi.InlineKeyboardButton, 0)
+	for _, a := range list {
+		lines = append(lines, fmt.Sprintf("- %d | %s | %s | since %s", a.ChatID, a.Role, safeNote(a.Name), a.AddedAt.Format(time.RFC3339)))
+		if a.ChatID == b.ownerChatID {
+			continue
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %d (%s)", a.ChatID, a.Role), fmt.Sprintf("adm_rm:%d", a.ChatID)),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ افزودن/تغییر نقش", "adm_add"),
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	_, _ = b.api.Send(msg)
+}
+
+func (b *Bot) handleAdminInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <chat_id> <owner|operator|readonly> [name]")
+		return
+	}
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || id == 0 {
+		b.reply(chatID, "chat_id نامعتبر است")
+		return
+	}
+	role := strings.ToLower(fields[1])
+	if store.RoleLevel(role) == 0 {
+		b.reply(chatID, "نقش نامعتبر است (owner, operator, readonly)")
+		return
+	}
+	if id == b.ownerChatID && role != store.RoleOwner {
+		b.reply(chatID, "نقش مالک اصلی قابل تغییر نیست")
+		return
+	}
+	b.setState(chatID, stateNone)
+	a, err := b.as(chatID).PutAdmin(store.Admin{ChatID: id, Role: role, Name: strings.Join(fields[2:], " ")})
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+	} else {
+		b.reply(chatID, fmt.Sprintf("OK\n%d: %s", a.ChatID, a.Role))
+	}
+	b.cmdAdmins(chatID)
+}
+
+func (b *Bot) cmdRemoveAdmin(chatID int64, arg string) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		b.reply(chatID, "chat_id نامعتبر است")
+		return
+	}
+	if id == b.ownerChatID {
+		b.reply(chatID, "مالک اصلی قابل حذف نیست")
+		return
+	}
+	if err := b.as(chatID).RemoveAdmin(id); err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.reply(chatID, fmt.Sprintf("OK\n%d حذف شد", id))
+}
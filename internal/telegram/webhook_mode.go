@@ -0,0 +1,95 @@
+package telegram
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// webhookQueue is how many webhook updates may wait for RunWebhook. When
+// it is full the handler answers 503 and Telegram retries later.
+const webhookQueue = 100
+
+// secretHeader carries the secret_token registered with setWebhook.
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Telegram only accepts these characters in a secret_token.
+var validSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{16,256}$`)
+
+// CheckWebhookSecret reports whether secret can be used as a webhook secret.
+func CheckWebhookSecret(secret string) error {
+	if !validSecret.MatchString(secret) {
+		return fmt.Errorf("webhook secret must be 16-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+	return nil
+}
+
+// WebhookPath is the URL path updates are posted to. It is derived from the
+// secret so that it is unguessable without putting the secret itself in
+// access logs.
+func WebhookPath(secret string) string {
+	sum := sha256.Sum256([]byte("telegram-webhook:" + secret))
+	return "/telegram/" + hex.EncodeToString(sum[:16])
+}
+
+// WebhookHandler accepts updates posted by Telegram and queues them for
+// RunWebhook, which handles them one at a time like the polling loop.
+func (b *Bot) WebhookHandler(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretHeader)), []byte(secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var u tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&u); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		select {
+		case b.webhookUpdates <- u:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// RunWebhook registers baseURL+WebhookPath(secret) with Telegram and handles
+// the updates WebhookHandler receives until ctx is done. The webhook stays
+// registered on exit so other replicas keep receiving updates.
+func (b *Bot) RunWebhook(ctx context.Context, baseURL, secret string) error {
+	if err := CheckWebhookSecret(secret); err != nil {
+		return err
+	}
+	params := tgbotapi.Params{
+		"url":          strings.TrimRight(baseURL, "/") + WebhookPath(secret),
+		"secret_token": secret,
+	}
+	if err := params.AddInterface("allowed_updates", []string{"message", "callback_query"}); err != nil {
+		return err
+	}
+	if _, err := b.tg.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case u := <-b.webhookUpdates:
+			b.dispatch(u)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testWebhookSecret = "0123456789abcdef-_XYZ"
+
+func TestWebhookHandler(t *testing.T) {
+	h := newHarness(t)
+	handler := h.bot.WebhookHandler(testWebhookSecret)
+	update := `{"update_id":7,"message":{"message_id":1,"chat":{"id":100},"text":"/menu"}}`
+
+	tests := []struct {
+		name   string
+		method string
+		secret string
+		body   string
+		want   int
+		queued bool
+	}{
+		{"valid", http.MethodPost, testWebhookSecret, update, http.StatusOK, true},
+		{"no secret", http.MethodPost, "", update, http.StatusUnauthorized, false},
+		{"wrong secret", http.MethodPost, testWebhookSecret + "x", update, http.StatusUnauthorized, false},
+		{"GET", http.MethodGet, testWebhookSecret, "", http.StatusMethodNotAllowed, false},
+		{"bad body", http.MethodPost, testWebhookSecret, `{"update_id":`, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, WebhookPath(testWebhookSecret), strings.NewReader(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(secretHeader, tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			select {
+			case u := <-h.bot.webhookUpdates:
+				if !tt.queued {
+					t.Fatalf("update %d queued", u.UpdateID)
+				}
+				if u.UpdateID != 7 || u.Message == nil || u.Message.Text != "/menu" {
+					t.Errorf("queued %+v", u)
+				}
+			default:
+				if tt.queued {
+					t.Fatal("update not queued")
+				}
+			}
+		})
+	}
+
+	// A full queue is answered 503 so Telegram retries later.
+	for range webhookQueue {
+		h.bot.webhookUpdates <- tgbotapi.Update{}
+	}
+	req := httptest.NewRequest(http.MethodPost, WebhookPath(testWebhookSecret), strings.NewReader(update))
+	req.Header.Set(secretHeader, testWebhookSecret)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("full queue: status = %d, want 503", rec.Code)
+	}
+}
+
+func TestWebhookSecretAndPath(t *testing.T) {
+	for _, bad := range []string{"", "short", strings.Repeat("a", 257), "0123456789abcdef!"} {
+		if CheckWebhookSecret(bad) == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	if err := CheckWebhookSecret(testWebhookSecret); err != nil {
+		t.Error(err)
+	}
+	path := WebhookPath(testWebhookSecret)
+	if strings.Contains(path, testWebhookSecret) || path == WebhookPath(testWebhookSecret+"x") {
+		t.Errorf("path %q leaks or does not depend on the secret", path)
+	}
+}
+
+// Webhook updates are untrusted: ones without a chat are dropped, not
+// dereferenced.
+func TestUpdatesWithoutChat(t *testing.T) {
+	h := newHarness(t)
+	before := h.tg.count()
+	for _, u := range []tgbotapi.Update{
+		{UpdateID: 1, CallbackQuery: &tgbotapi.CallbackQuery{ID: "inline", InlineMessageID: "m", Data: "menu"}},
+		{UpdateID: 2, CallbackQuery: &tgbotapi.CallbackQuery{ID: "nochat", Message: &tgbotapi.Message{}, Data: "menu"}},
+		{UpdateID: 3, Message: &tgbotapi.Message{Text: "/menu"}},
+	} {
+		h.bot.dispatch(u)
+	}
+	if sent := h.tg.since(before); len(sent) != 0 {
+		t.Errorf("sent %+v", sent)
+	}
+	if len(h.tg.answers) != 2 {
+		t.Errorf("answered %d callbacks, want 2", len(h.tg.answers))
+	}
+}
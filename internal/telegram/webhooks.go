@@ -0,0 +1,130 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/events"
+	"kypaqet-license-bot/internal/store"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// hookStatsWindow is how many recent deliveries the list summarises.
+const hookStatsWindow = 100
+
+func (b *Bot) cmdWebhooks(chatID int64) {
+	hooks, err := b.st.ListWebhooks()
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	lines := []string{"وب‌هوک‌ها:"}
+	if len(hooks) == 0 {
+		lines = append(lines, "(هیچ)")
+	}
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(hooks)+1)
+	for _, w := range hooks {
+		ds, err := b.st.ListDeliveries(w.ID, hookStatsWindow)
+		if err != nil {
+			b.reply(chatID, "خطا: "+err.Error())
+			return
+		}
+		counts := map[string]int{}
+		for _, d := range ds {
+			counts[d.State]++
+		}
+		lines = append(lines, fmt.Sprintf("- %s | %s | %s\n  pending=%d delivered=%d failed=%d",
+			w.ID, w.URL, hookEvents(w), counts[store.DeliveryPending], counts[store.DeliveryDelivered], counts[store.DeliveryFailed]))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📜 "+w.ID, "hooklog:"+w.ID),
+			tgbotapi.NewInlineKeyboardButtonData("🗑 "+w.ID, "hookrm:"+w.ID),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("➕ وب‌هوک جدید", "hook_new"),
+		tgbotapi.NewInlineKeyboardButtonData("↩️ منو", "menu"),
+	))
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, _ = b.api.Send(msg)
+}
+
+func hookEvents(w store.Webhook) string {
+	if len(w.Events) == 0 {
+		return "all"
+	}
+	return strings.Join(w.Events, ",")
+}
+
+func (b *Bot) handleWebhookInput(chatID int64, text string) {
+	fields := strings.Fields(text)
+	if len(fields) < 1 || len(fields) > 2 {
+		b.reply(chatID, "ورودی نامعتبر. فرمت: <url> [event,event]")
+		return
+	}
+	var types []string
+	if len(fields) == 2 {
+		types = strings.Split(fields[1], ",")
+	}
+	w, err := b.as(chatID).CreateWebhook(fields[0], types)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	b.setState(chatID, stateNone)
+	b.reply(chatID, fmt.Sprintf("وب‌هوک ساخته شد: %s\nSecret (برای بررسی امضا):\n%s", w.ID, w.Secret))
+	b.cmdWebhooks(chatID)
+}
+
+func (b *Bot) cmdDeleteWebhook(chatID int64, id string) {
+	err := b.as(chatID).DeleteWebhook(id)
+	switch {
+	case errors.Is(err, store.ErrWebhookNotFound):
+		b.reply(chatID, "وب‌هوک پیدا نشد")
+	case err != nil:
+		b.reply(chatID, "خطا: "+err.Error())
+	default:
+		b.reply(chatID, "OK\nوب‌هوک حذف شد")
+	}
+	b.cmdWebhooks(chatID)
+}
+
+func (b *Bot) cmdWebhookLog(chatID int64, id string) {
+	ds, err := b.st.ListDeliveries(id, 20)
+	if err != nil {
+		b.reply(chatID, "خطا: "+err.Error())
+		return
+	}
+	lines := []string{"آخرین ارسال‌های " + id + ":"}
+	if len(ds) == 0 {
+		lines = append(lines, "(هیچ)")
+	}
+	for _, d := range ds {
+		line := fmt.Sprintf("- %s | %s | %s | tries=%d", d.CreatedAt.Format("01-02 15:04:05"), d.Event, d.State, d.Attempts)
+		if d.LastError != "" {
+			line += " | " + d.LastError
+		}
+		if d.State == store.DeliveryPending && d.Attempts > 0 {
+			line += " | next " + d.NextAttempt.Format(time.TimeOnly)
+		}
+		lines = append(lines, line)
+	}
+	msg := tgbotapi.NewMessage(chatID, strings.Join(lines, "\n"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("↩️ وب‌هوک‌ها", "hooks"),
+	))
+	_, _ = b.api.Send(msg)
+}
+
+func webhookPrompt() string {
+	types := make([]string, len(events.Types))
+	for i, t := range events.Types {
+		types[i] = string(t)
+	}
+	return "فرمت: <url> [event,event]\nبدون event همه رویدادها ارسال می‌شوند.\nرویدادها: " + strings.Join(types, ", ") +
+		"\nمثال: https://billing.example.com/hooks/license bound"
+}
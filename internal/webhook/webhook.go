@@ -0,0 +1,139 @@
+// Package webhook delivers queued license events from the store's outbox to
+// subscribed URLs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kypaqet-license-bot/internal/store"
+)
+
+// Request headers. The signature is "sha256=" + hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed by the webhook secret.
+const (
+	HeaderSignature = "X-Licensebot-Signature"
+	HeaderTimestamp = "X-Licensebot-Timestamp"
+	HeaderEvent     = "X-Licensebot-Event"
+	HeaderDelivery  = "X-Licensebot-Delivery"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed.
+	MaxAttempts = 10
+	baseDelay   = 30 * time.Second
+	maxDelay    = 6 * time.Hour
+	// keepFinished is how long delivered and failed entries stay visible.
+	keepFinished = 7 * 24 * time.Hour
+	batchSize    = 50
+)
+
+// Sign computes the signature header value for body sent at ts.
+func Sign(secret string, ts int64, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Backoff is the delay before retry number attempt (1-based): 30s doubling
+// up to 6h.
+func Backoff(attempt int) time.Duration {
+	d := baseDelay
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+	return d
+}
+
+// Run delivers due events every interval until ctx is done.
+func Run(ctx context.Context, st store.Store, every time.Duration) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	lastPrune := time.Time{}
+	for {
+		if err := deliverDue(ctx, st, client); err != nil {
+			log.Printf("webhooks: %v", err)
+		}
+		if time.Since(lastPrune) > time.Hour {
+			if _, err := st.PruneDeliveries(time.Now().Add(-keepFinished)); err != nil {
+				log.Printf("webhooks: prune: %v", err)
+			}
+			lastPrune = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func deliverDue(ctx context.Context, st store.Store, client *http.Client) error {
+	due, err := st.DueDeliveries(time.Now().UTC(), batchSize)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	hooks, err := st.ListWebhooks()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]store.Webhook, len(hooks))
+	for _, w := range hooks {
+		byID[w.ID] = w
+	}
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		w, ok := byID[d.WebhookID]
+		if !ok {
+			continue
+		}
+		attempt := send(ctx, client, w, d)
+		if !attempt.OK && d.Attempts+1 < MaxAttempts {
+			attempt.Retry = time.Now().UTC().Add(Backoff(d.Attempts + 1))
+		}
+		if err := st.RecordDelivery(d.ID, attempt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func send(ctx context.Context, client *http.Client, w store.Webhook, d store.WebhookDelivery) store.DeliveryAttempt {
+	ts := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return store.DeliveryAttempt{Error: err.Error()}
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(w.Secret, ts, d.Payload))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	resp, err := client.Do(req)
+	if err != nil {
+		return store.DeliveryAttempt{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return store.DeliveryAttempt{Status: resp.StatusCode, Error: fmt.Sprintf("http %d", resp.StatusCode)}
+	}
+	return store.DeliveryAttempt{OK: true, Status: resp.StatusCode}
+}
@@ -0,0 +1,287 @@
+// Package licenseclient talks to the license server's client API
+// (/v1/activate, /v1/validate, /v1/deactivate) on behalf of paqet installers.
+package licenseclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+)
+
+// Errors returned for the server's "reason" values.
+var (
+	ErrInvalidRequest = errors.New("licenseclient: invalid request")
+	ErrNotFound       = errors.New("licenseclient: license not found")
+	ErrDisabled       = errors.New("licenseclient: license disabled")
+	ErrExpired        = errors.New("licenseclient: license expired")
+	ErrLimitReached   = errors.New("licenseclient: server limit reached")
+	ErrNotBound       = errors.New("licenseclient: server not bound")
+	ErrRateLimited    = errors.New("licenseclient: rate limited")
+	ErrServer         = errors.New("licenseclient: server error")
+)
+
+var reasonErrors = map[string]error{
+	"invalid_request":    ErrInvalidRequest,
+	"server_id_too_long": ErrInvalidRequest,
+	"bad_json":           ErrInvalidRequest,
+	"not_found":          ErrNotFound,
+	"disabled":           ErrDisabled,
+	"expired":            ErrExpired,
+	"limit_reached":      ErrLimitReached,
+	"not_bound":          ErrNotBound,
+	"rate_limited":       ErrRateLimited,
+	"server_error":       ErrServer,
+}
+
+// Result mirrors the server's activation response.
+type Result struct {
+	OK         bool       `json:"ok"`
+	Reason     string     `json:"reason"`
+	Enabled    bool       `json:"enabled"`
+	Used       int        `json:"used"`
+	Limit      int        `json:"limit"`
+	NewlyBound bool       `json:"newly_bound"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Token      string     `json:"token,omitempty"`
+
+	// LeaseExpiresAt is set for floating licenses: validate again before
+	// it, or the seat goes to another server.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+
+	// Cached is set when the result came from the on-disk cache because
+	// the server could not be reached.
+	Cached bool `json:"-"`
+}
+
+type Config struct {
+	// BaseURL of the license server, e.g. "https://lic.example.com".
+	BaseURL string
+	License string
+	// ServerID defaults to MachineFingerprint().
+	ServerID string
+	// PublicKey, if set, is used to verify tokens and enables the offline
+	// fallback to a cached activation. Successful activate and validate
+	// responses must then carry a valid token or fail with
+	// license.ErrTokenInvalid.
+	PublicKey ed25519.PublicKey
+	// CachePath stores the last successful activation; empty disables it.
+	CachePath string
+
+	HTTPClient *http.Client
+	// Retries is the number of extra attempts on network or 5xx errors.
+	Retries int
+	// Backoff is the initial delay between attempts; it doubles each time.
+	Backoff time.Duration
+}
+
+type Client struct {
+	cfg Config
+}
+
+func New(cfg Config) (*Client, error) {
+	cfg.BaseURL = strings.TrimRight(strings.TrimSpace(cfg.BaseURL), "/")
+	cfg.License = strings.TrimSpace(cfg.License)
+	if cfg.BaseURL == "" || cfg.License == "" {
+		return nil, fmt.Errorf("licenseclient: base url and license are required")
+	}
+	if cfg.ServerID == "" {
+		id, err := MachineFingerprint()
+		if err != nil {
+			return nil, err
+		}
+		cfg.ServerID = id
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	return &Client{cfg: cfg}, nil
+}
+
+// ServerID returns the id this client binds as.
+func (c *Client) ServerID() string { return c.cfg.ServerID }
+
+// Activate binds this server to the license. If the server is unreachable and
+// a cached activation with a still-valid token exists, that is returned with
+// Cached set.
+func (c *Client) Activate(ctx context.Context) (Result, error) {
+	return c.confirm(ctx, "/v1/activate")
+}
+
+// Heartbeat re-confirms an existing activation without binding a new seat.
+// It returns ErrNotBound if this server lost its seat (call Activate again)
+// and ErrDisabled or ErrExpired when the instance should shut down. Like
+// Activate it falls back to the cached activation when offline. Floating
+// licenses must heartbeat before Result.LeaseExpiresAt; the offline fallback
+// ends there too, as the token expires with the lease.
+func (c *Client) Heartbeat(ctx context.Context) (Result, error) {
+	return c.confirm(ctx, "/v1/validate")
+}
+
+func (c *Client) confirm(ctx context.Context, path string) (Result, error) {
+	res, err := c.call(ctx, path)
+	if err == nil {
+		// With a public key an unsigned success is as good as a forged one.
+		if c.cfg.PublicKey != nil && c.verify(res) != nil {
+			return Result{}, license.ErrTokenInvalid
+		}
+		c.saveCache(res)
+		return res, nil
+	}
+	var te *transportError
+	if errors.As(err, &te) {
+		if cached, cerr := c.offline(); cerr == nil {
+			return cached, nil
+		}
+	}
+	return res, err
+}
+
+// Deactivate releases this server's seat and drops the cached activation.
+func (c *Client) Deactivate(ctx context.Context) (Result, error) {
+	res, err := c.call(ctx, "/v1/deactivate")
+	if err == nil && c.cfg.CachePath != "" {
+		_ = os.Remove(c.cfg.CachePath)
+	}
+	return res, err
+}
+
+// Cached returns the last successful activation saved on disk.
+func (c *Client) Cached() (Result, error) {
+	if c.cfg.CachePath == "" {
+		return Result{}, os.ErrNotExist
+	}
+	raw, err := os.ReadFile(c.cfg.CachePath)
+	if err != nil {
+		return Result{}, err
+	}
+	var res Result
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return Result{}, err
+	}
+	res.Cached = true
+	return res, nil
+}
+
+func (c *Client) offline() (Result, error) {
+	if c.cfg.PublicKey == nil {
+		return Result{}, errors.New("licenseclient: no public key for offline use")
+	}
+	res, err := c.Cached()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := c.verify(res); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// verify checks that res carries an unexpired token for this license and
+// server, signed by PublicKey.
+func (c *Client) verify(res Result) error {
+	claims, err := license.VerifyToken(c.cfg.PublicKey, res.Token, time.Now())
+	if err != nil {
+		return err
+	}
+	if claims.License != c.cfg.License || claims.ServerID != c.cfg.ServerID {
+		return license.ErrTokenInvalid
+	}
+	return nil
+}
+
+func (c *Client) saveCache(res Result) {
+	if c.cfg.CachePath == "" {
+		return
+	}
+	buf, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	_ = os.MkdirAll(filepath.Dir(c.cfg.CachePath), 0o755)
+	tmp := c.cfg.CachePath + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, c.cfg.CachePath)
+}
+
+// transportError marks failures where the server gave no usable answer.
+type transportError struct{ err error }
+
+func (e *transportError) Error() string { return "licenseclient: " + e.err.Error() }
+func (e *transportError) Unwrap() error { return e.err }
+
+func (c *Client) call(ctx context.Context, path string) (Result, error) {
+	body, _ := json.Marshal(map[string]string{"license": c.cfg.License, "server_id": c.cfg.ServerID})
+	delay := c.cfg.Backoff
+	var lastErr error
+	for attempt := 0; attempt <= c.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return Result{}, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+		res, retry, err := c.do(ctx, path, body)
+		if err == nil || !retry {
+			return res, err
+		}
+		lastErr = err
+	}
+	return Result{}, lastErr
+}
+
+func (c *Client) do(ctx context.Context, path string, body []byte) (Result, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, false, err
+	}
+	req.Header.Set("content-type", "application/json")
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return Result{}, ctx.Err() == nil, &transportError{err}
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Result{}, true, &transportError{err}
+	}
+	var res Result
+	if jerr := json.Unmarshal(raw, &res); jerr != nil || res.Reason == "" {
+		err := &transportError{fmt.Errorf("unexpected response: %s", resp.Status)}
+		return Result{}, resp.StatusCode >= 500, err
+	}
+	if res.OK {
+		return res, false, nil
+	}
+	if resp.StatusCode >= 500 {
+		return res, true, &transportError{reasonError(res.Reason)}
+	}
+	return res, false, reasonError(res.Reason)
+}
+
+func reasonError(reason string) error {
+	if err, ok := reasonErrors[reason]; ok {
+		return err
+	}
+	return fmt.Errorf("licenseclient: %s", reason)
+}
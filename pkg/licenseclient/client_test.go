@@ -0,0 +1,114 @@
+package licenseclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kypaqet-license-bot/internal/license"
+)
+
+const (
+	testKey    = "KYPAQET-AAAA-BBBB-CCCC-DDDD"
+	testServer = "srv-1"
+)
+
+// server answers every request with res, as the license server would.
+func server(t *testing.T, res Result) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if !res.OK {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sign(t *testing.T, priv ed25519.PrivateKey, key, serverID string) string {
+	t.Helper()
+	now := time.Now()
+	tok, err := license.SignToken(priv, license.Claims{License: key, ServerID: serverID, Limit: 1,
+		IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestActivateToken(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	ok := Result{OK: true, Reason: "ok", Enabled: true, Used: 1, Limit: 1}
+	withToken := func(tok string) Result {
+		r := ok
+		r.Token = tok
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		res    Result
+		pubKey ed25519.PublicKey
+		want   error
+	}{
+		{"signed", withToken(sign(t, priv, testKey, testServer)), pub, nil},
+		{"stripped token", ok, pub, license.ErrTokenInvalid},
+		{"wrong signer", withToken(sign(t, otherPriv, testKey, testServer)), pub, license.ErrTokenInvalid},
+		{"other server", withToken(sign(t, priv, testKey, "srv-2")), pub, license.ErrTokenInvalid},
+		{"no public key", ok, nil, nil},
+		{"refused", Result{Reason: "limit_reached"}, pub, ErrLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(Config{BaseURL: server(t, tt.res).URL, License: testKey, ServerID: testServer, PublicKey: tt.pubKey})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := c.Activate(context.Background())
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !res.OK {
+				t.Errorf("res = %+v, want ok", res)
+			}
+		})
+	}
+}
+
+func TestDeactivate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := filepath.Join(t.TempDir(), "activation.json")
+	c, err := New(Config{BaseURL: server(t, Result{OK: true, Reason: "ok", Limit: 1}).URL, License: testKey, ServerID: testServer,
+		PublicKey: pub, CachePath: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.saveCache(Result{OK: true, Reason: "ok", Used: 1, Limit: 1, Token: sign(t, priv, testKey, testServer)})
+
+	// The server sends no token for a release.
+	if res, err := c.Deactivate(context.Background()); err != nil || !res.OK {
+		t.Fatalf("Deactivate = %+v, %v", res, err)
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("cache left behind: %v", err)
+	}
+	if _, err := c.offline(); err == nil {
+		t.Error("offline fallback still available after release")
+	}
+}
@@ -0,0 +1,66 @@
+package licenseclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+var machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// MachineFingerprint derives a stable server_id from the machine id and the
+// hardware addresses of physical interfaces. The raw values are hashed so
+// they are never sent to the license server.
+func MachineFingerprint() (string, error) {
+	var parts []string
+	for _, p := range machineIDPaths {
+		if raw, err := os.ReadFile(p); err == nil {
+			if id := strings.TrimSpace(string(raw)); id != "" {
+				parts = append(parts, "mid:"+id)
+				break
+			}
+		}
+	}
+	parts = append(parts, macAddrs()...)
+	if len(parts) == 0 {
+		return "", errors.New("licenseclient: no machine id or MAC address found")
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+func macAddrs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		// Skip virtual interfaces whose MAC changes between boots.
+		if isVirtual(iface.Name) {
+			continue
+		}
+		out = append(out, "mac:"+iface.HardwareAddr.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func isVirtual(name string) bool {
+	if _, err := os.Stat("/sys/devices/virtual/net/" + name); err == nil {
+		return true
+	}
+	for _, p := range []string{"docker", "veth", "br-", "virbr", "tun", "tap", "wg"} {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}